@@ -2,6 +2,7 @@ package buffer
 
 import (
 	"errors"
+	"io"
 )
 
 // ErrBufferCapacityNotEnough is defined error of buffer full
@@ -25,6 +26,10 @@ type Buffer interface {
 	// Write will write bytes to buffer
 	// When buffer full will throw ErrBufferCapacityNotEnough error
 	Write(p []byte) (int, error)
+	// Fill will read from reader once into buffer without an intermediate copy
+	// It reads into the contiguous free space after the last byte, so it may read less than the free space.
+	// When buffer full will throw ErrBufferCapacityNotEnough error without reading.
+	Fill(reader io.Reader) (int, error)
 	// Reset will reset the buffer
 	Reset()
 	// Bytes will return all bytes in buffer
@@ -133,9 +138,32 @@ func (r *ringBuffer) Write(p []byte) (int, error) {
 	return pl, err
 }
 
+func (r *ringBuffer) Fill(reader io.Reader) (int, error) {
+	if r.full {
+		return 0, ErrBufferCapacityNotEnough
+	}
+	free := r.buf[r.end:]
+	if r.start > r.end {
+		free = r.buf[r.end:r.start]
+	}
+	n, err := reader.Read(free)
+	if n <= 0 {
+		return 0, err
+	}
+	r.end += n
+	if r.end >= r.capacity {
+		r.end -= r.capacity
+	}
+	if r.end == r.start {
+		r.full = true
+	}
+	return n, err
+}
+
 func (r *ringBuffer) Reset() {
 	r.start = 0
 	r.end = 0
+	r.full = false
 }
 
 func (r *ringBuffer) Bytes() []byte {
@@ -2,6 +2,7 @@ package buffer
 
 import (
 	"bytes"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -133,6 +134,10 @@ func TestRingBuffer_Reset(t *testing.T) {
 	assert.EqualValues(t, buf.Bytes(), []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
 	buf.Reset()
 	assert.EqualValues(t, buf.Bytes(), []byte{})
+	buf.Write(bytes.Repeat([]byte{0x01}, 10))
+	assert.Equal(t, buf.Size(), 10)
+	buf.Reset()
+	assert.Equal(t, buf.Size(), 0)
 }
 
 func TestRingBuffer_Write(t *testing.T) {
@@ -162,3 +167,26 @@ func TestRingBuffer_Write(t *testing.T) {
 	assert.Equal(t, n, 6)
 	assert.Nil(t, err)
 }
+
+func TestRingBuffer_Fill(t *testing.T) {
+	buf := NewBuffer(10)
+	n, err := buf.Fill(bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}))
+	assert.Equal(t, n, 6)
+	assert.Nil(t, err)
+	buf.ShiftN(4)
+	// only the free space after the last byte is filled
+	n, err = buf.Fill(bytes.NewReader([]byte{0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c}))
+	assert.Equal(t, n, 4)
+	assert.Nil(t, err)
+	n, err = buf.Fill(bytes.NewReader([]byte{0x0b, 0x0c, 0x0d, 0x0e, 0x0f}))
+	assert.Equal(t, n, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, buf.Size(), 10)
+	assert.EqualValues(t, buf.Bytes(), []byte{0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e})
+	n, err = buf.Fill(bytes.NewReader([]byte{0x10}))
+	assert.Equal(t, n, 0)
+	assert.ErrorIs(t, err, ErrBufferCapacityNotEnough)
+	buf.Reset()
+	_, err = buf.Fill(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -10,6 +10,14 @@ var (
 	ErrBrokerClosed = errors.New("broker is closed")
 )
 
+// Message is the value received by subscriber subscribed WithMessage
+type Message struct {
+	// Topic is the topic of message published, empty when published without topic
+	Topic string
+	// Value is the published value
+	Value interface{}
+}
+
 // Broker is defined a message queue broker.
 // The method Publish message to all Subscriber.
 // All subscriber can use method Subscribe to subscribe message
@@ -88,12 +88,17 @@ func (m *memoryBroker) publishToAllSubscribers(item publishItem) {
 			continue
 		}
 	pub:
+		value := item.value
+		if _, ok := opts[MessageOptionKey]; ok {
+			topic, _ := item.opts[TopicOptionKey].(string)
+			value = &Message{Topic: topic, Value: item.value}
+		}
 		ctx, cancel := context.WithCancel(m.ctx)
 		if timeout, ok := opts[TimeoutOptionKey]; ok {
 			ctx, cancel = context.WithTimeout(m.ctx, timeout.(time.Duration))
 		}
 		select {
-		case ch <- item.value:
+		case ch <- value:
 		case <-ctx.Done():
 		}
 		cancel()
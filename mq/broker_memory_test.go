@@ -91,6 +91,18 @@ func TestMemoryBroker_Publish(t *testing.T) {
 		default:
 		}
 	})
+	t.Run("test publish with message", func(t *testing.T) {
+		sub4 := make(chan interface{}, 10)
+		mem.Subscribe(sub4, WithMessage())
+		mem.Publish(567, WithTopic("event"))
+		assert.Equal(t, <-sub4, &Message{Topic: "event", Value: 567})
+		mem.Publish(678)
+		assert.Equal(t, <-sub4, &Message{Value: 678})
+		mem.Unsubscribe(sub4)
+		assert.Equal(t, <-sub1, 567)
+		assert.Equal(t, <-sub2, 567)
+		assert.Equal(t, <-sub2, 678)
+	})
 	t.Run("test publish with timeout", func(t *testing.T) {
 		sub3 := make(chan interface{})
 		defer close(sub3)
@@ -11,6 +11,7 @@ type Option func(opts *Options)
 const (
 	TopicOptionKey   = "topic"   // the topic key name in options
 	TimeoutOptionKey = "timeout" // the timeout key name in options
+	MessageOptionKey = "message" // the receiving Message key name in options
 )
 
 // WithTopic is set message topic or set subscriber only subscribe some topic
@@ -20,6 +21,13 @@ func WithTopic(topic string) Option {
 	}
 }
 
+// WithMessage is set subscriber receive *Message with topic instead of the published value
+func WithMessage() Option {
+	return func(opts *Options) {
+		(*opts)[MessageOptionKey] = true
+	}
+}
+
 // WithTimeout is set subscriber receive message timeout
 func WithTimeout(timeout time.Duration) Option {
 	return func(opts *Options) {
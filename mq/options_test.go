@@ -17,6 +17,15 @@ func TestWithTopic(t *testing.T) {
 	assert.True(t, ok)
 }
 
+func TestWithMessage(t *testing.T) {
+	var opts Options = make(map[string]interface{})
+	_, ok := opts[MessageOptionKey]
+	assert.False(t, ok)
+	WithMessage()(&opts)
+	_, ok = opts[MessageOptionKey]
+	assert.True(t, ok)
+}
+
 func TestWithTimeout(t *testing.T) {
 	var opts Options = make(map[string]interface{})
 	_, ok := opts[TimeoutOptionKey]
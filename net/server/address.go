@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Address is a listen address of server
+type Address struct {
+	// Network is the listen network, such as "tcp", "tcp4", "tcp6" or "unix"
+	Network string
+	// Addr is the listen address, such as ":8080"
+	Addr string
+	// Options is the options only apply to connections of this address
+	Options AddressOptions
+}
+
+// AddressOptions defined options of an Address
+type AddressOptions struct {
+	// ProxyProtocol will parse PROXY protocol header of connections when not nil
+	ProxyProtocol *ProxyProtocol
+	// Admission will control which connections are admitted when not nil
+	Admission *Admission
+	// InboundLimit will limit inbound traffic of each connection when not nil
+	InboundLimit *InboundLimit
+	// TLS will serve connections over TLS when not nil, PROXY protocol header is read before TLS handshake
+	TLS *tls.Config
+	// Sniffer will route connections to Codec and Handler by their first bytes when not nil
+	Sniffer *Sniffer
+	// DrainTimeout is how long connections are still served after the Address stopped while server running,
+	// connections still open after it are closed, zero closes them immediately
+	DrainTimeout time.Duration
+	// WrapConn will wrap each accepted connection before any bytes read when not nil, such as injecting faults in tests
+	WrapConn func(conn net.Conn) net.Conn
+}
+
+// AddressState is the serving state of an Address
+type AddressState int
+
+const (
+	AddressStopped   AddressState = iota // not bound, or stopped and all its connections closed
+	AddressBinding                       // bound and will listen when server started
+	AddressListening                     // listening and accepting connections
+	AddressDraining                      // not accepting, connections already accepted are still served
+)
+
+func (a AddressState) String() string {
+	switch a {
+	case AddressStopped:
+		return "stopped"
+	case AddressBinding:
+		return "binding"
+	case AddressListening:
+		return "listening"
+	case AddressDraining:
+		return "draining"
+	}
+	return "unknown"
+}
+
+// AddressOption is callback function to edit AddressOptions
+type AddressOption func(options *AddressOptions)
+
+// NewAddress will create Address of network and addr
+func NewAddress(network, addr string, opts ...AddressOption) *Address {
+	address := &Address{Network: network, Addr: addr}
+	for _, o := range opts {
+		o(&address.Options)
+	}
+	return address
+}
+
+// String will return address in format network://addr
+func (a *Address) String() string {
+	return a.Network + "://" + a.Addr
+}
+
+// WithProxyProtocol is edit AddressOptions ProxyProtocol field
+func WithProxyProtocol(proxyProtocol *ProxyProtocol) AddressOption {
+	return func(options *AddressOptions) {
+		options.ProxyProtocol = proxyProtocol
+	}
+}
+
+// WithAdmission is edit AddressOptions Admission field
+func WithAdmission(admission *Admission) AddressOption {
+	return func(options *AddressOptions) {
+		options.Admission = admission
+	}
+}
+
+// WithInboundLimit is edit AddressOptions InboundLimit field
+func WithInboundLimit(limit *InboundLimit) AddressOption {
+	return func(options *AddressOptions) {
+		options.InboundLimit = limit
+	}
+}
+
+// WithSniffer is edit AddressOptions Sniffer field
+func WithSniffer(sniffer *Sniffer) AddressOption {
+	return func(options *AddressOptions) {
+		options.Sniffer = sniffer
+	}
+}
+
+// WithTLS is edit AddressOptions TLS field
+func WithTLS(config *tls.Config) AddressOption {
+	return func(options *AddressOptions) {
+		options.TLS = config
+	}
+}
+
+// WithDrainTimeout is edit AddressOptions DrainTimeout field
+func WithDrainTimeout(timeout time.Duration) AddressOption {
+	return func(options *AddressOptions) {
+		options.DrainTimeout = timeout
+	}
+}
+
+// WithWrapConn is edit AddressOptions WrapConn field
+func WithWrapConn(wrap func(conn net.Conn) net.Conn) AddressOption {
+	return func(options *AddressOptions) {
+		options.WrapConn = wrap
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler will return a http.Handler to inspect server
+// Mount it with http.StripPrefix when served under a path prefix.
+//
+//	GET    /stats            server Stats as JSON
+//	GET    /metrics          server Stats in Prometheus text format
+//	GET    /connections      connections being served as JSON
+//	DELETE /connections/{id} disconnect the connection of id
+func (s *netServer) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, s.Stats())
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = s.WritePrometheus(w)
+	})
+	mux.HandleFunc("/connections", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		conns := s.Connections()
+		if conns == nil {
+			conns = []ConnectionStats{}
+		}
+		writeJSON(w, conns)
+	})
+	mux.HandleFunc("/connections/", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodDelete) {
+			return
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/connections/"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid connection id", http.StatusBadRequest)
+			return
+		}
+		if !s.Kill(id) {
+			http.Error(w, "connection not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetServer_AdminHandler(t *testing.T) {
+	s := newTestServer()
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	admin := httptest.NewServer(s.AdminHandler())
+	defer admin.Close()
+
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write([]byte("hi"))
+	_, err = conn.Read(make([]byte, 2))
+	assert.Nil(t, err)
+
+	resp, err := http.Get(admin.URL + "/connections")
+	assert.Nil(t, err)
+	var conns []ConnectionStats
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&conns))
+	resp.Body.Close()
+	assert.Len(t, conns, 1)
+	assert.Equal(t, conns[0].Address, address.String())
+	assert.Equal(t, conns[0].Remote, conn.LocalAddr().String())
+
+	resp, err = http.Get(admin.URL + "/stats")
+	assert.Nil(t, err)
+	var stats Stats
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&stats))
+	resp.Body.Close()
+	assert.Equal(t, stats.Addresses[0].Active, 1)
+
+	resp, err = http.Get(admin.URL + "/metrics")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	kill := func(id string) int {
+		req, _ := http.NewRequest(http.MethodDelete, admin.URL+"/connections/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, kill("x"), http.StatusBadRequest)
+	assert.Equal(t, kill("0"), http.StatusNotFound)
+	assert.Equal(t, kill(strconv.FormatUint(conns[0].ID, 10)), http.StatusNoContent)
+	<-handler.disconnected
+
+	resp, err = http.Post(admin.URL+"/stats", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
+
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrAddressDenied will throw when client address denied by AccessList
+	ErrAddressDenied = errors.New("client address denied")
+	// ErrTooManyConnections will throw when Admission MaxConnections reached
+	ErrTooManyConnections = errors.New("too many connections")
+	// ErrTooManyConnectionsPerIP will throw when Admission MaxConnectionsPerIP reached
+	ErrTooManyConnectionsPerIP = errors.New("too many connections of client ip")
+	// ErrAcceptRateLimited will throw when Admission Rate exceeded
+	ErrAcceptRateLimited = errors.New("accept rate limited")
+)
+
+// AccessList is CIDR allow and deny lists of client address
+// It is safe to update at runtime.
+type AccessList struct {
+	mu    sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewAccessList will create an AccessList permits all addresses
+func NewAccessList() *AccessList {
+	return new(AccessList)
+}
+
+// Allow will append networks to allow list
+// When allow list not empty, only addresses in it are permitted.
+func (a *AccessList) Allow(cidrs ...string) error {
+	nets, err := ParseCIDRs(cidrs...)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.allow = append(a.allow, nets...)
+	a.mu.Unlock()
+	return nil
+}
+
+// Deny will append networks to deny list
+// Deny list has priority over allow list.
+func (a *AccessList) Deny(cidrs ...string) error {
+	nets, err := ParseCIDRs(cidrs...)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.deny = append(a.deny, nets...)
+	a.mu.Unlock()
+	return nil
+}
+
+// SetAllow will replace allow list by networks
+func (a *AccessList) SetAllow(cidrs ...string) error {
+	nets, err := ParseCIDRs(cidrs...)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.allow = nets
+	a.mu.Unlock()
+	return nil
+}
+
+// SetDeny will replace deny list by networks
+func (a *AccessList) SetDeny(cidrs ...string) error {
+	nets, err := ParseCIDRs(cidrs...)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.deny = nets
+	a.mu.Unlock()
+	return nil
+}
+
+// Permit will return whether ip is permitted
+func (a *AccessList) Permit(ip net.IP) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, n := range a.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, n := range a.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Admission is the Address option to control which connections are admitted
+// Rejected connections are closed before Handler OnConnected.
+// The client address is the PROXY protocol source when ProxyProtocol configured.
+// An Admission should not be shared by addresses, its counters are of one address.
+type Admission struct {
+	// MaxConnections is the max count of connections, zero means no limit
+	MaxConnections int
+	// MaxConnectionsPerIP is the max count of connections of a client ip, zero means no limit
+	MaxConnectionsPerIP int
+	// AccessList is the client address allow and deny lists, nil means permit all
+	AccessList *AccessList
+	// Rate is the max connections admitted per second, zero means no limit
+	Rate float64
+	// Burst is the max connections admitted at once above Rate
+	Burst int
+	// OnReject will be called with the reason when a connection rejected
+	OnReject func(conn net.Conn, err error)
+
+	mu       sync.Mutex
+	total    int
+	perIP    map[string]int
+	bucket   *tokenBucket
+	rejected uint64
+}
+
+// Connections will return the count of admitted connections not closed
+func (a *Admission) Connections() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.total
+}
+
+// Rejected will return the count of rejected connections
+func (a *Admission) Rejected() uint64 {
+	return atomic.LoadUint64(&a.rejected)
+}
+
+func (a *Admission) admit(addr net.Addr) error {
+	ip := addrIP(addr)
+	if a.AccessList != nil && ip != nil && !a.AccessList.Permit(ip) {
+		return ErrAddressDenied
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.MaxConnections > 0 && a.total >= a.MaxConnections {
+		return ErrTooManyConnections
+	}
+	perIP := a.MaxConnectionsPerIP > 0 && ip != nil
+	if perIP && a.perIP[ip.String()] >= a.MaxConnectionsPerIP {
+		return ErrTooManyConnectionsPerIP
+	}
+	// the rate token is taken only by connections passed the limits, so rejected ones do not drain it
+	if a.Rate > 0 {
+		if a.bucket == nil {
+			a.bucket = newTokenBucket(a.Rate, a.Burst)
+		}
+		if !a.bucket.take(time.Now(), 1) {
+			return ErrAcceptRateLimited
+		}
+	}
+	if perIP {
+		if a.perIP == nil {
+			a.perIP = make(map[string]int)
+		}
+		a.perIP[ip.String()]++
+	}
+	a.total++
+	return nil
+}
+
+func (a *Admission) release(addr net.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total--
+	if ip := addrIP(addr); ip != nil && a.perIP != nil {
+		if a.perIP[ip.String()]--; a.perIP[ip.String()] <= 0 {
+			delete(a.perIP, ip.String())
+		}
+	}
+}
+
+func (a *Admission) reject(conn net.Conn, err error) {
+	atomic.AddUint64(&a.rejected, 1)
+	if a.OnReject != nil {
+		a.OnReject(conn, err)
+	}
+}
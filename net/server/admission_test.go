@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1000}
+}
+
+func TestAccessList(t *testing.T) {
+	acl := NewAccessList()
+	assert.True(t, acl.Permit(net.ParseIP("10.0.0.1")))
+	assert.Nil(t, acl.Deny("10.0.0.0/24"))
+	assert.False(t, acl.Permit(net.ParseIP("10.0.0.1")))
+	assert.True(t, acl.Permit(net.ParseIP("10.0.1.1")))
+	assert.Nil(t, acl.Allow("10.0.0.0/8"))
+	assert.False(t, acl.Permit(net.ParseIP("192.168.0.1")))
+	assert.True(t, acl.Permit(net.ParseIP("10.0.1.1")))
+	assert.Nil(t, acl.SetDeny())
+	assert.True(t, acl.Permit(net.ParseIP("10.0.0.1")))
+	assert.Nil(t, acl.SetAllow())
+	assert.True(t, acl.Permit(net.ParseIP("192.168.0.1")))
+	assert.NotNil(t, acl.Allow("bad"))
+	assert.NotNil(t, acl.Deny("bad"))
+	assert.NotNil(t, acl.SetAllow("bad"))
+	assert.NotNil(t, acl.SetDeny("bad"))
+}
+
+func TestAdmission(t *testing.T) {
+	t.Run("test max connections", func(t *testing.T) {
+		a := &Admission{MaxConnections: 2, MaxConnectionsPerIP: 1}
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.1")))
+		assert.ErrorIs(t, a.admit(tcpAddr("10.0.0.1")), ErrTooManyConnectionsPerIP)
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.2")))
+		assert.ErrorIs(t, a.admit(tcpAddr("10.0.0.3")), ErrTooManyConnections)
+		assert.Equal(t, a.Connections(), 2)
+		a.release(tcpAddr("10.0.0.1"))
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.1")))
+		assert.Len(t, a.perIP, 2)
+		a.release(tcpAddr("10.0.0.1"))
+		a.release(tcpAddr("10.0.0.2"))
+		assert.Empty(t, a.perIP)
+		assert.Zero(t, a.Connections())
+	})
+	t.Run("test access list", func(t *testing.T) {
+		acl := NewAccessList()
+		a := &Admission{AccessList: acl}
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.1")))
+		acl.Deny("10.0.0.1/32")
+		assert.ErrorIs(t, a.admit(tcpAddr("10.0.0.1")), ErrAddressDenied)
+		assert.Nil(t, a.admit(&net.UnixAddr{Name: "sock", Net: "unix"}))
+	})
+	t.Run("test rate", func(t *testing.T) {
+		a := &Admission{Rate: 1, Burst: 2}
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.1")))
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.1")))
+		assert.ErrorIs(t, a.admit(tcpAddr("10.0.0.1")), ErrAcceptRateLimited)
+	})
+	t.Run("test rate not taken by rejected", func(t *testing.T) {
+		a := &Admission{Rate: 1, Burst: 2, MaxConnectionsPerIP: 1}
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.1")))
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, a.admit(tcpAddr("10.0.0.1")), ErrTooManyConnectionsPerIP)
+		}
+		assert.Nil(t, a.admit(tcpAddr("10.0.0.2")))
+	})
+}
+
+func TestNetServer_Admission(t *testing.T) {
+	var mu sync.Mutex
+	var reasons []error
+	admission := &Admission{MaxConnections: 1, OnReject: func(conn net.Conn, err error) {
+		mu.Lock()
+		reasons = append(reasons, err)
+		mu.Unlock()
+	}}
+	s := newTestServer()
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0", WithAdmission(admission))
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	defer func() {
+		s.Stop()
+		<-result
+	}()
+	c1, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer c1.Close()
+	c1.Write([]byte("hello"))
+	c1.Read(make([]byte, 5))
+	c2, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer c2.Close()
+	_, err = c2.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Equal(t, admission.Rejected(), uint64(1))
+	mu.Lock()
+	assert.Equal(t, reasons, []error{ErrTooManyConnections})
+	mu.Unlock()
+	handler.mu.Lock()
+	assert.Len(t, handler.remotes, 1)
+	handler.mu.Unlock()
+
+	c1.Close()
+	<-handler.disconnected
+	for i := 0; i < 100 && admission.Connections() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	c3, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer c3.Close()
+	c3.Write([]byte("hello"))
+	_, err = c3.Read(make([]byte, 5))
+	assert.Nil(t, err)
+}
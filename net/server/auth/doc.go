@@ -0,0 +1,7 @@
+// Package auth is a pluggable authentication handshake of net/server connections.
+// Middleware runs the handshake of a Mechanism right after the wrapped Handler OnConnected,
+// frames are exchanged with the Mechanism and never reach the wrapped Handler OnReceived until authenticated.
+// The authenticated identity is set to server.Connection, so it is added to Connection Logger fields.
+// Mechanisms are SharedToken, ChallengeResponse, SASL Plain (RFC 4616) and SASL SCRAM-SHA-256 (RFC 5802, RFC 7677),
+// each handshake message is a frame decoded by the server Codec.
+package auth
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// ErrHandshakeTimeout is reported to the wrapped Handler OnError when handshake not completed in Options Timeout
+var ErrHandshakeTimeout = fmt.Errorf("%w: handshake timeout", server.ErrUnauthenticated)
+
+// unauthenticatedError is the handshake failure wrapping the Mechanism error
+// It matches both server.ErrUnauthenticated and the Mechanism error by errors.Is.
+type unauthenticatedError struct {
+	err error
+}
+
+func (u *unauthenticatedError) Error() string {
+	return fmt.Sprintf("%v: %v", server.ErrUnauthenticated, u.err)
+}
+
+func (u *unauthenticatedError) Unwrap() error {
+	return u.err
+}
+
+func (u *unauthenticatedError) Is(target error) bool {
+	return target == server.ErrUnauthenticated
+}
+
+type authHandler struct {
+	server.Handler
+	mechanism Mechanism
+	options   Options
+	exchanges sync.Map
+}
+
+// Middleware will authenticate connections by mechanism before the wrapped Handler receiving frames
+// The handshake starts after the wrapped Handler OnConnected, frames are passed to the wrapped Handler
+// OnReceived only after authenticated, and the identity is set to the connection.
+// When handshake failed, the error wrapping server.ErrUnauthenticated reports to OnError and connection disconnected.
+func Middleware(mechanism Mechanism, opts ...Option) server.Middleware {
+	options := newOptions(opts...)
+	return func(handler server.Handler) server.Handler {
+		return &authHandler{Handler: handler, mechanism: mechanism, options: options}
+	}
+}
+
+func (a *authHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	action, err := a.Handler.OnConnected(conn)
+	if action != server.NothingAction || err != nil {
+		return action, err
+	}
+	exchange, challenge, err := a.mechanism.Start(conn)
+	if err != nil {
+		return server.DisconnectionAction, &unauthenticatedError{err: err}
+	}
+	a.exchanges.Store(conn, exchange)
+	if a.options.Timeout > 0 {
+		if err := conn.SetReadDeadline(a.options.Clock().Add(a.options.Timeout)); err != nil {
+			return server.DisconnectionAction, err
+		}
+	}
+	if challenge != nil {
+		return server.NothingAction, conn.Send(challenge, false)
+	}
+	return server.NothingAction, nil
+}
+
+func (a *authHandler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	a.exchanges.Delete(conn)
+	return a.Handler.OnDisconnected(conn, reason)
+}
+
+func (a *authHandler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	v, ok := a.exchanges.Load(conn)
+	if !ok {
+		return a.Handler.OnReceived(frame, conn)
+	}
+	reply, identity, err := v.(Exchange).Next(frame)
+	if err != nil {
+		a.fail(conn)
+		return server.DisconnectionAction, &unauthenticatedError{err: err}
+	}
+	if reply != nil {
+		if err := conn.Send(reply, false); err != nil {
+			return server.DisconnectionAction, err
+		}
+	}
+	if identity == "" {
+		return server.NothingAction, nil
+	}
+	a.exchanges.Delete(conn)
+	conn.SetIdentity(identity)
+	if a.options.Timeout > 0 {
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return server.DisconnectionAction, err
+		}
+	}
+	conn.Logger().DebugF("authenticated")
+	if a.options.Success != nil {
+		return server.NothingAction, conn.Send(a.options.Success, false)
+	}
+	return server.NothingAction, nil
+}
+
+// OnStream will pass streamed frames to the Exchange as whole frames before authenticated
+func (a *authHandler) OnStream(header []byte, body io.Reader, conn server.Connection) (server.Action, error) {
+	if _, ok := a.exchanges.Load(conn); ok {
+		return server.ReceiveStream(a.OnReceived, header, body, conn)
+	}
+	return server.ForwardStream(a.Handler, header, body, conn)
+}
+
+func (a *authHandler) OnError(conn server.Connection, err error) server.Action {
+	if _, ok := a.exchanges.Load(conn); ok && errors.Is(err, server.ErrReadDeadline) {
+		a.fail(conn)
+		a.Handler.OnError(conn, ErrHandshakeTimeout)
+		return server.DisconnectionAction
+	}
+	return a.Handler.OnError(conn, err)
+}
+
+// fail will send Options Failure frame before connection disconnected
+func (a *authHandler) fail(conn server.Connection) {
+	if a.options.Failure != nil {
+		_ = conn.Send(a.options.Failure, false)
+	}
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+type echoHandler struct {
+	connected bool
+	errs      []error
+	reasons   []*server.CloseReason
+}
+
+func (e *echoHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	e.connected = true
+	return server.NothingAction, nil
+}
+
+func (e *echoHandler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	e.reasons = append(e.reasons, reason)
+	return nil
+}
+
+func (e *echoHandler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	return server.NothingAction, conn.Send(append([]byte(conn.Identity()+":"), frame...), false)
+}
+
+func (e *echoHandler) OnError(conn server.Connection, err error) server.Action {
+	e.errs = append(e.errs, err)
+	return server.NothingAction
+}
+
+func newHarness(mechanism Mechanism, handler server.Handler, opts ...Option) *servertest.Harness {
+	return newHarnessWithLogger(mechanism, handler, logger.NewLogger(logger.WithWriter(io.Discard)), opts...)
+}
+
+func newHarnessWithLogger(mechanism Mechanism, handler server.Handler, l logger.Logger, opts ...Option) *servertest.Harness {
+	var h *servertest.Harness
+	opts = append([]Option{WithClock(func() time.Time { return h.Now() })}, opts...)
+	h = servertest.New(server.Chain(handler, Middleware(mechanism, opts...)), servertest.WithCodec(new(server.LengthFieldCodec)), servertest.WithLogger(l))
+	return h
+}
+
+func write(t *testing.T, conn *servertest.Conn, frame []byte) {
+	assert.Nil(t, conn.Write(new(server.LengthFieldCodec).Encode(frame)))
+}
+
+func TestMiddleware_SharedToken(t *testing.T) {
+	handler := new(echoHandler)
+	logs := new(bytes.Buffer)
+	h := newHarnessWithLogger(SharedToken(map[string]string{"alice": "secret-a", "bob": "secret-b"}), handler, logger.NewLogger(logger.WithWriter(logs), logger.WithLevel(logger.Debug)))
+
+	t.Run("test authenticated", func(t *testing.T) {
+		conn := h.Connect()
+		assert.True(t, handler.connected)
+		write(t, conn, []byte("secret-b"))
+		write(t, conn, []byte("hello"))
+		assert.Equal(t, conn.Identity(), "bob")
+		assert.Equal(t, conn.Frames(), [][]byte{[]byte("ok"), []byte("bob:hello")})
+		assert.False(t, conn.Disconnected())
+		assert.Contains(t, logs.String(), `"identity":"bob"`)
+	})
+
+	t.Run("test rejected", func(t *testing.T) {
+		conn := h.Connect()
+		write(t, conn, []byte("secret-c"))
+		assert.True(t, conn.Disconnected())
+		assert.Equal(t, conn.Frames(), [][]byte{[]byte("unauthorized")})
+		assert.Empty(t, conn.Identity())
+		assert.ErrorIs(t, conn.Errors()[0], server.ErrUnauthenticated)
+		assert.Equal(t, conn.Reason().Code, server.CloseHandler)
+	})
+}
+
+func TestMiddleware_Stream(t *testing.T) {
+	handler := new(echoHandler)
+	codec := &server.LengthFieldCodec{StreamThreshold: 1}
+	h := servertest.New(server.Chain(handler, Middleware(SharedToken(map[string]string{"alice": "secret-a"}))), servertest.WithCodec(codec), servertest.WithBufferCapacity(16))
+	conn := h.Connect()
+	// the streamed frames are passed to Exchange and the wrapped Handler as whole frames
+	assert.Nil(t, conn.Write(codec.Encode([]byte("secret-a"))))
+	assert.Nil(t, conn.Write(codec.Encode([]byte("hello"))))
+	assert.Equal(t, conn.Identity(), "alice")
+	assert.Equal(t, conn.Frames(), [][]byte{[]byte("ok"), []byte("alice:hello")})
+
+	// the handshake frames are not buffered beyond BufferCapacity
+	conn = h.Connect()
+	assert.Nil(t, conn.Write(codec.Encode(bytes.Repeat([]byte("x"), 32))))
+	assert.True(t, conn.Disconnected())
+	assert.ErrorIs(t, conn.Errors()[0], server.ErrFrameTooLarge)
+}
+
+func TestMiddleware_ChallengeResponse(t *testing.T) {
+	secrets := func(identity string) ([]byte, bool) {
+		if identity == "alice" {
+			return []byte("key"), true
+		}
+		return nil, false
+	}
+	h := newHarness(ChallengeResponse(secrets), new(echoHandler), WithSuccess(nil))
+
+	conn := h.Connect()
+	challenge := conn.Frames()[0]
+	assert.Len(t, challenge, ChallengeSize)
+	write(t, conn, append([]byte("alice\x00"), ChallengeResponseMAC([]byte("key"), challenge)...))
+	write(t, conn, []byte("hi"))
+	assert.Equal(t, conn.Frames()[1:], [][]byte{[]byte("alice:hi")})
+
+	other := h.Connect()
+	assert.False(t, bytes.Equal(other.Frames()[0], challenge))
+	write(t, other, append([]byte("alice\x00"), ChallengeResponseMAC([]byte("key"), challenge)...))
+	assert.True(t, other.Disconnected())
+	assert.ErrorIs(t, other.Errors()[0], ErrInvalidCredentials)
+
+	malformed := h.Connect()
+	write(t, malformed, []byte("alice"))
+	assert.ErrorIs(t, malformed.Errors()[0], ErrMalformedMessage)
+}
+
+func TestMiddleware_Plain(t *testing.T) {
+	h := newHarness(Plain(StaticPasswords(map[string]string{"alice": "pw"})), new(echoHandler))
+	tests := []struct {
+		frame    string
+		identity string
+		err      error
+	}{
+		{frame: "\x00alice\x00pw", identity: "alice"},
+		{frame: "alice\x00alice\x00pw", identity: "alice"},
+		{frame: "bob\x00alice\x00pw", err: ErrInvalidCredentials},
+		{frame: "\x00alice\x00wrong", err: ErrInvalidCredentials},
+		{frame: "\x00\x00pw", err: ErrMalformedMessage},
+		{frame: "alice\x00pw", err: ErrMalformedMessage},
+	}
+	for _, test := range tests {
+		conn := h.Connect()
+		write(t, conn, []byte(test.frame))
+		assert.Equal(t, conn.Identity(), test.identity)
+		if test.err != nil {
+			assert.ErrorIs(t, conn.Errors()[0], test.err)
+		} else {
+			assert.Empty(t, conn.Errors())
+		}
+	}
+}
+
+func TestMiddleware_Timeout(t *testing.T) {
+	handler := new(echoHandler)
+	h := newHarness(SharedToken(map[string]string{"alice": "token"}), handler, WithTimeout(time.Second))
+
+	conn := h.Connect()
+	h.Advance(time.Millisecond * 999)
+	assert.False(t, conn.Disconnected())
+	h.Advance(time.Millisecond)
+	assert.True(t, conn.Disconnected())
+	assert.Equal(t, conn.Reason().Code, server.CloseTimeout)
+	assert.Equal(t, handler.errs, []error{ErrHandshakeTimeout})
+	assert.ErrorIs(t, ErrHandshakeTimeout, server.ErrUnauthenticated)
+	assert.Equal(t, conn.Frames(), [][]byte{[]byte("unauthorized")})
+
+	conn = h.Connect()
+	write(t, conn, []byte("token"))
+	h.Advance(time.Minute)
+	assert.False(t, conn.Disconnected())
+}
+
+type rejectHandler struct {
+	echoHandler
+}
+
+func (r *rejectHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	return server.DisconnectionAction, errors.New("rejected")
+}
+
+func TestMiddleware_OnConnected(t *testing.T) {
+	h := newHarness(SharedToken(nil), new(rejectHandler))
+	conn := h.Connect()
+	assert.True(t, conn.Disconnected())
+	assert.EqualError(t, conn.Errors()[0], "rejected")
+	assert.Empty(t, conn.Frames())
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+var (
+	// ErrMalformedMessage will throw when a handshake message can not be parsed
+	ErrMalformedMessage = errors.New("malformed handshake message")
+	// ErrInvalidCredentials will throw when client credentials are not accepted
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Mechanism is an authentication mechanism of handshake
+type Mechanism interface {
+	// Start will begin the handshake of conn
+	// It returns the Exchange of the handshake and the first frame sent to client, nil sends nothing.
+	Start(conn server.Connection) (Exchange, []byte, error)
+}
+
+// Exchange is the handshake state of a connection
+// It is only called by the read loop of its connection.
+type Exchange interface {
+	// Next will handle a handshake frame from client
+	// It returns the frame sent back to client, nil sends nothing,
+	// and the authenticated identity when handshake completed, empty when more frames are required.
+	Next(frame []byte) (reply []byte, identity string, err error)
+}
+
+// ExchangeFunc is an Exchange of a function
+type ExchangeFunc func(frame []byte) ([]byte, string, error)
+
+func (f ExchangeFunc) Next(frame []byte) ([]byte, string, error) {
+	return f(frame)
+}
+
+// SharedToken will return Mechanism of a token frame sent by client
+// The tokens are keyed by identity, and compared in constant time.
+func SharedToken(tokens map[string]string) Mechanism {
+	return &sharedToken{tokens: tokens}
+}
+
+type sharedToken struct {
+	tokens map[string]string
+}
+
+func (s *sharedToken) Start(conn server.Connection) (Exchange, []byte, error) {
+	return ExchangeFunc(func(frame []byte) ([]byte, string, error) {
+		matched := ""
+		for identity, token := range s.tokens {
+			// all tokens are compared, so the time does not tell which matched
+			if subtle.ConstantTimeCompare(frame, []byte(token)) == 1 {
+				matched = identity
+			}
+		}
+		if matched == "" {
+			return nil, "", ErrInvalidCredentials
+		}
+		return nil, matched, nil
+	}), nil, nil
+}
+
+// ChallengeSize is the bytes length of ChallengeResponse challenge
+const ChallengeSize = 32
+
+// Secrets will return the secret of identity, false when no such identity
+type Secrets func(identity string) ([]byte, bool)
+
+// ChallengeResponse will return Mechanism proving client knows the secret of its identity
+// A random challenge is sent when connected, client replies identity, a zero byte
+// and HMAC-SHA256 of the challenge by secret, see ChallengeResponseMAC.
+func ChallengeResponse(secrets Secrets) Mechanism {
+	return &challengeResponse{secrets: secrets}
+}
+
+// ChallengeResponseMAC will return the MAC of challenge replied by client
+func ChallengeResponseMAC(secret, challenge []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
+
+type challengeResponse struct {
+	secrets Secrets
+}
+
+func (c *challengeResponse) Start(conn server.Connection) (Exchange, []byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, nil, err
+	}
+	return ExchangeFunc(func(frame []byte) ([]byte, string, error) {
+		i := bytes.IndexByte(frame, 0)
+		if i <= 0 {
+			return nil, "", ErrMalformedMessage
+		}
+		identity := string(frame[:i])
+		secret, ok := c.secrets(identity)
+		if !ok || !hmac.Equal(frame[i+1:], ChallengeResponseMAC(secret, challenge)) {
+			return nil, "", ErrInvalidCredentials
+		}
+		return nil, identity, nil
+	}), challenge, nil
+}
+
+// Passwords will check password of identity
+type Passwords func(identity, password string) bool
+
+// StaticPasswords will return Passwords of fixed identity and password pairs
+func StaticPasswords(passwords map[string]string) Passwords {
+	return func(identity, password string) bool {
+		p, ok := passwords[identity]
+		return ok && subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+	}
+}
+
+// Plain will return Mechanism of SASL PLAIN
+// Client sends authorization identity, authentication identity and password separated by zero bytes,
+// the authorization identity must be empty or same as the authentication identity.
+func Plain(passwords Passwords) Mechanism {
+	return &plain{passwords: passwords}
+}
+
+type plain struct {
+	passwords Passwords
+}
+
+func (p *plain) Start(conn server.Connection) (Exchange, []byte, error) {
+	return ExchangeFunc(func(frame []byte) ([]byte, string, error) {
+		parts := bytes.Split(frame, []byte{0})
+		if len(parts) != 3 || len(parts[1]) == 0 {
+			return nil, "", ErrMalformedMessage
+		}
+		authz, identity, password := string(parts[0]), string(parts[1]), string(parts[2])
+		if authz != "" && authz != identity {
+			return nil, "", ErrInvalidCredentials
+		}
+		if !p.passwords(identity, password) {
+			return nil, "", ErrInvalidCredentials
+		}
+		return nil, identity, nil
+	}), nil, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"time"
+)
+
+// Options defined Middleware options
+type Options struct {
+	// Timeout is the max time to complete handshake, zero means no timeout
+	Timeout time.Duration
+	// Success is the frame sent to client when authenticated, nil sends nothing
+	Success []byte
+	// Failure is the frame sent to client before disconnected when authentication failed, nil sends nothing
+	Failure []byte
+	// Clock is the current time of handshake deadline, default time.Now
+	Clock func() time.Time
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Timeout: 10 * time.Second,
+		Success: []byte("ok"),
+		Failure: []byte("unauthorized"),
+		Clock:   time.Now,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithTimeout is edit Options Timeout field
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+// WithSuccess is edit Options Success field
+func WithSuccess(frame []byte) Option {
+	return func(options *Options) {
+		options.Success = frame
+	}
+}
+
+// WithFailure is edit Options Failure field
+func WithFailure(frame []byte) Option {
+	return func(options *Options) {
+		options.Failure = frame
+	}
+}
+
+// WithClock is edit Options Clock field
+func WithClock(clock func() time.Time) Option {
+	return func(options *Options) {
+		options.Clock = clock
+	}
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// ErrChannelBindingNotSupported will throw when SCRAM client requires channel binding
+var ErrChannelBindingNotSupported = errors.New("scram channel binding not supported")
+
+// ScramCredentials is the stored credentials of a SCRAM-SHA-256 user, the password itself is not stored
+type ScramCredentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewScramCredentials will derive ScramCredentials of password
+func NewScramCredentials(password string, salt []byte, iterations int) ScramCredentials {
+	salted := pbkdf2([]byte(password), salt, iterations)
+	storedKey := sha256.Sum256(scramHMAC(salted, "Client Key"))
+	return ScramCredentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  scramHMAC(salted, "Server Key"),
+	}
+}
+
+// ScramLookup will return ScramCredentials of user, false when no such user
+type ScramLookup func(user string) (ScramCredentials, bool)
+
+// Scram will return Mechanism of SASL SCRAM-SHA-256 without channel binding
+// The handshake is client-first, server-first, client-final and server-final messages,
+// the server-final message is sent before the Options Success frame.
+func Scram(lookup ScramLookup) Mechanism {
+	return &scram{lookup: lookup}
+}
+
+type scram struct {
+	lookup ScramLookup
+}
+
+func (s *scram) Start(conn server.Connection) (Exchange, []byte, error) {
+	return &scramExchange{lookup: s.lookup}, nil, nil
+}
+
+type scramExchange struct {
+	lookup      ScramLookup
+	user        string
+	nonce       string
+	credentials ScramCredentials
+	authMessage string
+}
+
+func (s *scramExchange) Next(frame []byte) ([]byte, string, error) {
+	if s.nonce == "" {
+		return s.first(string(frame))
+	}
+	return s.final(string(frame))
+}
+
+func (s *scramExchange) first(msg string) ([]byte, string, error) {
+	if strings.HasPrefix(msg, "p=") {
+		return nil, "", ErrChannelBindingNotSupported
+	}
+	if !strings.HasPrefix(msg, "n,") && !strings.HasPrefix(msg, "y,") {
+		return nil, "", ErrMalformedMessage
+	}
+	parts := strings.SplitN(msg, ",", 3)
+	if len(parts) != 3 {
+		return nil, "", ErrMalformedMessage
+	}
+	bare := parts[2]
+	attrs := scramAttributes(bare)
+	user, ok := scramUnescape(attrs["n"])
+	if !ok || user == "" || attrs["r"] == "" {
+		return nil, "", ErrMalformedMessage
+	}
+	credentials, ok := s.lookup(user)
+	if !ok {
+		return nil, "", ErrInvalidCredentials
+	}
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	s.user = user
+	s.credentials = credentials
+	s.nonce = attrs["r"] + base64.RawStdEncoding.EncodeToString(nonce)
+	reply := "r=" + s.nonce + ",s=" + base64.StdEncoding.EncodeToString(credentials.Salt) + ",i=" + strconv.Itoa(credentials.Iterations)
+	s.authMessage = bare + "," + reply
+	return []byte(reply), "", nil
+}
+
+func (s *scramExchange) final(msg string) ([]byte, string, error) {
+	i := strings.LastIndex(msg, ",p=")
+	if i < 0 {
+		return nil, "", ErrMalformedMessage
+	}
+	withoutProof := msg[:i]
+	attrs := scramAttributes(withoutProof)
+	if attrs["c"] != "biws" && attrs["c"] != "eSws" {
+		return nil, "", ErrMalformedMessage
+	}
+	if attrs["r"] != s.nonce {
+		return nil, "", ErrInvalidCredentials
+	}
+	proof, err := base64.StdEncoding.DecodeString(msg[i+3:])
+	if err != nil || len(proof) != sha256.Size {
+		return nil, "", ErrMalformedMessage
+	}
+	authMessage := s.authMessage + "," + withoutProof
+	signature := scramHMAC(s.credentials.StoredKey, authMessage)
+	clientKey := make([]byte, sha256.Size)
+	for j := range clientKey {
+		clientKey[j] = proof[j] ^ signature[j]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if !hmac.Equal(storedKey[:], s.credentials.StoredKey) {
+		return nil, "", ErrInvalidCredentials
+	}
+	verifier := scramHMAC(s.credentials.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(verifier)), s.user, nil
+}
+
+// scramAttributes will parse comma separated key=value attributes
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) >= 2 && attr[1] == '=' {
+			attrs[attr[:1]] = attr[2:]
+		}
+	}
+	return attrs
+}
+
+// scramUnescape will decode =2C and =3D of saslname, false when other escapes found
+func scramUnescape(name string) (string, bool) {
+	unescaped := strings.NewReplacer("=2C", ",", "=3D", "=").Replace(name)
+	if strings.Count(name, "=") != strings.Count(name, "=2C")+strings.Count(name, "=3D") {
+		return "", false
+	}
+	return unescaped, true
+}
+
+func scramHMAC(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// pbkdf2 is PBKDF2-HMAC-SHA256 of one block, which is the SCRAM-SHA-256 Hi function
+func pbkdf2(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	var block [4]byte
+	binary.BigEndian.PutUint32(block[:], 1)
+	mac.Write(salt)
+	mac.Write(block[:])
+	u := mac.Sum(nil)
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+func TestPbkdf2(t *testing.T) {
+	// RFC 7914 section 11 test vector
+	assert.Equal(t, hex.EncodeToString(pbkdf2([]byte("passwd"), []byte("salt"), 1)), "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc")
+}
+
+// scramClient is the client side of SCRAM-SHA-256 handshake
+type scramClient struct {
+	user, password, nonce string
+	clientFirstBare       string
+	serverSignature       []byte
+}
+
+func (s *scramClient) first() []byte {
+	s.clientFirstBare = "n=" + strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s.user) + ",r=" + s.nonce
+	return []byte("n,," + s.clientFirstBare)
+}
+
+func (s *scramClient) final(serverFirst []byte) []byte {
+	attrs := scramAttributes(string(serverFirst))
+	salt, _ := base64.StdEncoding.DecodeString(attrs["s"])
+	iterations, _ := strconv.Atoi(attrs["i"])
+	salted := pbkdf2([]byte(s.password), salt, iterations)
+	clientKey := scramHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + attrs["r"]
+	authMessage := s.clientFirstBare + "," + string(serverFirst) + "," + withoutProof
+	signature := scramHMAC(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range proof {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	s.serverSignature = scramHMAC(scramHMAC(salted, "Server Key"), authMessage)
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof))
+}
+
+func TestMiddleware_Scram(t *testing.T) {
+	users := map[string]ScramCredentials{
+		"user,1": NewScramCredentials("pencil", []byte("salt-of-user"), 4096),
+	}
+	lookup := func(user string) (ScramCredentials, bool) {
+		c, ok := users[user]
+		return c, ok
+	}
+	h := newHarness(Scram(lookup), new(echoHandler))
+
+	t.Run("test authenticated", func(t *testing.T) {
+		client := &scramClient{user: "user,1", password: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO"}
+		conn := h.Connect()
+		write(t, conn, client.first())
+		serverFirst := conn.Frames()[0]
+		assert.True(t, strings.HasPrefix(string(serverFirst), "r="+client.nonce))
+		assert.Contains(t, string(serverFirst), ",i=4096")
+		write(t, conn, client.final(serverFirst))
+		frames := conn.Frames()
+		assert.Equal(t, string(frames[1]), "v="+base64.StdEncoding.EncodeToString(client.serverSignature))
+		assert.Equal(t, string(frames[2]), "ok")
+		assert.Equal(t, conn.Identity(), "user,1")
+	})
+
+	t.Run("test wrong password", func(t *testing.T) {
+		client := &scramClient{user: "user,1", password: "pen", nonce: "abc"}
+		conn := h.Connect()
+		write(t, conn, client.first())
+		write(t, conn, client.final(conn.Frames()[0]))
+		assert.True(t, conn.Disconnected())
+		assert.ErrorIs(t, conn.Errors()[0], ErrInvalidCredentials)
+	})
+
+	t.Run("test nonce mismatch", func(t *testing.T) {
+		client := &scramClient{user: "user,1", password: "pencil", nonce: "abc"}
+		conn := h.Connect()
+		write(t, conn, client.first())
+		final := client.final(conn.Frames()[0])
+		write(t, conn, []byte(strings.Replace(string(final), "r=abc", "r=abd", 1)))
+		assert.ErrorIs(t, conn.Errors()[0], ErrInvalidCredentials)
+	})
+
+	t.Run("test rejected first message", func(t *testing.T) {
+		tests := map[string]error{
+			"p=tls-unique,,n=user,r=abc": ErrChannelBindingNotSupported,
+			"n,,n=nobody,r=abc":          ErrInvalidCredentials,
+			"n,,n=us=3Xer,r=abc":         ErrMalformedMessage,
+			"n,,n=user":                  ErrMalformedMessage,
+			"x":                          ErrMalformedMessage,
+		}
+		for msg, err := range tests {
+			conn := h.Connect()
+			write(t, conn, []byte(msg))
+			assert.True(t, conn.Disconnected())
+			assert.ErrorIs(t, conn.Errors()[0], err, msg)
+			assert.ErrorIs(t, conn.Errors()[0], server.ErrUnauthenticated)
+		}
+	})
+}
+
+func TestNewScramCredentials(t *testing.T) {
+	c := NewScramCredentials("pencil", []byte("salt"), 2)
+	salted := pbkdf2([]byte("pencil"), []byte("salt"), 2)
+	mac := hmac.New(sha256.New, salted)
+	mac.Write([]byte("Client Key"))
+	storedKey := sha256.Sum256(mac.Sum(nil))
+	assert.Equal(t, c.StoredKey, storedKey[:])
+	assert.Equal(t, c.Iterations, 2)
+	assert.Len(t, c.ServerKey, sha256.Size)
+}
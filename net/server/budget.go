@@ -0,0 +1,194 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// memoryBudget is the bytes budget shared by read buffers and queued data of all connections
+// Usage is counted without limit when limit is zero.
+// When usage exceeds limit, idle connections release read buffers to the pool,
+// and the heaviest connections stop reading until usage falls to limit.
+// It is safe for concurrent use.
+type memoryBudget struct {
+	limit int64
+	// counters are accessed atomically
+	used      int64
+	peak      int64
+	throttles uint64
+	releases  uint64
+
+	mu sync.Mutex
+	// conns is connections in read loop, only they can be throttled or released
+	conns     map[*netConnection]struct{}
+	throttled map[*netConnection]struct{}
+	// freed is closed and replaced when bytes released while connections waiting for buffers
+	freed   chan struct{}
+	waiters int
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{
+		limit:     limit,
+		conns:     make(map[*netConnection]struct{}),
+		throttled: make(map[*netConnection]struct{}),
+		freed:     make(chan struct{}),
+	}
+}
+
+// charge will count n bytes used by c, it returns whether usage exceeds limit
+// It never blocks, the caller should reclaim when exceeded without holding connection mu.
+func (b *memoryBudget) charge(c *netConnection, n int64) bool {
+	if n <= 0 {
+		return false
+	}
+	atomic.AddInt64(&c.memory, n)
+	used := atomic.AddInt64(&b.used, n)
+	for peak := atomic.LoadInt64(&b.peak); used > peak; peak = atomic.LoadInt64(&b.peak) {
+		if atomic.CompareAndSwapInt64(&b.peak, peak, used) {
+			break
+		}
+	}
+	return b.limit > 0 && used > b.limit
+}
+
+// release will count n bytes of c freed, and resume throttled connections when usage falls to limit
+func (b *memoryBudget) release(c *netConnection, n int64) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddInt64(&c.memory, -n)
+	used := atomic.AddInt64(&b.used, -n)
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.waiters > 0 {
+		close(b.freed)
+		b.freed = make(chan struct{})
+	}
+	if used > b.limit || len(b.throttled) == 0 {
+		return
+	}
+	for throttled := range b.throttled {
+		throttled.setThrottled(false)
+	}
+	b.throttled = make(map[*netConnection]struct{})
+}
+
+// acquire will charge n bytes of c when it fits in limit, or nothing else is charged
+// It blocks until bytes released or connection closing, and returns false when closing.
+func (b *memoryBudget) acquire(c *netConnection, n int64) bool {
+	for {
+		b.mu.Lock()
+		used := atomic.LoadInt64(&b.used)
+		if b.limit <= 0 || used == 0 || used+n <= b.limit {
+			b.mu.Unlock()
+			if b.charge(c, n) {
+				b.reclaim(0)
+			}
+			return true
+		}
+		b.waiters++
+		freed := b.freed
+		b.mu.Unlock()
+		// make room from idle and heaviest connections, freed is closed by their release
+		b.reclaim(n)
+		select {
+		case <-freed:
+		case <-c.closing:
+		}
+		b.mu.Lock()
+		b.waiters--
+		b.mu.Unlock()
+		if c.Closed() {
+			return false
+		}
+	}
+}
+
+// reclaim will release buffers of idle connections, then throttle the heaviest connections
+// until the bytes they hold cover the usage and need bytes exceeded limit.
+func (b *memoryBudget) reclaim(need int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	excess := atomic.LoadInt64(&b.used) + need - b.limit
+	var candidates []*netConnection
+	for c := range b.conns {
+		if _, ok := b.throttled[c]; ok {
+			excess -= atomic.LoadInt64(&c.memory)
+		} else if size, ok := c.requestRelease(); ok {
+			excess -= size
+		} else {
+			candidates = append(candidates, c)
+		}
+	}
+	if excess <= 0 {
+		return
+	}
+	memory := make(map[*netConnection]int64, len(candidates))
+	for _, c := range candidates {
+		memory[c] = atomic.LoadInt64(&c.memory)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return memory[candidates[i]] > memory[candidates[j]]
+	})
+	for _, c := range candidates {
+		if excess <= 0 {
+			break
+		}
+		b.throttled[c] = struct{}{}
+		c.setThrottled(true)
+		atomic.AddUint64(&b.throttles, 1)
+		c.Logger().DebugF("connection reading throttled by memory budget")
+		excess -= memory[c]
+	}
+}
+
+// add will make c can be throttled or released, it is called when read loop started
+func (b *memoryBudget) add(c *netConnection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.conns[c] = struct{}{}
+}
+
+// remove will release all bytes held by c
+func (b *memoryBudget) remove(c *netConnection) {
+	b.mu.Lock()
+	delete(b.conns, c)
+	delete(b.throttled, c)
+	b.mu.Unlock()
+	b.release(c, atomic.LoadInt64(&c.memory))
+}
+
+// MemoryStats is statistics snapshot of memory budget of connection buffers
+type MemoryStats struct {
+	// Budget is the Options MemoryBudget, zero means unlimited
+	Budget int64 `json:"budget"`
+	// Used is the bytes of read buffers and queued data of all connections
+	Used int64 `json:"used"`
+	// Peak is the max Used since server created
+	Peak int64 `json:"peak"`
+	// Throttled is the count of connections not reading because budget exhausted
+	Throttled int `json:"throttled"`
+	// Throttles is the count of connections throttled
+	Throttles uint64 `json:"throttles"`
+	// Releases is the count of idle connections released read buffers to the pool
+	Releases uint64 `json:"releases"`
+}
+
+func (b *memoryBudget) snapshot() MemoryStats {
+	b.mu.Lock()
+	throttled := len(b.throttled)
+	b.mu.Unlock()
+	return MemoryStats{
+		Budget:    b.limit,
+		Used:      atomic.LoadInt64(&b.used),
+		Peak:      atomic.LoadInt64(&b.peak),
+		Throttled: throttled,
+		Throttles: atomic.LoadUint64(&b.throttles),
+		Releases:  atomic.LoadUint64(&b.releases),
+	}
+}
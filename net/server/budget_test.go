@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPipeConnection(t *testing.T, s *netServer, l *listener) *netConnection {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	c := newNetConnection(s, l, server)
+	c.initBuffers()
+	return c
+}
+
+func TestMemoryBudget(t *testing.T) {
+	s := newTestServer(WithBufferCapacity(16), WithMemoryBudget(100))
+	l := newListener(NewAddress("tcp", "127.0.0.1:0"), newEchoHandler())
+	a, b := newPipeConnection(t, s, l), newPipeConnection(t, s, l)
+	s.budget.add(a)
+	s.budget.add(b)
+	// read buffer and scratch of each connection
+	assert.Equal(t, s.budget.snapshot().Used, int64(64))
+
+	// the heaviest connection is throttled
+	assert.Nil(t, a.Send(bytes.Repeat([]byte{1}, 50), true))
+	assert.True(t, a.shouldRelease())
+	assert.False(t, b.shouldRelease())
+	assert.Equal(t, s.budget.snapshot(), MemoryStats{Budget: 100, Used: 114, Peak: 114, Throttled: 1, Throttles: 1})
+	assert.Equal(t, a.snapshot(time.Now()).Memory, int64(82))
+	s.budget.release(a, 50)
+	assert.False(t, a.shouldRelease())
+	assert.Equal(t, s.budget.snapshot().Throttled, 0)
+
+	// idle connection is requested to release buffers instead
+	b.setIdle(true, false)
+	assert.Nil(t, a.Send(bytes.Repeat([]byte{1}, 60), true))
+	assert.True(t, b.shouldRelease())
+	assert.False(t, a.shouldRelease())
+	b.releaseBuffers()
+	assert.Nil(t, b.buf)
+	assert.Equal(t, s.budget.snapshot().Used, int64(92))
+	assert.Equal(t, s.budget.snapshot().Releases, uint64(1))
+	b.setIdle(false, false)
+
+	// buffers are acquired after bytes released
+	acquired := make(chan bool, 1)
+	go func() {
+		acquired <- b.acquireBuffers()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired buffers exceeding budget")
+	case <-time.After(time.Millisecond * 20):
+	}
+	s.budget.release(a, 60)
+	assert.True(t, <-acquired)
+	assert.NotNil(t, b.buf)
+	assert.Equal(t, s.budget.snapshot().Used, int64(64))
+
+	a.free()
+	b.free()
+	assert.Equal(t, s.budget.snapshot().Used, int64(0))
+	assert.Equal(t, s.budget.snapshot().Peak, int64(124))
+
+	t.Run("test acquire closing", func(t *testing.T) {
+		c, d := newPipeConnection(t, s, l), newPipeConnection(t, s, l)
+		s.budget.add(c)
+		c.releaseBuffers()
+		s.budget.charge(d, 70)
+		go c.close(NewCloseReason(CloseServerStop, nil))
+		assert.False(t, c.acquireBuffers())
+		c.free()
+		d.free()
+		assert.Equal(t, s.budget.snapshot().Used, int64(0))
+	})
+}
+
+func TestNetServer_MemoryBudgetRejected(t *testing.T) {
+	s := newTestServer(WithBufferCapacity(64), WithMemoryBudget(256))
+	acl := NewAccessList()
+	assert.Nil(t, acl.Deny("127.0.0.1/32"))
+	address := NewAddress("tcp", "127.0.0.1:0", WithAdmission(&Admission{AccessList: acl}))
+	assert.Nil(t, s.Bind(address, newEchoHandler()))
+	listening, result := startServer(t, s, address)
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	// the rejected connection never takes buffers
+	assert.Equal(t, s.Stats().Memory.Peak, int64(0))
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_MemoryBudget(t *testing.T) {
+	// each connection holds 128 bytes buffers, so only two connections can hold buffers at once
+	s := newTestServer(WithCodec(new(LengthFieldCodec)), WithBufferCapacity(64), WithMemoryBudget(256))
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	codec := new(LengthFieldCodec)
+
+	var conns []net.Conn
+	for i := 0; i < 4; i++ {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	waitFor(t, func() bool {
+		return len(s.Connections()) == 4
+	})
+	waitFor(t, func() bool {
+		return s.Stats().Memory.Used <= 256
+	})
+	for round := 0; round < 3; round++ {
+		for i, conn := range conns {
+			frame := strings.Repeat(string(rune('a'+i)), 10+round)
+			_, err := conn.Write(codec.Encode([]byte(frame)))
+			assert.Nil(t, err)
+			assert.Equal(t, readFrame(t, conn), frame)
+		}
+	}
+	stats := s.Stats().Memory
+	assert.Equal(t, stats.Budget, int64(256))
+	assert.Greater(t, stats.Releases, uint64(0))
+	waitFor(t, func() bool {
+		return s.Stats().Memory.Used <= 256
+	})
+
+	out := new(bytes.Buffer)
+	assert.Nil(t, s.WritePrometheus(out))
+	assert.Contains(t, out.String(), "# TYPE server_memory_used_bytes gauge\n")
+	assert.Contains(t, out.String(), "server_memory_budget_bytes 256\n")
+
+	for _, conn := range conns {
+		conn.Close()
+		<-handler.disconnected
+	}
+	// buffers are released after OnDisconnected
+	waitFor(t, func() bool {
+		return s.Stats().Memory.Used == 0
+	})
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
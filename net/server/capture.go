@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrCaptureClosed will return by Capture Err after Capture closed
+var ErrCaptureClosed = errors.New("capture closed")
+
+// CaptureKind is the kind of CaptureRecord
+type CaptureKind string
+
+const (
+	CaptureConnect    CaptureKind = "connect"    // connection accepted
+	CaptureDisconnect CaptureKind = "disconnect" // connection closed
+	CaptureRead       CaptureKind = "read"       // raw bytes received from client
+	CaptureWrite      CaptureKind = "write"      // raw bytes written to client
+	CaptureReceive    CaptureKind = "receive"    // frame decoded by Codec
+	CaptureSend       CaptureKind = "send"       // frame sent by Handler before encoded
+)
+
+// CaptureRecord is a traffic event of a connection
+type CaptureRecord struct {
+	Time   time.Time   `json:"time"`
+	ConnID uint64      `json:"conn_id"`
+	Remote string      `json:"remote"`
+	Kind   CaptureKind `json:"kind"`
+	Data   []byte      `json:"data,omitempty"`
+	// Raw is whether the sent frame is not encoded by Codec
+	Raw bool `json:"raw,omitempty"`
+}
+
+// CaptureFilter decides which connections are captured
+// A connection is captured when its remote IP in any of CIDRs or its ID in IDs,
+// a filter without CIDRs and IDs captures all connections.
+type CaptureFilter struct {
+	CIDRs []*net.IPNet
+	IDs   []uint64
+}
+
+func (f *CaptureFilter) match(id uint64, addr net.Addr) bool {
+	if len(f.CIDRs) == 0 && len(f.IDs) == 0 {
+		return true
+	}
+	for _, i := range f.IDs {
+		if i == id {
+			return true
+		}
+	}
+	if ip := addrIP(addr); ip != nil {
+		for _, cidr := range f.CIDRs {
+			if cidr.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Capture will write traffic of connections matched by filter as JSON lines of CaptureRecord
+// It captures nothing until SetFilter, and the filter can be switched at any time.
+// It is safe for concurrent use.
+type Capture struct {
+	mu     sync.Mutex
+	w      io.Writer
+	enc    *json.Encoder
+	err    error
+	filter *CaptureFilter
+}
+
+// NewCapture will create Capture writing to w
+func NewCapture(w io.Writer) *Capture {
+	return &Capture{w: w, enc: json.NewEncoder(w)}
+}
+
+// NewCaptureFile will create Capture appending to file of path
+func NewCaptureFile(path string) (*Capture, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewCapture(f), nil
+}
+
+// SetFilter will switch captured connections, nil stops capturing
+func (c *Capture) SetFilter(filter *CaptureFilter) {
+	c.mu.Lock()
+	c.filter = filter
+	c.mu.Unlock()
+}
+
+// Err will return the first error of writing records
+// Capture stops writing after an error.
+func (c *Capture) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close will stop capturing and close the writer when it is an io.Closer
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filter = nil
+	if c.err == nil {
+		c.err = ErrCaptureClosed
+	}
+	if closer, ok := c.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// record will write a CaptureRecord of conn when filter matched
+// It is no-op on nil Capture.
+func (c *Capture) record(conn *netConnection, kind CaptureKind, data []byte, raw bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filter == nil || c.err != nil || !c.filter.match(conn.id, conn.addr) {
+		return
+	}
+	c.err = c.enc.Encode(CaptureRecord{
+		Time:   time.Now(),
+		ConnID: conn.id,
+		Remote: conn.remote,
+		Kind:   kind,
+		Data:   data,
+		Raw:    raw,
+	})
+}
+
+// ReadCapture will read all CaptureRecord written by Capture
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+	dec := json.NewDecoder(r)
+	for {
+		var record CaptureRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
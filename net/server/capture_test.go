@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureFilter_match(t *testing.T) {
+	cidrs, err := ParseCIDRs("10.0.0.0/8")
+	assert.Nil(t, err)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 80}
+	other := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 80}
+	assert.True(t, new(CaptureFilter).match(1, other))
+	filter := &CaptureFilter{CIDRs: cidrs, IDs: []uint64{7}}
+	assert.True(t, filter.match(1, addr))
+	assert.True(t, filter.match(7, other))
+	assert.False(t, filter.match(1, other))
+}
+
+func TestNetServer_Capture(t *testing.T) {
+	out := new(bytes.Buffer)
+	capture := NewCapture(out)
+	s := newTestServer(WithCodec(new(LengthFieldCodec)), WithCapture(capture))
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	codec := new(LengthFieldCodec)
+
+	echo := func(data string) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		conn.Write(codec.Encode([]byte(data)))
+		assert.Equal(t, readFrame(t, conn), data)
+		conn.Close()
+		<-handler.disconnected
+	}
+	// not captured without filter
+	echo("a")
+	cidrs, _ := ParseCIDRs("127.0.0.0/8")
+	capture.SetFilter(&CaptureFilter{CIDRs: cidrs})
+	echo("hello")
+	capture.SetFilter(&CaptureFilter{IDs: []uint64{1}})
+	echo("b")
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+	assert.Nil(t, capture.Err())
+	assert.Nil(t, capture.Close())
+	assert.ErrorIs(t, capture.Err(), ErrCaptureClosed)
+
+	records, err := ReadCapture(out)
+	assert.Nil(t, err)
+	var kinds []CaptureKind
+	for _, record := range records {
+		kinds = append(kinds, record.Kind)
+		assert.Equal(t, record.ConnID, uint64(2))
+		assert.False(t, record.Time.IsZero())
+	}
+	assert.Equal(t, kinds, []CaptureKind{CaptureConnect, CaptureRead, CaptureReceive, CaptureSend, CaptureWrite, CaptureDisconnect})
+	assert.Equal(t, records[1].Data, codec.Encode([]byte("hello")))
+	assert.Equal(t, records[2].Data, []byte("hello"))
+	assert.Equal(t, records[3].Data, []byte("hello"))
+	assert.Equal(t, records[4].Data, codec.Encode([]byte("hello")))
+}
@@ -0,0 +1,212 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// ErrInjectedDisconnect will throw when a read or write is failed by injected disconnect
+var ErrInjectedDisconnect = errors.New("chaos injected disconnect")
+
+// Stats is the count of injected faults
+type Stats struct {
+	Conns         uint64 `json:"conns"`
+	Disconnects   uint64 `json:"disconnects"`
+	PartialWrites uint64 `json:"partial_writes"`
+	Corruptions   uint64 `json:"corruptions"`
+}
+
+// Injector will wrap connections to inject faults of Options
+// It is safe for concurrent use.
+type Injector struct {
+	opts Options
+	// counters are accessed atomically
+	conns         uint64
+	disconnects   uint64
+	partialWrites uint64
+	corruptions   uint64
+}
+
+// New will create Injector
+func New(opts ...Option) *Injector {
+	return &Injector{opts: newOptions(opts...)}
+}
+
+// Wrap will return conn injecting faults
+// The RNG of each direction is seeded by Options Seed and the order conn wrapped.
+func (i *Injector) Wrap(conn net.Conn) net.Conn {
+	n := int64(atomic.AddUint64(&i.conns, 1))
+	return &faultConn{
+		Conn:     conn,
+		injector: i,
+		read:     direction{rng: rand.New(rand.NewSource(i.opts.Seed + n*2))},
+		write:    direction{rng: rand.New(rand.NewSource(i.opts.Seed + n*2 + 1))},
+	}
+}
+
+// Listener will return ln wrapping accepted connections
+func (i *Injector) Listener(ln net.Listener) net.Listener {
+	return &faultListener{Listener: ln, injector: i}
+}
+
+// Dial will connect address and wrap the connection
+func (i *Injector) Dial(network, address string) (net.Conn, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return i.Wrap(conn), nil
+}
+
+// Stats will return the count of injected faults
+func (i *Injector) Stats() Stats {
+	return Stats{
+		Conns:         atomic.LoadUint64(&i.conns),
+		Disconnects:   atomic.LoadUint64(&i.disconnects),
+		PartialWrites: atomic.LoadUint64(&i.partialWrites),
+		Corruptions:   atomic.LoadUint64(&i.corruptions),
+	}
+}
+
+type faultListener struct {
+	net.Listener
+	injector *Injector
+}
+
+func (l *faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.injector.Wrap(conn), nil
+}
+
+// direction is the fault state of reading or writing
+type direction struct {
+	// mu serializes calls of the direction, so faults are chosen in call order
+	mu  sync.Mutex
+	rng *rand.Rand
+	// split is the index of next SplitPattern size
+	split int
+}
+
+// chance will return true in probability rate, the RNG is not used when rate is zero
+func (d *direction) chance(rate float64) bool {
+	return rate > 0 && d.rng.Float64() < rate
+}
+
+// limit will return b truncated by next SplitPattern size
+func (d *direction) limit(b []byte, pattern []int) []byte {
+	if len(pattern) == 0 {
+		return b
+	}
+	size := pattern[d.split%len(pattern)]
+	d.split++
+	if size > 0 && size < len(b) {
+		return b[:size]
+	}
+	return b
+}
+
+type faultConn struct {
+	net.Conn
+	injector *Injector
+	read     direction
+	write    direction
+}
+
+func (c *faultConn) Read(b []byte) (int, error) {
+	d, opts := &c.read, &c.injector.opts
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.chance(opts.DisconnectRate) {
+		return 0, c.disconnect()
+	}
+	n, err := c.Conn.Read(d.limit(b, opts.SplitPattern))
+	if n > 0 {
+		if d.chance(opts.CorruptRate) {
+			c.corrupt(d, b[:n])
+		}
+		c.delay(d, n)
+	}
+	return n, err
+}
+
+func (c *faultConn) Write(b []byte) (int, error) {
+	d, opts := &c.write, &c.injector.opts
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	written := 0
+	for len(b) > 0 {
+		if d.chance(opts.DisconnectRate) {
+			return written, c.disconnect()
+		}
+		chunk := d.limit(b, opts.SplitPattern)
+		partial := d.chance(opts.PartialWriteRate)
+		if partial {
+			chunk = chunk[:d.rng.Intn(len(chunk))]
+			atomic.AddUint64(&c.injector.partialWrites, 1)
+		}
+		data := chunk
+		if d.chance(opts.CorruptRate) {
+			// the caller bytes are not changed
+			data = append([]byte{}, chunk...)
+			c.corrupt(d, data)
+		}
+		c.delay(d, len(data))
+		n, err := c.Conn.Write(data)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if partial {
+			return written, io.ErrShortWrite
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+func (c *faultConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return server.ErrCloseWriteNotSupported
+}
+
+func (c *faultConn) disconnect() error {
+	atomic.AddUint64(&c.injector.disconnects, 1)
+	c.Conn.Close()
+	return ErrInjectedDisconnect
+}
+
+// corrupt will flip a random bit of b
+func (c *faultConn) corrupt(d *direction, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	atomic.AddUint64(&c.injector.corruptions, 1)
+	b[d.rng.Intn(len(b))] ^= 1 << uint(d.rng.Intn(8))
+}
+
+// delay will sleep the latency and the time of n bytes transferred by bandwidth
+func (c *faultConn) delay(d *direction, n int) {
+	opts := &c.injector.opts
+	delay := opts.Latency
+	if opts.Jitter > 0 {
+		delay += time.Duration(d.rng.Int63n(int64(opts.Jitter) + 1))
+	}
+	if opts.Bandwidth > 0 {
+		delay += time.Duration(n) * time.Second / time.Duration(opts.Bandwidth)
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,185 @@
+package chaos
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// memConn is net.Conn reading from r and recording each write
+type memConn struct {
+	net.Conn
+	r      io.Reader
+	writes [][]byte
+	closed bool
+}
+
+func (m *memConn) Read(b []byte) (int, error) {
+	return m.r.Read(b)
+}
+
+func (m *memConn) Write(b []byte) (int, error) {
+	m.writes = append(m.writes, append([]byte{}, b...))
+	return len(b), nil
+}
+
+func (m *memConn) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *memConn) written() []byte {
+	return bytes.Join(m.writes, nil)
+}
+
+func TestInjector_Split(t *testing.T) {
+	i := New(WithSplitPattern(1, 3))
+	mem := &memConn{r: bytes.NewReader([]byte("0123456789"))}
+	conn := i.Wrap(mem)
+
+	n, err := conn.Write([]byte("abcdefghi"))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 9)
+	assert.Equal(t, mem.writes, [][]byte{[]byte("a"), []byte("bcd"), []byte("e"), []byte("fgh"), []byte("i")})
+
+	var reads []string
+	b := make([]byte, 8)
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			break
+		}
+		reads = append(reads, string(b[:n]))
+	}
+	assert.Equal(t, reads, []string{"0", "123", "4", "567", "8", "9"})
+}
+
+func TestInjector_Deterministic(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	run := func(seed int64) ([]byte, [][]byte) {
+		i := New(WithSeed(seed), WithCorruptRate(0.5), WithSplitPattern(7))
+		var out [][]byte
+		for c := 0; c < 2; c++ {
+			mem := &memConn{r: bytes.NewReader(nil)}
+			_, err := i.Wrap(mem).Write(data)
+			assert.Nil(t, err)
+			out = append(out, mem.written())
+		}
+		assert.Greater(t, i.Stats().Corruptions, uint64(0))
+		return data, out
+	}
+	original, first := run(42)
+	_, second := run(42)
+	_, other := run(43)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+	// each connection has its own RNG, and the caller bytes are not changed
+	assert.NotEqual(t, first[0], first[1])
+	assert.NotEqual(t, first[0], original)
+	assert.Equal(t, original, bytes.Repeat([]byte("0123456789"), 100))
+}
+
+func TestInjector_Faults(t *testing.T) {
+	t.Run("test disconnect", func(t *testing.T) {
+		i := New(WithDisconnectRate(1))
+		mem := &memConn{r: bytes.NewReader([]byte("x"))}
+		conn := i.Wrap(mem)
+		_, err := conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, ErrInjectedDisconnect)
+		assert.True(t, mem.closed)
+		n, err := conn.Write([]byte("x"))
+		assert.ErrorIs(t, err, ErrInjectedDisconnect)
+		assert.Equal(t, n, 0)
+		assert.Equal(t, i.Stats().Disconnects, uint64(2))
+	})
+
+	t.Run("test partial write", func(t *testing.T) {
+		i := New(WithPartialWriteRate(1), WithSeed(1))
+		mem := &memConn{}
+		n, err := i.Wrap(mem).Write([]byte("hello world"))
+		assert.ErrorIs(t, err, io.ErrShortWrite)
+		assert.Less(t, n, 11)
+		assert.Equal(t, mem.written(), []byte("hello world")[:n])
+		assert.Equal(t, i.Stats(), Stats{Conns: 1, PartialWrites: 1})
+	})
+
+	t.Run("test latency and bandwidth", func(t *testing.T) {
+		i := New(WithLatency(time.Millisecond*10, time.Millisecond), WithBandwidth(1000))
+		start := time.Now()
+		_, err := i.Wrap(&memConn{}).Write(make([]byte, 20))
+		assert.Nil(t, err)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*30))
+	})
+
+	t.Run("test close write", func(t *testing.T) {
+		conn := New().Wrap(&memConn{})
+		assert.ErrorIs(t, conn.(interface{ CloseWrite() error }).CloseWrite(), server.ErrCloseWriteNotSupported)
+	})
+}
+
+type echoHandler struct {
+	disconnected chan struct{}
+}
+
+func (e *echoHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	return server.NothingAction, nil
+}
+
+func (e *echoHandler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	e.disconnected <- struct{}{}
+	return nil
+}
+
+func (e *echoHandler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	return server.NothingAction, conn.Send(frame, false)
+}
+
+func (e *echoHandler) OnError(conn server.Connection, err error) server.Action {
+	return server.NothingAction
+}
+
+func TestInjector_Address(t *testing.T) {
+	injector := New(WithSeed(7), WithSplitPattern(1, 2, 5))
+	path := filepath.Join(t.TempDir(), "chaos.sock")
+	address := server.NewAddress("unix", path, server.WithWrapConn(injector.Wrap))
+	codec := new(server.LengthFieldCodec)
+	s := server.NewServer(server.WithCodec(codec), server.WithLogger(logger.NewLogger(logger.WithWriter(io.Discard))))
+	handler := &echoHandler{disconnected: make(chan struct{}, 1)}
+	assert.Nil(t, s.Bind(address, handler))
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Start()
+	}()
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = injector.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if !assert.Nil(t, err) {
+		return
+	}
+	// frames are split to pieces of 1, 2 and 5 bytes by both sides
+	frame := codec.Encode([]byte("hello chaos"))
+	_, err = conn.Write(append(frame, frame...))
+	assert.Nil(t, err)
+	b := make([]byte, len(frame)*2)
+	_, err = io.ReadFull(conn, b)
+	assert.Nil(t, err)
+	assert.Equal(t, b, append(frame, frame...))
+	assert.Equal(t, injector.Stats().Conns, uint64(2))
+	conn.Close()
+	<-handler.disconnected
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, server.ErrServerClosed)
+}
@@ -0,0 +1,8 @@
+// Package chaos is injecting network faults to connections, to harden clients and codecs in tests.
+// Injector wraps net.Conn with latency, bandwidth caps, random disconnects, partial writes,
+// byte corruption and split patterns of reads and writes. Every fault is chosen by a seeded RNG,
+// each connection and direction has its own RNG derived from the seed and the connection order,
+// so a failing run is reproduced by the same seed.
+// Wrap server connections of an Address by server.WithWrapConn(injector.Wrap),
+// and client connections by Wrap or Dial in tests.
+package chaos
@@ -0,0 +1,87 @@
+package chaos
+
+import (
+	"time"
+)
+
+// Options defined Injector options
+// Rates are probabilities in [0, 1] checked for each read, and for each chunk written.
+type Options struct {
+	// Seed is the seed of RNG choosing faults
+	Seed int64
+	// Latency is the delay of each read and write
+	Latency time.Duration
+	// Jitter is the max random delay added to Latency
+	Jitter time.Duration
+	// Bandwidth is the bytes per second of each direction, zero means unlimited
+	Bandwidth int
+	// DisconnectRate is the probability of closing connection instead of reading or writing
+	DisconnectRate float64
+	// PartialWriteRate is the probability of writing a random prefix of a chunk and returning io.ErrShortWrite
+	PartialWriteRate float64
+	// CorruptRate is the probability of flipping a random bit of the bytes read or written
+	CorruptRate float64
+	// SplitPattern is the max bytes of each read and written chunk in turn, empty means not split
+	SplitPattern []int
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithSeed is edit Options Seed field
+func WithSeed(seed int64) Option {
+	return func(options *Options) {
+		options.Seed = seed
+	}
+}
+
+// WithLatency is edit Options Latency and Jitter fields
+func WithLatency(latency, jitter time.Duration) Option {
+	return func(options *Options) {
+		options.Latency = latency
+		options.Jitter = jitter
+	}
+}
+
+// WithBandwidth is edit Options Bandwidth field
+func WithBandwidth(bytesPerSecond int) Option {
+	return func(options *Options) {
+		options.Bandwidth = bytesPerSecond
+	}
+}
+
+// WithDisconnectRate is edit Options DisconnectRate field
+func WithDisconnectRate(rate float64) Option {
+	return func(options *Options) {
+		options.DisconnectRate = rate
+	}
+}
+
+// WithPartialWriteRate is edit Options PartialWriteRate field
+func WithPartialWriteRate(rate float64) Option {
+	return func(options *Options) {
+		options.PartialWriteRate = rate
+	}
+}
+
+// WithCorruptRate is edit Options CorruptRate field
+func WithCorruptRate(rate float64) Option {
+	return func(options *Options) {
+		options.CorruptRate = rate
+	}
+}
+
+// WithSplitPattern is edit Options SplitPattern field
+func WithSplitPattern(sizes ...int) Option {
+	return func(options *Options) {
+		options.SplitPattern = sizes
+	}
+}
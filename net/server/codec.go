@@ -1,6 +1,12 @@
 package server
 
-import "github.com/jarod2011/toolkit/buffer"
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
 
 // Codec will Decode receive data from client and Encode send data before write to client
 type Codec interface {
@@ -21,3 +27,113 @@ func (n *NothingCodec) Decode(buf buffer.Buffer) []byte {
 	_, b := buf.ReadN(buf.Size())
 	return b
 }
+
+// LengthFieldSize is the bytes length of LengthFieldCodec frame header
+const LengthFieldSize = 4
+
+// LengthFieldCodec is Codec of frame prefixed by a big endian uint32 length field
+// Decode will return nil until the whole frame is in buffer
+// It is a StreamCodec streaming frames not shorter than StreamThreshold, the streamed frames have no header.
+type LengthFieldCodec struct {
+	// StreamThreshold is the min frame length streamed to StreamHandler, zero means no frame streamed
+	StreamThreshold int
+}
+
+func (l *LengthFieldCodec) Encode(b []byte) []byte {
+	frame := make([]byte, LengthFieldSize+len(b))
+	binary.BigEndian.PutUint32(frame, uint32(len(b)))
+	copy(frame[LengthFieldSize:], b)
+	return frame
+}
+
+func (l *LengthFieldCodec) Decode(buf buffer.Buffer) []byte {
+	n, header := buf.NextN(LengthFieldSize)
+	if n < LengthFieldSize {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(header))
+	if buf.Size() < LengthFieldSize+size {
+		return nil
+	}
+	buf.ShiftN(LengthFieldSize)
+	_, b := buf.ReadN(size)
+	// the bytes may share memory with buffer, so copy it before buffer reuse
+	return append([]byte{}, b...)
+}
+
+func (l *LengthFieldCodec) DecodeStream(buf buffer.Buffer) ([]byte, int64, bool) {
+	if l.StreamThreshold <= 0 {
+		return nil, 0, false
+	}
+	n, header := buf.NextN(LengthFieldSize)
+	if n < LengthFieldSize {
+		return nil, 0, false
+	}
+	size := int64(binary.BigEndian.Uint32(header))
+	if size < int64(l.StreamThreshold) {
+		return nil, 0, false
+	}
+	buf.ShiftN(LengthFieldSize)
+	return nil, size, true
+}
+
+// EncodeStream will encode the length field of header and body, the header is the beginning of streamed body
+// ErrFrameTooLarge returns when the frame length exceeds the uint32 length field.
+func (l *LengthFieldCodec) EncodeStream(header []byte, length int64) ([]byte, error) {
+	size := int64(len(header)) + length
+	if size > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: stream length %d", ErrFrameTooLarge, size)
+	}
+	frame := make([]byte, LengthFieldSize+len(header))
+	binary.BigEndian.PutUint32(frame, uint32(size))
+	copy(frame[LengthFieldSize:], header)
+	return frame, nil
+}
+
+// StreamCodec is Codec which can decode a large frame as a header and a body streamed to StreamHandler
+// Server will call DecodeStream before decoding each frame when Codec implements it and Handler is a StreamHandler.
+type StreamCodec interface {
+	Codec
+	// DecodeStream will consume the header of a frame should be streamed from buf
+	// It returns the header and the body length following it,
+	// or false without consuming buf when the frame is decoded by Decode or more bytes are required.
+	DecodeStream(buf buffer.Buffer) (header []byte, length int64, ok bool)
+	// EncodeStream will encode the header of a frame with body length, the body is written raw after it
+	// It returns error when the frame can not be encoded, like the length exceeds the limit of codec.
+	EncodeStream(header []byte, length int64) ([]byte, error)
+}
+
+// ErrorCodec is Codec which can report malformed data when decoding
+// Server will call DecodeError instead of Decode when Codec implements it,
+// a non-nil error is counted as decode error, reported to Handler OnError and the connection is disconnected,
+// because the stream can not be resynchronized.
+type ErrorCodec interface {
+	Codec
+	// DecodeError is like Decode, but return error when data in buffer is malformed
+	DecodeError(buf buffer.Buffer) ([]byte, error)
+}
+
+// ConnCodec is Codec keeping state of each connection, like keys of encryption
+// Server will call NewConnCodec for each connection when Codec implements it,
+// the returned Codec serves that connection only. It may send raw bytes by conn Send without encode.
+type ConnCodec interface {
+	Codec
+	// NewConnCodec will return the Codec of conn
+	NewConnCodec(conn Connection) Codec
+}
+
+// connCodec will return the Codec serving conn, which is created by codec when it is a ConnCodec
+func connCodec(codec Codec, conn Connection) Codec {
+	if cc, ok := codec.(ConnCodec); ok {
+		return cc.NewConnCodec(conn)
+	}
+	return codec
+}
+
+// decode will decode a frame from buf by codec, using DecodeError when codec is an ErrorCodec
+func decode(codec Codec, buf buffer.Buffer) ([]byte, error) {
+	if ec, ok := codec.(ErrorCodec); ok {
+		return ec.DecodeError(buf)
+	}
+	return codec.Decode(buf), nil
+}
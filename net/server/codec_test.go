@@ -0,0 +1,105 @@
+package server
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+func TestNothingCodec(t *testing.T) {
+	codec := new(NothingCodec)
+	assert.EqualValues(t, codec.Encode([]byte{0x01}), []byte{0x01})
+	buf := buffer.NewBuffer(10)
+	buf.Write([]byte{0x01, 0x02})
+	assert.EqualValues(t, codec.Decode(buf), []byte{0x01, 0x02})
+	assert.Equal(t, buf.Size(), 0)
+}
+
+func TestLengthFieldCodec(t *testing.T) {
+	codec := new(LengthFieldCodec)
+	frame := codec.Encode([]byte{0x01, 0x02, 0x03})
+	assert.EqualValues(t, frame, []byte{0x00, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03})
+	buf := buffer.NewBuffer(10)
+	buf.Write(frame[:2])
+	assert.Nil(t, codec.Decode(buf))
+	buf.Write(frame[2:5])
+	assert.Nil(t, codec.Decode(buf))
+	assert.Equal(t, buf.Size(), 5)
+	buf.Write(frame[5:])
+	assert.EqualValues(t, codec.Decode(buf), []byte{0x01, 0x02, 0x03})
+	assert.Equal(t, buf.Size(), 0)
+	buf.Write(codec.Encode([]byte{}))
+	assert.EqualValues(t, codec.Decode(buf), []byte{})
+	assert.Equal(t, buf.Size(), 0)
+}
+
+func TestLengthFieldCodec_Stream(t *testing.T) {
+	codec := &LengthFieldCodec{StreamThreshold: 4}
+	buf := buffer.NewBuffer(10)
+	buf.Write(codec.Encode([]byte{0x01}))
+	_, _, ok := codec.DecodeStream(buf)
+	assert.False(t, ok)
+	assert.EqualValues(t, codec.Decode(buf), []byte{0x01})
+
+	frame, err := codec.EncodeStream([]byte{0x01}, 3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, frame, []byte{0x00, 0x00, 0x00, 0x04, 0x01})
+	buf.Write(frame[:3])
+	_, _, ok = codec.DecodeStream(buf)
+	assert.False(t, ok)
+	buf.Write(frame[3:])
+	header, length, ok := codec.DecodeStream(buf)
+	assert.True(t, ok)
+	assert.Nil(t, header)
+	assert.Equal(t, length, int64(4))
+	assert.Equal(t, buf.Size(), 1)
+
+	_, _, ok = new(LengthFieldCodec).DecodeStream(buf)
+	assert.False(t, ok)
+
+	_, err = codec.EncodeStream([]byte{0x01}, math.MaxUint32)
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+// sequenceCodec is ConnCodec numbering encoded frames of each connection
+type sequenceCodec struct {
+	LengthFieldCodec
+}
+
+func (s *sequenceCodec) NewConnCodec(conn Connection) Codec {
+	return &sequenceConnCodec{}
+}
+
+type sequenceConnCodec struct {
+	LengthFieldCodec
+	seq byte
+}
+
+func (s *sequenceConnCodec) Encode(b []byte) []byte {
+	s.seq++
+	return s.LengthFieldCodec.Encode(append([]byte{'0' + s.seq}, b...))
+}
+
+func TestNetServer_ConnCodec(t *testing.T) {
+	s := newTestServer(WithCodec(new(sequenceCodec)))
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	codec := new(LengthFieldCodec)
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		conn.Write(append(codec.Encode([]byte("a")), codec.Encode([]byte("b"))...))
+		assert.Equal(t, readFrame(t, conn), "1a")
+		assert.Equal(t, readFrame(t, conn), "2b")
+		conn.Close()
+		<-handler.disconnected
+	}
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
@@ -1,10 +1,80 @@
 package server
 
-import "github.com/jarod2011/toolkit/logger"
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
 
+	"github.com/jarod2011/toolkit/logger"
+)
+
+var (
+	// ErrConnectionClosed will throw when send data to a closed connection
+	ErrConnectionClosed = errors.New("connection closed")
+	// ErrWriteClosed will throw when send data to a connection after CloseWrite
+	ErrWriteClosed = errors.New("connection write closed")
+	// ErrCloseWriteNotSupported will throw when CloseWrite a connection can not be half-closed
+	ErrCloseWriteNotSupported = errors.New("connection close write not supported")
+	// ErrStreamNotSupported will throw when SendStream to a connection whose Codec is not a StreamCodec
+	ErrStreamNotSupported = errors.New("codec does not support streaming")
+	// ErrReadDeadline is reported to Handler OnError when the deadline set by SetReadDeadline exceeded
+	ErrReadDeadline = errors.New("connection read deadline exceeded")
+)
+
+// Connection is a client connection of server
 type Connection interface {
+	// Send will queue data to write to client
+	// The data will be encoded by Codec unless withoutEncode is true.
+	// This method is safe for concurrent use.
 	Send(data []byte, withoutEncode bool) error
+	// SendWait will queue data like Send, and block until it written to client
+	// The data can be reused after it returns, and a slow client blocks the sender, so sending is paced by client.
+	// This method is safe for concurrent use.
+	SendWait(data []byte, withoutEncode bool) error
+	// SendFile will queue length bytes of f from offset to write to client without encoded
+	// It is ordered with data queued by Send. The file is read by offset, so a file can be shared
+	// by connections, it is not closed and must stay open until sent or connection closed.
+	// This method is safe for concurrent use.
+	SendFile(f *os.File, offset, length int64) error
+	// SendStream will write a frame of header and length bytes of body to client, the body is copied by chunks
+	// The header is encoded by StreamCodec EncodeStream, ErrStreamNotSupported returns when Codec is not a StreamCodec.
+	// It is ordered with data queued by Send, and blocks until the body written, so the body is never buffered whole.
+	// The connection is closed when body ends before length bytes, because the frame can not be completed.
+	// This method is safe for concurrent use.
+	SendStream(header []byte, length int64, body io.Reader) error
+	// Remote is the client address
 	Remote() string
+	// Local is the server address of connection
 	Local() string
+	// Logger is the Logger with connection fields
 	Logger() logger.Logger
+	// SetIdentity will set the authenticated identity of connection, it is added to Logger fields as "identity"
+	// This method is safe for concurrent use.
+	SetIdentity(identity string)
+	// Identity will return the identity set by SetIdentity, empty when not authenticated
+	// This method is safe for concurrent use.
+	Identity() string
+	// BufferCapacity is the read buffer capacity of connection, the max length of frames decoded by Codec
+	BufferCapacity() int
+	// Close will close connection after queued data flushed, Handler OnDisconnected is called after closed
+	// Close a closed connection is no-op. This method is safe for concurrent use.
+	Close() error
+	// CloseWrite will shut down the writing side after queued data flushed, reading continues until client closed
+	// Send after CloseWrite returns ErrWriteClosed. This method is safe for concurrent use.
+	CloseWrite() error
+	// SetReadDeadline will set the deadline of receiving data from client, zero time means no deadline
+	// When the deadline exceeded, ErrReadDeadline is reported to Handler OnError and the deadline is cleared,
+	// so the connection keeps reading unless OnError returns DisconnectionAction.
+	// This method is safe for concurrent use.
+	SetReadDeadline(t time.Time) error
+	// PauseRead will stop reading from client and receiving frames until ResumeRead
+	// A frame being received by Handler is not interrupted. This method is safe for concurrent use.
+	PauseRead()
+	// ResumeRead will resume reading paused by PauseRead
+	// This method is safe for concurrent use.
+	ResumeRead()
+	// Closed will return whether the connection is closed or closing
+	// This method is safe for concurrent use.
+	Closed() bool
 }
@@ -0,0 +1,913 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+)
+
+// ErrFrameTooLarge will throw when read buffer full but Codec can not decode a frame
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// closeFlushTimeout is the max time to flush queued data when connection closing
+const closeFlushTimeout = 5 * time.Second
+
+// outbound is queued data, file section, stream body or half-close to write
+type outbound struct {
+	data       []byte
+	file       *os.File
+	offset     int64
+	length     int64
+	closeWrite bool
+	// body is written after data, done receives the result of writing it
+	body io.Reader
+	done chan error
+}
+
+// closeWriter is net.Conn can be half-closed
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// canCloseWrite will return whether conn can be half-closed
+func canCloseWrite(conn net.Conn) bool {
+	if r, ok := conn.(*rewindConn); ok {
+		conn = r.Conn
+	}
+	_, ok := conn.(closeWriter)
+	return ok
+}
+
+// aLongTimeAgo is a deadline to interrupt blocked read
+var aLongTimeAgo = time.Unix(1, 0)
+
+// netConnection is Connection implements by net.Conn
+type netConnection struct {
+	id       uint64
+	server   *netServer
+	listener *listener
+	conn     net.Conn
+	addr     net.Addr
+	remote   string
+	local    string
+	header   *ProxyHeader
+	codec    Codec
+	handler  Handler
+	logger   logger.Logger
+	buf      buffer.Buffer
+	capacity int
+	limiter  *inboundLimiter
+	stats    *addressStats
+	created  time.Time
+	// traffic counters are accessed atomically
+	bytesIn   uint64
+	bytesOut  uint64
+	framesIn  uint64
+	framesOut uint64
+	// memory is the bytes of read buffers and queued data counted by memory budget
+	memory int64
+
+	mu          sync.Mutex
+	queue       []outbound
+	closed      bool
+	reason      *CloseReason
+	identity    string
+	writeClosed bool
+	// readDeadline is set by SetReadDeadline, frameDeadline is set by read loop for InboundLimit FrameTimeout
+	readDeadline  time.Time
+	frameDeadline time.Time
+	// paused is set by PauseRead, throttled is set by memory budget, resume is not nil while either is set
+	paused    bool
+	throttled bool
+	resume    chan struct{}
+	// idle is set while read loop blocked on empty buffer, releasing is set when memory budget requests
+	// the read loop to release buffers, the blocked read is interrupted
+	idle      bool
+	releasing bool
+	// scratch is the bytes read from conn before written to buffer, it is only used by read loop
+	// The buf and scratch are nil before connection admitted, and while released, probe is read then.
+	scratch []byte
+	probe   [1]byte
+	wakeup  chan struct{}
+	done    chan struct{}
+	closing chan struct{}
+}
+
+func newNetConnection(s *netServer, l *listener, conn net.Conn) *netConnection {
+	c := &netConnection{
+		id:       atomic.AddUint64(&s.connID, 1),
+		server:   s,
+		listener: l,
+		conn:     conn,
+		addr:     conn.RemoteAddr(),
+		remote:   conn.RemoteAddr().String(),
+		local:    conn.LocalAddr().String(),
+		codec:    s.opts.Codec,
+		handler:  l.handler,
+		stats:    l.stats,
+		created:  time.Now(),
+		wakeup:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	c.logger = s.opts.Logger.WithField("conn_id", c.id).WithField("remote", c.remote).WithField("local", c.local)
+	c.codec = connCodec(c.codec, c)
+	c.capacity = s.opts.BufferCapacity
+	return c
+}
+
+// initBuffers will take read buffer and scratch from pools and charge them to memory budget
+// It is called after connection admitted, so rejected connections never hold buffers.
+// It never blocks, the connection can not be closed by server before added to listener.
+func (c *netConnection) initBuffers() {
+	c.takeBuffers()
+	if c.server.budget.charge(c, c.bufferSize()) {
+		c.server.budget.reclaim(0)
+	}
+}
+
+// takeBuffers will take read buffer and scratch from pools
+func (c *netConnection) takeBuffers() {
+	c.buf = c.server.pool.Get()
+	c.scratch = *c.server.scratch.Get().(*[]byte)
+}
+
+// putBuffers will put read buffer and scratch back to pools
+func (c *netConnection) putBuffers() {
+	c.server.pool.Put(c.buf)
+	scratch := c.scratch
+	c.server.scratch.Put(&scratch)
+	c.buf, c.scratch = nil, nil
+}
+
+// bufferSize is the bytes of read buffer and scratch counted by memory budget
+func (c *netConnection) bufferSize() int64 {
+	return int64(c.capacity) * 2
+}
+
+// buffered will return the bytes length in read buffer, zero when released
+func (c *netConnection) buffered() int {
+	if c.buf == nil {
+		return 0
+	}
+	return c.buf.Size()
+}
+
+// releaseBuffers will put read buffer and scratch back to pools and release their bytes from memory budget
+func (c *netConnection) releaseBuffers() {
+	c.putBuffers()
+	c.mu.Lock()
+	c.releasing = false
+	_ = c.applyReadDeadline()
+	c.mu.Unlock()
+	atomic.AddUint64(&c.server.budget.releases, 1)
+	c.server.budget.release(c, c.bufferSize())
+}
+
+// acquireBuffers will take read buffer and scratch from pools when memory budget has room
+// It returns false when connection closing while waiting.
+func (c *netConnection) acquireBuffers() bool {
+	if !c.server.budget.acquire(c, c.bufferSize()) {
+		return false
+	}
+	c.takeBuffers()
+	return true
+}
+
+// free will put buffers back to pools and release all bytes of connection from memory budget
+func (c *netConnection) free() {
+	if c.buf != nil {
+		c.putBuffers()
+	}
+	c.server.budget.remove(c)
+}
+
+func (c *netConnection) setProxyHeader(header *ProxyHeader) {
+	if header == nil {
+		return
+	}
+	c.header = header
+	if header.Command == ProxyProxy && header.Source != nil {
+		c.addr = header.Source
+		c.remote = header.Source.String()
+		c.logger = c.server.opts.Logger.WithField("conn_id", c.id).WithField("remote", c.remote).
+			WithField("local", c.local).WithField("proxy", c.conn.RemoteAddr().String())
+	}
+}
+
+// setRoute will serve connection by Codec and Handler of a Sniffer route
+func (c *netConnection) setRoute(route *SniffRoute) {
+	if route.TLS != nil {
+		// sniffed bytes are replayed to TLS handshake instead of decoded
+		_, sniffed := c.buf.ReadN(c.buf.Size())
+		c.conn = tls.Server(&rewindConn{Conn: c.conn, rest: append([]byte{}, sniffed...)}, route.TLS)
+	}
+	if route.Codec != nil {
+		c.codec = connCodec(route.Codec, c)
+	}
+	if route.Handler != nil {
+		c.handler = route.Handler
+	}
+	if route.Name != "" {
+		c.logger = c.logger.WithField("protocol", route.Name)
+	}
+}
+
+// ProxyHeader will return the PROXY protocol header, nil when client not send it
+func (c *netConnection) ProxyHeader() *ProxyHeader {
+	return c.header
+}
+
+func (c *netConnection) Send(data []byte, withoutEncode bool) error {
+	c.server.opts.Capture.record(c, CaptureSend, data, withoutEncode)
+	if !withoutEncode {
+		data = c.codec.Encode(data)
+	}
+	return c.enqueue(outbound{data: data})
+}
+
+func (c *netConnection) SendFile(f *os.File, offset, length int64) error {
+	if length <= 0 {
+		return nil
+	}
+	return c.enqueue(outbound{file: f, offset: offset, length: length})
+}
+
+func (c *netConnection) SendStream(header []byte, length int64, body io.Reader) error {
+	codec, ok := c.codec.(StreamCodec)
+	if !ok {
+		return ErrStreamNotSupported
+	}
+	data, err := codec.EncodeStream(header, length)
+	if err != nil {
+		return err
+	}
+	c.server.opts.Capture.record(c, CaptureSend, header, false)
+	done := make(chan error, 1)
+	if err := c.enqueue(outbound{data: data, body: body, length: length, done: done}); err != nil {
+		return err
+	}
+	return c.wait(done)
+}
+
+func (c *netConnection) SendWait(data []byte, withoutEncode bool) error {
+	c.server.opts.Capture.record(c, CaptureSend, data, withoutEncode)
+	if !withoutEncode {
+		data = c.codec.Encode(data)
+	}
+	done := make(chan error, 1)
+	if err := c.enqueue(outbound{data: data, done: done}); err != nil {
+		return err
+	}
+	return c.wait(done)
+}
+
+// wait will return the write result of an outbound queued with done
+// ErrConnectionClosed returns when write loop exited before it written, the outbound is never written then.
+func (c *netConnection) wait(done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-c.done:
+		// the write loop may exit after the outbound written
+		select {
+		case err := <-done:
+			return err
+		default:
+			return ErrConnectionClosed
+		}
+	}
+}
+
+func (c *netConnection) enqueue(out outbound) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrConnectionClosed
+	}
+	if c.writeClosed {
+		c.mu.Unlock()
+		return ErrWriteClosed
+	}
+	c.writeClosed = out.closeWrite
+	c.queue = append(c.queue, out)
+	// queued data is charged before connection closed, so it is released by free at last
+	exceeded := c.server.budget.charge(c, int64(len(out.data)))
+	c.mu.Unlock()
+	if exceeded {
+		c.server.budget.reclaim(0)
+	}
+	select {
+	case c.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *netConnection) Remote() string {
+	return c.remote
+}
+
+func (c *netConnection) Local() string {
+	return c.local
+}
+
+func (c *netConnection) Logger() logger.Logger {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logger
+}
+
+func (c *netConnection) SetIdentity(identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.identity = identity
+	c.logger = c.logger.WithField("identity", identity)
+}
+
+func (c *netConnection) BufferCapacity() int {
+	return c.capacity
+}
+
+func (c *netConnection) Identity() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.identity
+}
+
+func (c *netConnection) Close() error {
+	c.close(NewCloseReason(CloseHandler, nil))
+	return nil
+}
+
+func (c *netConnection) CloseWrite() error {
+	if !canCloseWrite(c.conn) {
+		return ErrCloseWriteNotSupported
+	}
+	return c.enqueue(outbound{closeWrite: true})
+}
+
+func (c *netConnection) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.applyReadDeadline()
+}
+
+func (c *netConnection) PauseRead() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+	c.updateResume()
+}
+
+func (c *netConnection) ResumeRead() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+	c.updateResume()
+}
+
+// setThrottled will pause or resume reading by memory budget, it is independent of PauseRead
+func (c *netConnection) setThrottled(throttled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.throttled = throttled
+	c.updateResume()
+}
+
+// updateResume will pause reading while paused or throttled, and resume it otherwise, the caller must hold mu
+func (c *netConnection) updateResume() {
+	if c.paused || c.throttled {
+		if c.resume == nil {
+			c.resume = make(chan struct{})
+			// interrupt the blocked read
+			_ = c.applyReadDeadline()
+		}
+		return
+	}
+	if c.resume != nil {
+		close(c.resume)
+		c.resume = nil
+		_ = c.applyReadDeadline()
+	}
+}
+
+// requestRelease will interrupt the read loop blocked on empty buffer to release buffers
+// It returns the bytes to be released, and false when read loop is not idle.
+func (c *netConnection) requestRelease() (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.idle {
+		return 0, false
+	}
+	if !c.releasing {
+		c.releasing = true
+		_ = c.applyReadDeadline()
+	}
+	return c.bufferSize(), true
+}
+
+// setIdle will mark read loop blocked on empty buffer or not
+// The release request is dropped when bytes read, because the buffer is not empty.
+func (c *netConnection) setIdle(idle bool, read bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idle = idle
+	if read && c.releasing {
+		c.releasing = false
+		_ = c.applyReadDeadline()
+	}
+}
+
+// shouldRelease will return whether read loop should release buffers before reading
+func (c *netConnection) shouldRelease() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.releasing || c.throttled
+}
+
+func (c *netConnection) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// applyReadDeadline will set the earlier of read deadline and frame deadline to conn, the caller must hold mu
+func (c *netConnection) applyReadDeadline() error {
+	if c.resume != nil || c.releasing {
+		return c.conn.SetReadDeadline(aLongTimeAgo)
+	}
+	deadline := c.readDeadline
+	if !c.frameDeadline.IsZero() && (deadline.IsZero() || c.frameDeadline.Before(deadline)) {
+		deadline = c.frameDeadline
+	}
+	return c.conn.SetReadDeadline(deadline)
+}
+
+func (c *netConnection) setFrameDeadline(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frameDeadline.Equal(t) {
+		return
+	}
+	c.frameDeadline = t
+	_ = c.applyReadDeadline()
+}
+
+// deadline is the kind of exceeded read deadline
+type deadline int
+
+const (
+	noDeadline    deadline = iota // read interrupted by PauseRead or deadline changed
+	frameDeadline                 // incomplete frame is not completed in time
+	readDeadline                  // deadline set by SetReadDeadline exceeded
+)
+
+// exceeded will return which deadline exceeded at now, the read deadline is cleared when exceeded
+func (c *netConnection) exceeded(now time.Time) deadline {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.frameDeadline.IsZero() && !now.Before(c.frameDeadline) {
+		return frameDeadline
+	}
+	if !c.readDeadline.IsZero() && !now.Before(c.readDeadline) {
+		c.readDeadline = time.Time{}
+		_ = c.applyReadDeadline()
+		return readDeadline
+	}
+	return noDeadline
+}
+
+// waitResume will block while reading paused
+// It returns false when connection closing, and whether it has waited.
+func (c *netConnection) waitResume() (bool, bool) {
+	c.mu.Lock()
+	resume := c.resume
+	c.mu.Unlock()
+	if resume == nil {
+		return true, false
+	}
+	select {
+	case <-resume:
+		return true, true
+	case <-c.closing:
+		return false, true
+	}
+}
+
+// close will stop accepting data to send, the queued data will be flushed before connection closed
+// The reason of the first close is kept and added to Logger fields.
+func (c *netConnection) close(reason *CloseReason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.reason = reason
+	c.logger = reason.Logger(c.logger)
+	close(c.closing)
+}
+
+// closeReason will return the reason of connection closed, nil when not closed
+func (c *netConnection) closeReason() *CloseReason {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+func (c *netConnection) writeLoop() {
+	defer close(c.done)
+	defer c.conn.Close()
+	for {
+		select {
+		case <-c.wakeup:
+		case <-c.closing:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+			_ = c.flush()
+			return
+		}
+		if err := c.flush(); err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.Logger().DebugF("write failed: %v", err)
+			}
+			c.close(NewCloseReason(CloseIOError, err))
+			return
+		}
+	}
+}
+
+func (c *netConnection) flush() error {
+	c.mu.Lock()
+	queue := c.queue
+	c.queue = nil
+	c.mu.Unlock()
+	for i, out := range queue {
+		if err := c.write(out); err != nil {
+			// stream senders are waiting for the result
+			for _, out := range queue[i:] {
+				if out.done != nil {
+					out.done <- err
+				}
+			}
+			return err
+		}
+		c.server.budget.release(c, int64(len(out.data)))
+		if out.done != nil {
+			out.done <- nil
+		}
+		atomic.AddUint64(&c.framesOut, 1)
+		atomic.AddUint64(&c.stats.framesOut, 1)
+	}
+	return nil
+}
+
+// write will write an outbound to conn
+func (c *netConnection) write(out outbound) error {
+	if out.closeWrite {
+		return c.conn.(closeWriter).CloseWrite()
+	}
+	if out.file != nil {
+		n, err := c.sendFile(out.file, out.offset, out.length)
+		c.wroteN(n)
+		return err
+	}
+	n, err := c.conn.Write(out.data)
+	c.wrote(out.data[:n])
+	if err != nil || out.body == nil {
+		return err
+	}
+	// body is copied by chunks of buffer capacity and counted but not captured like SendFile
+	written, err := io.CopyBuffer(c.conn, io.LimitReader(out.body, out.length), make([]byte, c.capacity))
+	c.wroteN(written)
+	if err == nil && written < out.length {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *netConnection) read(b []byte) {
+	atomic.AddUint64(&c.bytesIn, uint64(len(b)))
+	atomic.AddUint64(&c.stats.bytesIn, uint64(len(b)))
+	if len(b) > 0 {
+		c.server.opts.Capture.record(c, CaptureRead, b, false)
+	}
+}
+
+func (c *netConnection) wrote(b []byte) {
+	c.wroteN(int64(len(b)))
+	if len(b) > 0 {
+		c.server.opts.Capture.record(c, CaptureWrite, b, false)
+	}
+}
+
+// wroteN will count written bytes, bytes of SendFile are counted but not captured
+func (c *netConnection) wroteN(n int64) {
+	atomic.AddUint64(&c.bytesOut, uint64(n))
+	atomic.AddUint64(&c.stats.bytesOut, uint64(n))
+}
+
+// sendFile will write file section by sendfile on TCP connection, or by buffered copy otherwise
+func (c *netConnection) sendFile(f *os.File, offset, length int64) (int64, error) {
+	if tc, ok := c.conn.(*net.TCPConn); ok {
+		if n, handled, err := sendFile(tc, f, offset, length); handled {
+			return n, err
+		}
+	}
+	n, err := io.Copy(c.conn, io.NewSectionReader(f, offset, length))
+	if err == nil && n < length {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (c *netConnection) queueDepth() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+func (c *netConnection) snapshot(now time.Time) ConnectionStats {
+	return ConnectionStats{
+		ID:         c.id,
+		Address:    c.listener.address.String(),
+		Remote:     c.remote,
+		Local:      c.local,
+		Connected:  c.created,
+		Age:        now.Sub(c.created),
+		BytesIn:    atomic.LoadUint64(&c.bytesIn),
+		BytesOut:   atomic.LoadUint64(&c.bytesOut),
+		FramesIn:   atomic.LoadUint64(&c.framesIn),
+		FramesOut:  atomic.LoadUint64(&c.framesOut),
+		QueueDepth: c.queueDepth(),
+		Memory:     atomic.LoadInt64(&c.memory),
+	}
+}
+
+func (c *netConnection) readLoop() {
+	if limit := c.listener.address.Options.InboundLimit; limit != nil {
+		c.limiter = newInboundLimiter(limit)
+	}
+	maxPending := c.limiter.maxPending(c.capacity)
+	frameTimeout := c.limiter.frameTimeout()
+	var pendingSince time.Time
+	c.server.budget.add(c)
+	// bytes read with PROXY protocol header are already in buffer
+	if c.decode() {
+		return
+	}
+	for {
+		// idle or throttled connection does not hold buffers while not reading
+		if c.buf != nil && c.buf.Size() == 0 && c.shouldRelease() {
+			c.releaseBuffers()
+		}
+		ok, waited := c.waitResume()
+		if !ok {
+			return
+		}
+		if waited {
+			// client is not read while paused, so the frame timeout restarts
+			pendingSince = time.Time{}
+			c.setFrameDeadline(time.Time{})
+		}
+		if frameTimeout > 0 {
+			// an incomplete frame must be completed before deadline
+			if c.buffered() == 0 {
+				pendingSince = time.Time{}
+				c.setFrameDeadline(time.Time{})
+			} else if pendingSince.IsZero() {
+				pendingSince = time.Now()
+				c.setFrameDeadline(pendingSince.Add(frameTimeout))
+			}
+		}
+		b := c.probe[:]
+		if c.buf != nil {
+			b = c.scratch[:c.capacity-c.buf.Size()]
+		}
+		c.setIdle(c.buf != nil && c.buf.Size() == 0, false)
+		n, err := c.conn.Read(b)
+		c.setIdle(false, n > 0)
+		if n > 0 {
+			// the budget may be exhausted, the client is not read until buffers acquired
+			if c.buf == nil && !c.acquireBuffers() {
+				return
+			}
+			_, _ = c.buf.Write(b[:n])
+			c.read(b[:n])
+			if c.limit(c.limiter.readBytes(n)) {
+				return
+			}
+			frames := atomic.LoadUint64(&c.framesIn)
+			if c.decode() {
+				return
+			}
+			if atomic.LoadUint64(&c.framesIn) != frames {
+				pendingSince = time.Time{}
+			}
+			if c.buf.Size() >= maxPending {
+				atomic.AddUint64(&c.stats.decodeErrors, 1)
+				c.server.handle(c, DisconnectionAction, ErrFrameTooLarge, CloseCodecError)
+				return
+			}
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				switch c.exceeded(time.Now()) {
+				case frameDeadline:
+					atomic.AddUint64(&c.stats.decodeErrors, 1)
+					c.server.handle(c, DisconnectionAction, ErrFrameTimeout, CloseCodecError)
+					return
+				case readDeadline:
+					if c.server.handle(c, NothingAction, ErrReadDeadline, CloseTimeout) {
+						return
+					}
+				}
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				c.close(NewCloseReason(ClosePeer, nil))
+			} else if !errors.Is(err, net.ErrClosed) && !c.Closed() {
+				c.close(NewCloseReason(CloseIOError, err))
+				if c.handler.OnError(c, err) == StopServerAction {
+					go c.server.Stop()
+				}
+			}
+			return
+		}
+	}
+}
+
+// decode will decode frames in buffer and call Handler OnReceived
+// It returns whether the connection should stop reading.
+func (c *netConnection) decode() bool {
+	for c.buf.Size() > 0 {
+		if ok, _ := c.waitResume(); !ok {
+			return true
+		}
+		if streamed, stop := c.stream(); stop {
+			return true
+		} else if streamed {
+			continue
+		}
+		frame, err := decode(c.codec, c.buf)
+		if err != nil {
+			atomic.AddUint64(&c.stats.decodeErrors, 1)
+			c.server.handle(c, DisconnectionAction, err, CloseCodecError)
+			return true
+		}
+		if frame == nil {
+			return false
+		}
+		atomic.AddUint64(&c.framesIn, 1)
+		atomic.AddUint64(&c.stats.framesIn, 1)
+		c.server.opts.Capture.record(c, CaptureReceive, frame, false)
+		if c.limit(c.limiter.readFrame()) {
+			return true
+		}
+		start := time.Now()
+		action, err := c.handler.OnReceived(frame, c)
+		c.stats.latency.Observe(time.Since(start))
+		if c.server.handle(c, action, err, CloseHandler) {
+			return true
+		}
+	}
+	return false
+}
+
+// stream will receive a frame by StreamHandler OnStream when Codec and Handler support streaming
+// It returns whether a frame streamed and whether the connection should stop reading.
+func (c *netConnection) stream() (bool, bool) {
+	codec, ok := c.codec.(StreamCodec)
+	if !ok {
+		return false, false
+	}
+	handler, ok := c.handler.(StreamHandler)
+	if !ok {
+		return false, false
+	}
+	header, length, ok := codec.DecodeStream(c.buf)
+	if !ok {
+		return false, false
+	}
+	atomic.AddUint64(&c.framesIn, 1)
+	atomic.AddUint64(&c.stats.framesIn, 1)
+	c.server.opts.Capture.record(c, CaptureReceive, header, false)
+	if c.limit(c.limiter.readFrame()) {
+		return true, true
+	}
+	// the body may take longer than frame timeout
+	c.setFrameDeadline(time.Time{})
+	body := &bodyReader{c: c, remain: length}
+	start := time.Now()
+	action, err := handler.OnStream(header, body, c)
+	c.stats.latency.Observe(time.Since(start))
+	if c.server.handle(c, action, err, CloseHandler) {
+		return true, true
+	}
+	// the unread body is discarded to decode the next frame
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		switch {
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			c.close(NewCloseReason(ClosePeer, nil))
+		case errors.Is(err, ErrReadDeadline):
+			c.server.handle(c, DisconnectionAction, err, CloseTimeout)
+		case !c.Closed():
+			c.server.handle(c, DisconnectionAction, err, CloseIOError)
+		}
+		return true, true
+	}
+	return true, false
+}
+
+// fill will read from conn to buffer for streamed body
+func (c *netConnection) fill() error {
+	for {
+		if ok, _ := c.waitResume(); !ok {
+			return ErrConnectionClosed
+		}
+		n, err := c.conn.Read(c.scratch[:c.capacity-c.buf.Size()])
+		if n > 0 {
+			_, _ = c.buf.Write(c.scratch[:n])
+			c.read(c.scratch[:n])
+			if c.limit(c.limiter.readBytes(n)) {
+				return ErrConnectionClosed
+			}
+			return nil
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				if c.exceeded(time.Now()) == readDeadline {
+					return ErrReadDeadline
+				}
+				// interrupted by PauseRead
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+}
+
+// bodyReader is io.Reader of a streamed frame body, it reads from connection buffer on demand
+type bodyReader struct {
+	c      *netConnection
+	remain int64
+	err    error
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	if r.remain <= 0 {
+		return 0, io.EOF
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.c.buf.Size() == 0 {
+		if r.err = r.c.fill(); r.err != nil {
+			return 0, r.err
+		}
+	}
+	n := len(p)
+	if size := r.c.buf.Size(); n > size {
+		n = size
+	}
+	if int64(n) > r.remain {
+		n = int(r.remain)
+	}
+	n, b := r.c.buf.ReadN(n)
+	copy(p, b)
+	r.remain -= int64(n)
+	return n, nil
+}
+
+// limit will pause reading or report ErrRateLimited when wait is positive
+// It returns whether the connection should stop reading.
+func (c *netConnection) limit(wait time.Duration) bool {
+	if wait <= 0 {
+		return false
+	}
+	if c.limiter.limit.Mode == InboundLimitReport {
+		return c.server.handle(c, NothingAction, ErrRateLimited, CloseRateLimited)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false
+	case <-c.closing:
+		return true
+	}
+}
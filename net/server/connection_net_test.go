@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// controlHandler will control connection by received commands
+type controlHandler struct {
+	*echoHandler
+	connected chan Connection
+}
+
+func (c *controlHandler) OnConnected(conn Connection) (Action, error) {
+	c.connected <- conn
+	return c.echoHandler.OnConnected(conn)
+}
+
+func (c *controlHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	switch string(frame) {
+	case "close":
+		conn.Send([]byte("closing"), false)
+		return NothingAction, conn.Close()
+	case "close write":
+		conn.Send([]byte("half"), false)
+		return NothingAction, conn.CloseWrite()
+	case "deadline":
+		return NothingAction, conn.SetReadDeadline(time.Now().Add(time.Millisecond * 20))
+	}
+	return c.echoHandler.OnReceived(frame, conn)
+}
+
+func (c *controlHandler) hasError(target error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, err := range c.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *controlHandler) lastReason() *CloseReason {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reasons[len(c.reasons)-1]
+}
+
+func TestNetConnection_Control(t *testing.T) {
+	s := newTestServer(WithCodec(new(LengthFieldCodec)))
+	handler := &controlHandler{echoHandler: newEchoHandler(), connected: make(chan Connection, 10)}
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	codec := new(LengthFieldCodec)
+	dial := func(t *testing.T) (net.Conn, Connection) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		return conn, <-handler.connected
+	}
+
+	t.Run("test close", func(t *testing.T) {
+		client, conn := dial(t)
+		defer client.Close()
+		assert.False(t, conn.Closed())
+		client.Write(codec.Encode([]byte("close")))
+		assert.Equal(t, readFrame(t, client), "closing")
+		_, err := client.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		assert.True(t, <-handler.disconnected == conn)
+		assert.Equal(t, handler.lastReason(), &CloseReason{Code: CloseHandler, Initiator: InitiatorHandler})
+		assert.True(t, conn.Closed())
+		assert.ErrorIs(t, conn.Send([]byte("late"), false), ErrConnectionClosed)
+		assert.Nil(t, conn.Close())
+	})
+
+	t.Run("test close write", func(t *testing.T) {
+		client, conn := dial(t)
+		defer client.Close()
+		client.Write(codec.Encode([]byte("close write")))
+		assert.Equal(t, readFrame(t, client), "half")
+		_, err := client.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		// the reading side is still served
+		client.Write(codec.Encode([]byte("hello")))
+		waitFor(t, func() bool {
+			return handler.hasError(ErrWriteClosed)
+		})
+		assert.False(t, conn.Closed())
+		assert.ErrorIs(t, conn.CloseWrite(), ErrWriteClosed)
+		client.Close()
+		assert.True(t, <-handler.disconnected == conn)
+		assert.Equal(t, handler.lastReason(), &CloseReason{Code: ClosePeer, Initiator: InitiatorPeer})
+	})
+
+	t.Run("test read deadline", func(t *testing.T) {
+		client, conn := dial(t)
+		defer client.Close()
+		client.Write(codec.Encode([]byte("deadline")))
+		waitFor(t, func() bool {
+			return handler.hasError(ErrReadDeadline)
+		})
+		// the deadline is cleared after reported
+		client.Write(codec.Encode([]byte("ping")))
+		assert.Equal(t, readFrame(t, client), "ping")
+		assert.False(t, conn.Closed())
+		client.Close()
+		assert.True(t, <-handler.disconnected == conn)
+	})
+
+	t.Run("test pause read", func(t *testing.T) {
+		client, conn := dial(t)
+		defer client.Close()
+		conn.PauseRead()
+		conn.PauseRead()
+		client.Write(codec.Encode([]byte("first")))
+		client.Write(codec.Encode([]byte("second")))
+		_ = client.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+		_, err := client.Read(make([]byte, 1))
+		var ne net.Error
+		assert.True(t, errors.As(err, &ne) && ne.Timeout())
+		_ = client.SetReadDeadline(time.Time{})
+		conn.ResumeRead()
+		assert.Equal(t, readFrame(t, client), "first")
+		assert.Equal(t, readFrame(t, client), "second")
+		// a paused connection is still closed
+		conn.PauseRead()
+		assert.Nil(t, conn.Close())
+		assert.True(t, <-handler.disconnected == conn)
+	})
+
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// ListenFdsEnv is the environment marker of listeners inherited from parent process
+// Its value is Address String of each listener joined by comma, in order of file descriptors from 3.
+const ListenFdsEnv = "TOOLKIT_LISTEN_FDS"
+
+// ErrHandOffNotSupported will throw when listener hand off not supported by the platform
+var ErrHandOffNotSupported = errors.New("listener hand off not supported")
+
+// listen will use the inherited listener of address, or create a new listener
+func (s *netServer) listen(address *Address) (net.Listener, error) {
+	if ln, ok := s.inherited[address.String()]; ok {
+		delete(s.inherited, address.String())
+		s.opts.Logger.InfoF("server use inherited listener of %s", address)
+		return ln, nil
+	}
+	return net.Listen(address.Network, address.Addr)
+}
+
+// closeInherited will close inherited listeners no address bound
+func (s *netServer) closeInherited() {
+	for name, ln := range s.inherited {
+		s.opts.Logger.WarnF("server close unused inherited listener of %s", name)
+		ln.Close()
+		delete(s.inherited, name)
+	}
+}
+
+// listenerFiles will return file of each listening listener and their Address String
+// The listener file is a duplicate, closing listener not affects it.
+func (s *netServer) listenerFiles() ([]*os.File, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var files []*os.File
+	var names []string
+	for address, l := range s.listeners {
+		if l.ln == nil || l.getState() != AddressListening {
+			continue
+		}
+		fl, ok := l.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, nil, ErrHandOffNotSupported
+		}
+		f, err := fl.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, err
+		}
+		// the socket file must be kept for the new process
+		if ul, ok := l.ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		files = append(files, f)
+		names = append(names, address.String())
+	}
+	return files, names, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// Drain will stop accepting new connections and wait existing connections closed
+// Connections still open after timeout will be closed, and then Start returns ErrServerClosed.
+// Zero timeout means wait until all connections closed.
+func (s *netServer) Drain(timeout time.Duration) error {
+	s.mu.Lock()
+	listeners := make([]*listener, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		listeners = append(listeners, l)
+	}
+	s.mu.Unlock()
+	for _, l := range listeners {
+		l.setState(AddressDraining)
+		if l.ln != nil {
+			l.ln.Close()
+		}
+	}
+	drained := make(chan struct{})
+	go func() {
+		for _, l := range listeners {
+			l.wg.Wait()
+		}
+		close(drained)
+	}()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-drained:
+	case <-expired:
+		s.opts.Logger.WarnF("server drain timeout, close remaining connections")
+	}
+	return s.Stop()
+}
@@ -0,0 +1,176 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxHandOffListeners is the max count of listeners received by ReceiveListeners
+const maxHandOffListeners = 64
+
+// loadInherited will load listeners inherited by ListenFdsEnv
+// The environment is cleared after loaded, so it will not be inherited by another process.
+func (s *netServer) loadInherited() {
+	value, ok := os.LookupEnv(ListenFdsEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(ListenFdsEnv)
+	for i, name := range splitNames(value) {
+		f := os.NewFile(uintptr(3+i), name)
+		if err := s.inherit(name, f); err != nil {
+			s.opts.Logger.ErrorF("server inherit listener of %s failed: %v", name, err)
+		}
+	}
+}
+
+// splitNames will split the listener names joined by comma, empty value is no listener
+func splitNames(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func (s *netServer) inherit(name string, f *os.File) error {
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.inherited[name]; ok {
+		old.Close()
+	}
+	s.inherited[name] = ln
+	return nil
+}
+
+// Upgrade will start a new process of current executable which inherits all listeners,
+// and then drain this server in background with timeout.
+// The args are the arguments of new process, when empty the current process arguments are used.
+// The new process gets the listeners when Start, for the same Address String bound.
+// It returns the pid of new process.
+func (s *netServer) Upgrade(timeout time.Duration, args ...string) (int, error) {
+	files, names, err := s.listenerFiles()
+	if err != nil {
+		return 0, err
+	}
+	defer closeFiles(files)
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	if len(args) == 0 {
+		args = os.Args[1:]
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, ListenFdsEnv+"=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, ListenFdsEnv+"="+strings.Join(names, ","))
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+	s.opts.Logger.InfoF("server upgraded to process %d, draining", cmd.Process.Pid)
+	go s.Drain(timeout)
+	return cmd.Process.Pid, nil
+}
+
+// HandOff will listen unix socket path and send all listeners by SCM_RIGHTS
+// to the first process calling ReceiveListeners, and then drain this server in background with timeout.
+// It blocks until listeners sent.
+func (s *netServer) HandOff(path string, timeout time.Duration) error {
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	conn, err := ln.AcceptUnix()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	files, names, err := s.listenerFiles()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+	if len(files) > maxHandOffListeners {
+		return fmt.Errorf("too many listeners to hand off: %d", len(files))
+	}
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+	// names end with a newline, so the message is never empty without listeners
+	if _, _, err := conn.WriteMsgUnix([]byte(strings.Join(names, ",")+"\n"), syscall.UnixRights(fds...), nil); err != nil {
+		return err
+	}
+	// wait receiver acknowledge, so listeners are not closed before received
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return err
+	}
+	s.opts.Logger.InfoF("server handed off listeners by %s, draining", path)
+	go s.Drain(timeout)
+	return nil
+}
+
+// ReceiveListeners will connect unix socket path and receive listeners sent by HandOff
+// The received listeners are used when Start, for the same Address String bound.
+func (s *netServer) ReceiveListeners(path string) error {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	b := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace(maxHandOffListeners*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(b, oob)
+	if err != nil {
+		return err
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return err
+	}
+	var fds []int
+	for _, m := range messages {
+		rights, err := syscall.ParseUnixRights(&m)
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	names := splitNames(strings.TrimSuffix(string(b[:n]), "\n"))
+	if len(names) != len(fds) {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		return errors.New("listeners and names not match")
+	}
+	s.mu.Lock()
+	for i, name := range names {
+		if err := s.inherit(name, os.NewFile(uintptr(fds[i]), name)); err != nil {
+			s.opts.Logger.ErrorF("server inherit listener of %s failed: %v", name, err)
+		}
+	}
+	s.mu.Unlock()
+	_, err = conn.Write([]byte{1})
+	return err
+}
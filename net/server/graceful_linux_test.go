@@ -0,0 +1,165 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// greetHandler will send its name when connected and echo frames
+type greetHandler struct {
+	echoHandler
+	name string
+}
+
+func (g *greetHandler) OnConnected(conn Connection) (Action, error) {
+	return NothingAction, conn.Send([]byte(g.name), false)
+}
+
+func greeting(t *testing.T, addr string) (net.Conn, string) {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	b := make([]byte, 16)
+	n, err := conn.Read(b)
+	assert.Nil(t, err)
+	return conn, string(b[:n])
+}
+
+func TestNetServer_HandOff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handoff.sock")
+	parent := newTestServer()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, parent.Bind(address, &greetHandler{echoHandler: *newEchoHandler(), name: "parent"}))
+	listening, result := startServer(t, parent, address)
+	addr := listening[address]
+	c1, name := greeting(t, addr)
+	defer c1.Close()
+	assert.Equal(t, name, "parent")
+
+	handOff := make(chan error, 1)
+	go func() {
+		handOff <- parent.HandOff(path, time.Second*5)
+	}()
+	child := newTestServer()
+	assert.Nil(t, child.Bind(address, &greetHandler{echoHandler: *newEchoHandler(), name: "child"}))
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = child.ReceiveListeners(path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.Nil(t, err)
+	assert.Nil(t, <-handOff)
+	_, childResult := startServer(t, child, address)
+	defer func() {
+		child.Stop()
+		<-childResult
+	}()
+
+	// new connections are accepted by child, the old one is still served by parent
+	for i := 0; i < 100; i++ {
+		c2, name := greeting(t, addr)
+		c2.Close()
+		if name == "child" {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	c2, name := greeting(t, addr)
+	defer c2.Close()
+	assert.Equal(t, name, "child")
+	c1.Write([]byte("still"))
+	b := make([]byte, 5)
+	_, err = c1.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "still")
+	c1.Close()
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_HandOffEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handoff.sock")
+	parent := newTestServer()
+	handOff := make(chan error, 1)
+	go func() {
+		handOff <- parent.HandOff(path, time.Second)
+	}()
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = newTestServer().ReceiveListeners(path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.Nil(t, err)
+	assert.Nil(t, <-handOff)
+}
+
+func TestNetServer_Upgrade(t *testing.T) {
+	if os.Getenv(ListenFdsEnv) != "" {
+		// the upgraded process, serve until stop frame received
+		s := newTestServer()
+		s.Bind(NewAddress("tcp", "127.0.0.1:0"), &greetHandler{echoHandler: *newEchoHandler(), name: "child"})
+		s.Start()
+		os.Exit(0)
+	}
+	s := newTestServer()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, &greetHandler{echoHandler: *newEchoHandler(), name: "parent"}))
+	listening, result := startServer(t, s, address)
+	c1, name := greeting(t, listening[address])
+	defer c1.Close()
+	assert.Equal(t, name, "parent")
+
+	pid, err := s.Upgrade(time.Second*5, "-test.run=^TestNetServer_Upgrade$")
+	assert.Nil(t, err)
+	var c2 net.Conn
+	for i := 0; i < 200; i++ {
+		c2, name = greeting(t, listening[address])
+		if name == "child" {
+			break
+		}
+		c2.Close()
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, name, "child")
+	c2.Write([]byte("stop"))
+	c2.Close()
+	for i := 0; i < 200 && syscall.Kill(pid, 0) == nil; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.NotNil(t, syscall.Kill(pid, 0))
+
+	c1.Write([]byte("still"))
+	b := make([]byte, 5)
+	_, err = c1.Read(b)
+	assert.Nil(t, err)
+	c1.Close()
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_Drain(t *testing.T) {
+	s := newTestServer()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	handler := newEchoHandler()
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	time.Sleep(time.Millisecond * 10)
+	start := time.Now()
+	assert.Nil(t, s.Drain(time.Millisecond*50))
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*50)
+	<-handler.disconnected
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
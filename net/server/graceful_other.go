@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import "time"
+
+func (s *netServer) loadInherited() {
+}
+
+// Upgrade is only supported on linux
+func (s *netServer) Upgrade(timeout time.Duration, args ...string) (int, error) {
+	return 0, ErrHandOffNotSupported
+}
+
+// HandOff is only supported on linux
+func (s *netServer) HandOff(path string, timeout time.Duration) error {
+	return ErrHandOffNotSupported
+}
+
+// ReceiveListeners is only supported on linux
+func (s *netServer) ReceiveListeners(path string) error {
+	return ErrHandOffNotSupported
+}
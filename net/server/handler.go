@@ -1,5 +1,7 @@
 package server
 
+import "io"
+
 // Handler is handler of client read or write data
 // The Action of method returned can control server or connection
 // When Action is StopServerAction: the server will stop
@@ -11,7 +13,8 @@ type Handler interface {
 	OnConnected(conn Connection) (Action, error)
 
 	// OnDisconnected will call when client disconnected
-	OnDisconnected(conn Connection) error
+	// The reason tells why the connection closed, it is never nil.
+	OnDisconnected(conn Connection, reason *CloseReason) error
 
 	// OnReceived will call when read data from client
 	// If Codec is config, decode data(frame) will be input when frame not nil
@@ -22,3 +25,46 @@ type Handler interface {
 	// the result action can control server
 	OnError(conn Connection, err error) Action
 }
+
+// StreamHandler is Handler which receives large frames as stream
+// Server will call OnStream instead of OnReceived for frames decoded by StreamCodec DecodeStream.
+type StreamHandler interface {
+	Handler
+
+	// OnStream will call when the header of a streamed frame decoded
+	// The body is read from client on demand by buffer chunks, so a slow reader applies backpressure to client.
+	// The body is only valid until OnStream returns, its unread bytes are discarded then.
+	// the result action can control server
+	OnStream(header []byte, body io.Reader, conn Connection) (Action, error)
+}
+
+// ForwardStream will pass a streamed frame to handler OnStream when it is a StreamHandler,
+// otherwise the frame is passed to handler OnReceived by ReceiveStream.
+// Handler wrappers use it to forward streamed frames to the wrapped Handler.
+func ForwardStream(handler Handler, header []byte, body io.Reader, conn Connection) (Action, error) {
+	if sh, ok := handler.(StreamHandler); ok {
+		return sh.OnStream(header, body, conn)
+	}
+	return ReceiveStream(handler.OnReceived, header, body, conn)
+}
+
+// ReceiveStream will read the whole body of a streamed frame and pass the frame of header and body to fn
+// It is for Handlers can not process a frame by chunks, the frame is buffered in memory.
+// Like frames decoded by Codec, the frame can not be larger than conn BufferCapacity,
+// otherwise ErrFrameTooLarge returns with DisconnectionAction and the rest of body is not read.
+func ReceiveStream(fn ReceiveFunc, header []byte, body io.Reader, conn Connection) (Action, error) {
+	remain := int64(conn.BufferCapacity() - len(header))
+	if remain < 0 {
+		return DisconnectionAction, ErrFrameTooLarge
+	}
+	// one more byte is read to find the body exceeding
+	b, err := io.ReadAll(io.LimitReader(body, remain+1))
+	if err != nil {
+		return DisconnectionAction, err
+	}
+	if int64(len(b)) > remain {
+		return DisconnectionAction, ErrFrameTooLarge
+	}
+	// the full slice expression keeps header unchanged
+	return fn(append(header[:len(header):len(header)], b...), conn)
+}
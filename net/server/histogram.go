@@ -0,0 +1,91 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets is the default upper bounds of latency Histogram buckets
+var DefaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Histogram is a latency histogram of fixed buckets
+// It is safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+}
+
+// HistogramSnapshot is a copy of Histogram data
+type HistogramSnapshot struct {
+	// Bounds is the upper bounds of buckets
+	Bounds []time.Duration
+	// Counts is the observed count of each bucket, the last one is count above all bounds
+	Counts []uint64
+	// Count is the observed count
+	Count uint64
+	// Sum is the sum of observed durations
+	Sum time.Duration
+}
+
+// NewHistogram will create Histogram of bucket bounds
+// When bounds empty, DefaultLatencyBuckets is used.
+func NewHistogram(bounds ...time.Duration) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	bounds = append([]time.Duration{}, bounds...)
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i] < bounds[j]
+	})
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe will record a duration
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool {
+		return d <= h.bounds[i]
+	})
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	h.mu.Unlock()
+}
+
+// Snapshot will return a copy of Histogram data
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramSnapshot{
+		Bounds: append([]time.Duration{}, h.bounds...),
+		Counts: append([]uint64{}, h.counts...),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
+
+// Mean will return the mean of observed durations
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(time.Second, time.Millisecond)
+	h.Observe(time.Microsecond)
+	h.Observe(time.Millisecond)
+	h.Observe(time.Millisecond * 2)
+	h.Observe(time.Minute)
+	s := h.Snapshot()
+	assert.Equal(t, s.Bounds, []time.Duration{time.Millisecond, time.Second})
+	assert.Equal(t, s.Counts, []uint64{2, 1, 1})
+	assert.Equal(t, s.Count, uint64(4))
+	assert.Equal(t, s.Sum, time.Minute+time.Millisecond*3+time.Microsecond)
+	assert.Equal(t, s.Mean(), s.Sum/4)
+	assert.Zero(t, HistogramSnapshot{}.Mean())
+	assert.Len(t, NewHistogram().Snapshot().Counts, len(DefaultLatencyBuckets)+1)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrRateLimited will report to Handler OnError when InboundLimit exceeded in InboundLimitReport mode
+	ErrRateLimited = errors.New("connection inbound rate limited")
+	// ErrFrameTimeout will report to Handler OnError when a frame not completed in InboundLimit FrameTimeout
+	ErrFrameTimeout = errors.New("frame not completed in time")
+)
+
+// InboundLimitMode is how to handle a connection exceeded InboundLimit rates
+type InboundLimitMode int
+
+const (
+	InboundLimitPause  InboundLimitMode = iota // pause reading until rate recovered, the client is slowed by TCP backpressure
+	InboundLimitReport                         // report ErrRateLimited to Handler OnError, the returned Action decides
+)
+
+// InboundLimit is the Address option to limit inbound traffic of each connection
+type InboundLimit struct {
+	// BytesPerSecond is the max read bytes per second, zero means no limit
+	BytesPerSecond float64
+	// BytesBurst is the max read bytes at once above BytesPerSecond
+	BytesBurst int
+	// FramesPerSecond is the max decoded frames per second, zero means no limit
+	FramesPerSecond float64
+	// FramesBurst is the max decoded frames at once above FramesPerSecond
+	FramesBurst int
+	// Mode is how to handle a connection exceeded rates
+	// In InboundLimitReport mode, the frame is still received after reported when connection not disconnected.
+	Mode InboundLimitMode
+	// MaxPendingBytes is the max buffered bytes not decoded as frame, zero means read buffer capacity
+	// The connection exceeded it will be disconnected with ErrFrameTooLarge.
+	MaxPendingBytes int
+	// FrameTimeout is the max duration bytes of an incomplete frame can be buffered, zero means no limit
+	// The connection exceeded it will be disconnected with ErrFrameTimeout, protects from slowloris clients.
+	FrameTimeout time.Duration
+}
+
+// inboundLimiter is the InboundLimit state of a connection
+type inboundLimiter struct {
+	limit  *InboundLimit
+	bytes  *tokenBucket
+	frames *tokenBucket
+}
+
+func newInboundLimiter(limit *InboundLimit) *inboundLimiter {
+	l := &inboundLimiter{limit: limit}
+	if limit.BytesPerSecond > 0 {
+		l.bytes = newTokenBucket(limit.BytesPerSecond, limit.BytesBurst)
+	}
+	if limit.FramesPerSecond > 0 {
+		l.frames = newTokenBucket(limit.FramesPerSecond, limit.FramesBurst)
+	}
+	return l
+}
+
+// readBytes will return the duration to wait after read n bytes
+func (l *inboundLimiter) readBytes(n int) time.Duration {
+	if l == nil || l.bytes == nil {
+		return 0
+	}
+	return l.bytes.reserve(time.Now(), float64(n))
+}
+
+// readFrame will return the duration to wait after decoded a frame
+func (l *inboundLimiter) readFrame() time.Duration {
+	if l == nil || l.frames == nil {
+		return 0
+	}
+	return l.frames.reserve(time.Now(), 1)
+}
+
+// maxPending will return the max pending bytes of buffer capacity
+func (l *inboundLimiter) maxPending(capacity int) int {
+	if l == nil || l.limit.MaxPendingBytes <= 0 || l.limit.MaxPendingBytes > capacity {
+		return capacity
+	}
+	return l.limit.MaxPendingBytes
+}
+
+func (l *inboundLimiter) frameTimeout() time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.limit.FrameTimeout
+}
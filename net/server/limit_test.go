@@ -0,0 +1,121 @@
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dialLimited will start a server with limit and return a connected client
+func dialLimited(t *testing.T, limit *InboundLimit, opts ...Option) (net.Conn, *echoHandler, func()) {
+	s := newTestServer(opts...)
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0", WithInboundLimit(limit))
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	return conn, handler, func() {
+		conn.Close()
+		s.Stop()
+		<-result
+	}
+}
+
+func lastError(handler *echoHandler) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if len(handler.errs) == 0 {
+		return nil
+	}
+	return handler.errs[len(handler.errs)-1]
+}
+
+func TestInboundLimit_Pause(t *testing.T) {
+	t.Run("test frames", func(t *testing.T) {
+		codec := new(LengthFieldCodec)
+		conn, _, stop := dialLimited(t, &InboundLimit{FramesPerSecond: 20, FramesBurst: 1}, WithCodec(codec))
+		defer stop()
+		start := time.Now()
+		conn.Write(append(append(codec.Encode([]byte("a")), codec.Encode([]byte("b"))...), codec.Encode([]byte("c"))...))
+		b := make([]byte, (LengthFieldSize+1)*3)
+		_, err := io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*90)
+	})
+	t.Run("test bytes", func(t *testing.T) {
+		conn, _, stop := dialLimited(t, &InboundLimit{BytesPerSecond: 1000, BytesBurst: 100})
+		defer stop()
+		start := time.Now()
+		conn.Write(make([]byte, 200))
+		_, err := io.ReadFull(conn, make([]byte, 200))
+		assert.Nil(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*90)
+	})
+}
+
+func TestInboundLimit_Report(t *testing.T) {
+	codec := new(LengthFieldCodec)
+	conn, handler, stop := dialLimited(t, &InboundLimit{FramesPerSecond: 1, Mode: InboundLimitReport}, WithCodec(codec))
+	defer stop()
+	conn.Write(append(codec.Encode([]byte("a")), codec.Encode([]byte("b"))...))
+	// frames are still received after reported
+	_, err := io.ReadFull(conn, make([]byte, (LengthFieldSize+1)*2))
+	assert.Nil(t, err)
+	assert.ErrorIs(t, lastError(handler), ErrRateLimited)
+}
+
+func TestInboundLimit_Stream(t *testing.T) {
+	codec := &LengthFieldCodec{StreamThreshold: 4}
+	s := newTestServer(WithCodec(codec))
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0", WithInboundLimit(&InboundLimit{FramesPerSecond: 1, Mode: InboundLimitReport}))
+	// Recovery makes the handler a StreamHandler, so the frames are streamed
+	assert.Nil(t, s.Bind(address, Chain(handler, Recovery())))
+	listening, result := startServer(t, s, address)
+	defer func() {
+		s.Stop()
+		<-result
+	}()
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write(append(codec.Encode([]byte("streamed")), codec.Encode([]byte("streamed"))...))
+	_, err = io.ReadFull(conn, make([]byte, (LengthFieldSize+8)*2))
+	assert.Nil(t, err)
+	assert.ErrorIs(t, lastError(handler), ErrRateLimited)
+}
+
+func TestInboundLimit_MaxPendingBytes(t *testing.T) {
+	conn, handler, stop := dialLimited(t, &InboundLimit{MaxPendingBytes: 8}, WithCodec(new(LengthFieldCodec)))
+	defer stop()
+	conn.Write([]byte{0x00, 0x00, 0x00, 0x64, 0x01, 0x02, 0x03, 0x04})
+	_, err := conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	<-handler.disconnected
+	assert.ErrorIs(t, lastError(handler), ErrFrameTooLarge)
+}
+
+func TestInboundLimit_FrameTimeout(t *testing.T) {
+	codec := new(LengthFieldCodec)
+	conn, handler, stop := dialLimited(t, &InboundLimit{FrameTimeout: time.Millisecond * 50}, WithCodec(codec))
+	defer stop()
+	frame := codec.Encode([]byte("hello"))
+	conn.Write(frame)
+	_, err := io.ReadFull(conn, make([]byte, len(frame)))
+	assert.Nil(t, err)
+	// idle without pending bytes is not limited
+	time.Sleep(time.Millisecond * 60)
+	conn.Write(frame[:3])
+	time.Sleep(time.Millisecond * 30)
+	conn.Write(frame[3:6])
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), time.Millisecond*50)
+	<-handler.disconnected
+	assert.ErrorIs(t, lastError(handler), ErrFrameTimeout)
+}
@@ -0,0 +1,6 @@
+// Package message is a typed message layer on top of server Codec frames.
+// Registry maps Go types to numeric or string type IDs, and a message frame is the type ID followed by
+// the value marshaled by a server.Serializer, JSON by default or gob by WithSerializer.
+// Handler is a server.Handler decoding received frames by Registry and calling the typed function
+// registered for the value type, frames of unknown type IDs are reported to OnError.
+package message
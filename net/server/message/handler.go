@@ -0,0 +1,100 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// ErrHandlerNotFound is reported to Handler OnError when a registered type has no handler function
+var ErrHandlerNotFound = errors.New("message handler not found")
+
+var (
+	connectionType = reflect.TypeOf((*server.Connection)(nil)).Elem()
+	actionType     = reflect.TypeOf(server.NothingAction)
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Handler is server.Handler calling typed functions with values decoded by Registry
+// Functions must be registered by Handle before the Handler serving connections.
+type Handler struct {
+	registry *Registry
+	events   server.Handler
+	handlers map[reflect.Type]reflect.Value
+}
+
+// NewHandler will create Handler decoding frames by registry
+// The connection events except OnReceived are passed to events, they are ignored when events is nil.
+func NewHandler(registry *Registry, events server.Handler) *Handler {
+	return &Handler{
+		registry: registry,
+		events:   events,
+		handlers: make(map[reflect.Type]reflect.Value),
+	}
+}
+
+// Handle will register fn to receive values of its message type, a function of the same type is replaced
+// The fn must be like func(msg *T, conn server.Connection) (server.Action, error), and T must be registered.
+func (h *Handler) Handle(fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 || t.In(0).Kind() != reflect.Ptr ||
+		t.In(1) != connectionType || t.Out(0) != actionType || t.Out(1) != errorType {
+		return fmt.Errorf("message handler %s is not func(*T, server.Connection) (server.Action, error)", t)
+	}
+	typ := t.In(0).Elem()
+	if !h.registry.registered(typ) {
+		return fmt.Errorf("%w: %s", ErrTypeNotRegistered, typ)
+	}
+	h.handlers[typ] = v
+	return nil
+}
+
+func (h *Handler) OnConnected(conn server.Connection) (server.Action, error) {
+	if h.events == nil {
+		return server.NothingAction, nil
+	}
+	return h.events.OnConnected(conn)
+}
+
+func (h *Handler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	if h.events == nil {
+		return nil
+	}
+	return h.events.OnDisconnected(conn, reason)
+}
+
+func (h *Handler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	msg, err := h.registry.Unmarshal(frame)
+	if err != nil {
+		return server.NothingAction, err
+	}
+	fn, ok := h.handlers[typeOf(msg)]
+	if !ok {
+		return server.NothingAction, fmt.Errorf("%w: %s", ErrHandlerNotFound, typeOf(msg))
+	}
+	out := fn.Call([]reflect.Value{reflect.ValueOf(msg), reflect.ValueOf(&conn).Elem()})
+	action := out[0].Interface().(server.Action)
+	if out[1].IsNil() {
+		return action, nil
+	}
+	return action, out[1].Interface().(error)
+}
+
+// OnStream will pass streamed frames to events when it is a server.StreamHandler, otherwise the whole frames are decoded
+func (h *Handler) OnStream(header []byte, body io.Reader, conn server.Connection) (server.Action, error) {
+	if sh, ok := h.events.(server.StreamHandler); ok {
+		return sh.OnStream(header, body, conn)
+	}
+	return server.ReceiveStream(h.OnReceived, header, body, conn)
+}
+
+func (h *Handler) OnError(conn server.Connection, err error) server.Action {
+	if h.events == nil {
+		return server.NothingAction
+	}
+	return h.events.OnError(conn, err)
+}
@@ -0,0 +1,96 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+type welcome struct {
+	Text string
+}
+
+type eventHandler struct {
+	errs []error
+}
+
+func (e *eventHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	return server.NothingAction, nil
+}
+
+func (e *eventHandler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	return nil
+}
+
+func (e *eventHandler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	return server.NothingAction, nil
+}
+
+func (e *eventHandler) OnError(conn server.Connection, err error) server.Action {
+	e.errs = append(e.errs, err)
+	return server.NothingAction
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	assert.Nil(t, r.Register(1, login{}))
+	assert.Nil(t, r.Register(2, logout{}))
+	assert.Nil(t, r.Register(3, welcome{}))
+	assert.Nil(t, r.Register(4, struct{ Ignored bool }{}))
+	events := new(eventHandler)
+	h := NewHandler(r, events)
+	assert.Nil(t, h.Handle(func(msg *login, conn server.Connection) (server.Action, error) {
+		return server.NothingAction, r.Send(conn, welcome{Text: "hi " + msg.User})
+	}))
+	assert.Nil(t, h.Handle(func(msg *logout, conn server.Connection) (server.Action, error) {
+		return server.DisconnectionAction, errors.New(msg.Reason)
+	}))
+	assert.NotNil(t, h.Handle(func(msg login, conn server.Connection) (server.Action, error) {
+		return server.NothingAction, nil
+	}))
+	assert.NotNil(t, h.Handle(func(msg *login) error { return nil }))
+	assert.ErrorIs(t, h.Handle(func(msg *struct{}, conn server.Connection) (server.Action, error) {
+		return server.NothingAction, nil
+	}), ErrTypeNotRegistered)
+
+	harness := servertest.New(h)
+	conn := harness.Connect()
+	frame, _ := r.Marshal(login{User: "alice"})
+	assert.Nil(t, conn.Write(frame))
+	reply, err := r.Unmarshal(conn.Frames()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, reply, &welcome{Text: "hi alice"})
+	// streamed frames are decoded as whole frames when events is not a StreamHandler
+	_, err = h.OnStream(frame[:1], bytes.NewReader(frame[1:]), conn)
+	assert.Nil(t, err)
+	reply, err = r.Unmarshal(conn.Frames()[1])
+	assert.Nil(t, err)
+	assert.Equal(t, reply, &welcome{Text: "hi alice"})
+
+	assert.Nil(t, conn.Write([]byte{0x00, 0x09}))
+	frame, _ = r.Marshal(struct{ Ignored bool }{})
+	assert.Nil(t, conn.Write(frame))
+	assert.Len(t, events.errs, 2)
+	assert.ErrorIs(t, events.errs[0], ErrUnknownType)
+	assert.ErrorIs(t, events.errs[1], ErrHandlerNotFound)
+	assert.False(t, conn.Disconnected())
+
+	frame, _ = r.Marshal(logout{Reason: "bye"})
+	assert.Nil(t, conn.Write(frame))
+	assert.True(t, conn.Disconnected())
+	assert.EqualError(t, events.errs[2], "bye")
+}
+
+func TestHandler_NilEvents(t *testing.T) {
+	h := NewHandler(NewRegistry(), nil)
+	conn := servertest.New(h).Connect()
+	assert.Nil(t, conn.Write([]byte{0x00, 0x01}))
+	assert.ErrorIs(t, conn.Errors()[0], ErrUnknownType)
+	conn.Hangup()
+	assert.True(t, conn.Disconnected())
+}
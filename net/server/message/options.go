@@ -0,0 +1,31 @@
+package message
+
+import (
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Options defined Registry options
+type Options struct {
+	// Serializer is used to Marshal and Unmarshal message payload
+	Serializer server.Serializer
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Serializer: new(server.JSONSerializer),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithSerializer is edit Options Serializer field
+func WithSerializer(serializer server.Serializer) Option {
+	return func(options *Options) {
+		options.Serializer = serializer
+	}
+}
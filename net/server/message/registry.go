@@ -0,0 +1,188 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+var (
+	// ErrTypeExists will throw when register a type or type ID twice
+	ErrTypeExists = errors.New("message type already registered")
+	// ErrTypeNotRegistered will throw when marshal or handle a type not registered
+	ErrTypeNotRegistered = errors.New("message type not registered")
+	// ErrUnknownType will throw when unmarshal a frame of unknown type ID
+	ErrUnknownType = errors.New("unknown message type id")
+	// ErrMalformedFrame will throw when a frame has no valid type ID
+	ErrMalformedFrame = errors.New("malformed message frame")
+)
+
+// kind is the first byte of frame, telling how the type ID encoded
+type kind byte
+
+const (
+	numericKind kind = iota // uvarint type ID follows
+	stringKind              // one byte length and type name follow
+)
+
+// maxNameLength is the max bytes length of string type ID
+const maxNameLength = 1<<8 - 1
+
+type entry struct {
+	typ    reflect.Type
+	header []byte
+}
+
+// Registry maps Go types to type IDs, and converts values to message frames
+// Types are registered by struct or pointer prototypes, values are unmarshaled to pointers of the registered types.
+// It is safe for concurrent use.
+type Registry struct {
+	opts Options
+
+	mu    sync.RWMutex
+	types map[reflect.Type]*entry
+	// headers is keyed by encoded type ID
+	headers map[string]*entry
+}
+
+// NewRegistry will create Registry
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		opts:    newOptions(opts...),
+		types:   make(map[reflect.Type]*entry),
+		headers: make(map[string]*entry),
+	}
+}
+
+// Register will register type of prototype with numeric id
+// When type or id already registered will throw ErrTypeExists error
+func (r *Registry) Register(id uint64, prototype interface{}) error {
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	header[0] = byte(numericKind)
+	n := binary.PutUvarint(header[1:], id)
+	return r.register(header[:1+n], prototype)
+}
+
+// RegisterName will register type of prototype with string name
+// When type or name already registered will throw ErrTypeExists error
+func (r *Registry) RegisterName(name string, prototype interface{}) error {
+	if name == "" || len(name) > maxNameLength {
+		return fmt.Errorf("message type name length %d out of range", len(name))
+	}
+	header := append([]byte{byte(stringKind), byte(len(name))}, name...)
+	return r.register(header, prototype)
+}
+
+func (r *Registry) register(header []byte, prototype interface{}) error {
+	typ := typeOf(prototype)
+	if typ == nil {
+		return errors.New("message prototype is nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.types[typ]; ok {
+		return fmt.Errorf("%w: %s", ErrTypeExists, typ)
+	}
+	if _, ok := r.headers[string(header)]; ok {
+		return fmt.Errorf("%w: %s", ErrTypeExists, formatID(header))
+	}
+	e := &entry{typ: typ, header: header}
+	r.types[typ] = e
+	r.headers[string(header)] = e
+	return nil
+}
+
+// Marshal will encode v as a frame of its type ID and payload
+// The v may be a value or a pointer of registered type.
+func (r *Registry) Marshal(v interface{}) ([]byte, error) {
+	typ := typeOf(v)
+	r.mu.RLock()
+	e, ok := r.types[typ]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrTypeNotRegistered, typ)
+	}
+	payload, err := r.opts.Serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(make([]byte, 0, len(e.header)+len(payload)), e.header...), payload...), nil
+}
+
+// Unmarshal will decode frame to a pointer of the registered type
+// It returns error wrapping ErrUnknownType when type ID not registered.
+func (r *Registry) Unmarshal(frame []byte) (interface{}, error) {
+	n, err := headerLength(frame)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	e, ok := r.headers[string(frame[:n])]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, formatID(frame[:n]))
+	}
+	v := reflect.New(e.typ).Interface()
+	if err := r.opts.Serializer.Unmarshal(frame[n:], v); err != nil {
+		return nil, fmt.Errorf("message %s unmarshal failed: %w", formatID(e.header), err)
+	}
+	return v, nil
+}
+
+// Send will Marshal v and send the frame to conn
+func (r *Registry) Send(conn server.Connection, v interface{}) error {
+	frame, err := r.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return conn.Send(frame, false)
+}
+
+// registered will return whether typ registered
+func (r *Registry) registered(typ reflect.Type) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.types[typ]
+	return ok
+}
+
+// typeOf will return the type of v, the element type when v is a pointer
+func typeOf(v interface{}) reflect.Type {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// headerLength will return the bytes length of type ID at the beginning of frame
+func headerLength(frame []byte) (int, error) {
+	if len(frame) == 0 {
+		return 0, ErrMalformedFrame
+	}
+	switch kind(frame[0]) {
+	case numericKind:
+		if _, n := binary.Uvarint(frame[1:]); n > 0 {
+			return 1 + n, nil
+		}
+	case stringKind:
+		if len(frame) > 1 && frame[1] > 0 && len(frame) >= 2+int(frame[1]) {
+			return 2 + int(frame[1]), nil
+		}
+	}
+	return 0, ErrMalformedFrame
+}
+
+// formatID will format encoded type ID for errors, numeric ID like #1 and string ID quoted
+func formatID(header []byte) string {
+	if kind(header[0]) == numericKind {
+		id, _ := binary.Uvarint(header[1:])
+		return "#" + strconv.FormatUint(id, 10)
+	}
+	return strconv.Quote(string(header[2:]))
+}
@@ -0,0 +1,66 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+type login struct {
+	User string
+}
+
+type logout struct {
+	Reason string
+}
+
+func TestRegistry(t *testing.T) {
+	for name, serializer := range map[string]server.Serializer{"json": new(server.JSONSerializer), "gob": new(server.GobSerializer)} {
+		t.Run("test "+name, func(t *testing.T) {
+			r := NewRegistry(WithSerializer(serializer))
+			assert.Nil(t, r.Register(300, login{}))
+			assert.Nil(t, r.RegisterName("logout", (*logout)(nil)))
+
+			frame, err := r.Marshal(&login{User: "alice"})
+			assert.Nil(t, err)
+			assert.Equal(t, frame[:3], []byte{0x00, 0xac, 0x02})
+			v, err := r.Unmarshal(frame)
+			assert.Nil(t, err)
+			assert.Equal(t, v, &login{User: "alice"})
+
+			frame, err = r.Marshal(logout{Reason: "bye"})
+			assert.Nil(t, err)
+			assert.Equal(t, string(frame[:8]), "\x01\x06logout")
+			v, err = r.Unmarshal(frame)
+			assert.Nil(t, err)
+			assert.Equal(t, v, &logout{Reason: "bye"})
+		})
+	}
+}
+
+func TestRegistry_Errors(t *testing.T) {
+	r := NewRegistry()
+	assert.Nil(t, r.Register(1, login{}))
+	assert.ErrorIs(t, r.Register(2, &login{}), ErrTypeExists)
+	assert.ErrorIs(t, r.Register(1, logout{}), ErrTypeExists)
+	assert.NotNil(t, r.RegisterName("", logout{}))
+	assert.NotNil(t, r.Register(3, nil))
+
+	_, err := r.Marshal(logout{})
+	assert.ErrorIs(t, err, ErrTypeNotRegistered)
+
+	_, err = r.Unmarshal([]byte{0x00, 0x02, '{', '}'})
+	assert.ErrorIs(t, err, ErrUnknownType)
+	assert.EqualError(t, err, "unknown message type id: #2")
+	_, err = r.Unmarshal([]byte("\x01\x02idpayload"))
+	assert.EqualError(t, err, `unknown message type id: "id"`)
+
+	for _, frame := range [][]byte{nil, {0x00}, {0x00, 0x80}, {0x01}, {0x01, 0x00}, {0x01, 0x05, 'a'}, {0x02}} {
+		_, err = r.Unmarshal(frame)
+		assert.ErrorIs(t, err, ErrMalformedFrame, frame)
+	}
+	_, err = r.Unmarshal([]byte{0x00, 0x01, '{'})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MetricsNamespace is the name prefix of metrics written by WritePrometheus
+const MetricsNamespace = "server"
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type metric struct {
+	name string
+	help string
+	kind string
+	// value will return the metric value of address stats
+	value func(AddressStats) float64
+}
+
+var addressMetrics = []metric{
+	{"connections_active", "Connections being served.", "gauge", func(s AddressStats) float64 { return float64(s.Active) }},
+	{"connections_accepted_total", "Connections accepted by listener.", "counter", func(s AddressStats) float64 { return float64(s.Accepted) }},
+	{"connections_rejected_total", "Connections rejected by PROXY protocol, admission or sniffer.", "counter", func(s AddressStats) float64 { return float64(s.Rejected) }},
+	{"received_bytes_total", "Bytes received from clients.", "counter", func(s AddressStats) float64 { return float64(s.BytesIn) }},
+	{"sent_bytes_total", "Bytes sent to clients.", "counter", func(s AddressStats) float64 { return float64(s.BytesOut) }},
+	{"received_frames_total", "Frames decoded from clients.", "counter", func(s AddressStats) float64 { return float64(s.FramesIn) }},
+	{"sent_frames_total", "Frames sent to clients.", "counter", func(s AddressStats) float64 { return float64(s.FramesOut) }},
+	{"decode_errors_total", "Malformed, too large or timed out frames.", "counter", func(s AddressStats) float64 { return float64(s.DecodeErrors) }},
+	{"queue_depth", "Frames queued to send.", "gauge", func(s AddressStats) float64 { return float64(s.QueueDepth) }},
+}
+
+// memoryMetric is metric of server memory budget without address label
+type memoryMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(MemoryStats) float64
+}
+
+var memoryMetrics = []memoryMetric{
+	{"memory_budget_bytes", "Memory budget of connection buffers, zero means unlimited.", "gauge", func(s MemoryStats) float64 { return float64(s.Budget) }},
+	{"memory_used_bytes", "Bytes of read buffers and queued data of connections.", "gauge", func(s MemoryStats) float64 { return float64(s.Used) }},
+	{"memory_throttled_connections", "Connections not reading because memory budget exhausted.", "gauge", func(s MemoryStats) float64 { return float64(s.Throttled) }},
+	{"memory_throttles_total", "Connections throttled by memory budget.", "counter", func(s MemoryStats) float64 { return float64(s.Throttles) }},
+	{"memory_releases_total", "Idle connections released read buffers to the pool.", "counter", func(s MemoryStats) float64 { return float64(s.Releases) }},
+}
+
+// WritePrometheus will write server Stats to w in Prometheus text exposition format
+func (s *netServer) WritePrometheus(w io.Writer) error {
+	return writePrometheus(w, s.Stats())
+}
+
+func writePrometheus(w io.Writer, stats Stats) error {
+	bw := bufio.NewWriter(w)
+	header := func(name, help, kind string) {
+		fmt.Fprintf(bw, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", MetricsNamespace, name, help, MetricsNamespace, name, kind)
+	}
+	for _, m := range addressMetrics {
+		header(m.name, m.help, m.kind)
+		for _, a := range stats.Addresses {
+			fmt.Fprintf(bw, "%s_%s{address=\"%s\"} %g\n", MetricsNamespace, m.name, labelEscaper.Replace(a.Address), m.value(a))
+		}
+	}
+	// labeled will write counter of name for each key of values
+	labeled := func(name, help, label string, values func(AddressStats) map[string]uint64) {
+		header(name, help, "counter")
+		for _, a := range stats.Addresses {
+			counts := values(a)
+			keys := make([]string, 0, len(counts))
+			for key := range counts {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(bw, "%s_%s{address=\"%s\",%s=\"%s\"} %d\n",
+					MetricsNamespace, name, labelEscaper.Replace(a.Address), label, key, counts[key])
+			}
+		}
+	}
+	labeled("actions_total", "Actions executed.", "action", func(s AddressStats) map[string]uint64 { return s.Actions })
+	labeled("disconnects_total", "Connections closed by close code.", "code", func(s AddressStats) map[string]uint64 { return s.Disconnects })
+	header("handler_latency_seconds", "Handler OnReceived latency.", "histogram")
+	for _, a := range stats.Addresses {
+		address := labelEscaper.Replace(a.Address)
+		var cumulative uint64
+		for i, bound := range a.Latency.Bounds {
+			cumulative += a.Latency.Counts[i]
+			fmt.Fprintf(bw, "%s_handler_latency_seconds_bucket{address=\"%s\",le=\"%g\"} %d\n",
+				MetricsNamespace, address, bound.Seconds(), cumulative)
+		}
+		fmt.Fprintf(bw, "%s_handler_latency_seconds_bucket{address=\"%s\",le=\"+Inf\"} %d\n", MetricsNamespace, address, a.Latency.Count)
+		fmt.Fprintf(bw, "%s_handler_latency_seconds_sum{address=\"%s\"} %g\n", MetricsNamespace, address, a.Latency.Sum.Seconds())
+		fmt.Fprintf(bw, "%s_handler_latency_seconds_count{address=\"%s\"} %d\n", MetricsNamespace, address, a.Latency.Count)
+	}
+	for _, m := range memoryMetrics {
+		header(m.name, m.help, m.kind)
+		fmt.Fprintf(bw, "%s_%s %g\n", MetricsNamespace, m.name, m.value(stats.Memory))
+	}
+	return bw.Flush()
+}
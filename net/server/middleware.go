@@ -0,0 +1,287 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnauthenticated will throw when a connection not pass Authenticate handshake
+var ErrUnauthenticated = errors.New("connection unauthenticated")
+
+// Middleware is wrapping a Handler to add behaviours
+type Middleware func(handler Handler) Handler
+
+// Chain will wrap handler by middlewares
+// The first middleware is the outermost, it sees events before the others.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// PanicError is the error converted from a Handler panic
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", p.Value)
+}
+
+type recoveryHandler struct {
+	Handler
+}
+
+// Recovery will recover Handler panic and report it to OnError as PanicError
+// A panic of OnError will disconnect the connection.
+func Recovery() Middleware {
+	return func(handler Handler) Handler {
+		return &recoveryHandler{Handler: handler}
+	}
+}
+
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
+
+func (r *recoveryHandler) OnConnected(conn Connection) (action Action, err error) {
+	defer recoverError(&err)
+	return r.Handler.OnConnected(conn)
+}
+
+func (r *recoveryHandler) OnDisconnected(conn Connection, reason *CloseReason) (err error) {
+	defer recoverError(&err)
+	return r.Handler.OnDisconnected(conn, reason)
+}
+
+func (r *recoveryHandler) OnReceived(frame []byte, conn Connection) (action Action, err error) {
+	defer recoverError(&err)
+	return r.Handler.OnReceived(frame, conn)
+}
+
+func (r *recoveryHandler) OnStream(header []byte, body io.Reader, conn Connection) (action Action, err error) {
+	defer recoverError(&err)
+	return ForwardStream(r.Handler, header, body, conn)
+}
+
+func (r *recoveryHandler) OnError(conn Connection, err error) (action Action) {
+	defer func() {
+		if v := recover(); v != nil {
+			conn.Logger().ErrorF("handler OnError panic: %v\n%s", v, debug.Stack())
+			action = DisconnectionAction
+		}
+	}()
+	return r.Handler.OnError(conn, err)
+}
+
+type accessStat struct {
+	connected time.Time
+	frames    uint64
+	bytes     uint64
+}
+
+type accessLogHandler struct {
+	Handler
+	stats sync.Map
+}
+
+// AccessLog will log connection events through Connection Logger
+// Connected and disconnected are logged at info level with traffic fields,
+// every received frame is logged at debug level with its handle latency.
+func AccessLog() Middleware {
+	return func(handler Handler) Handler {
+		return &accessLogHandler{Handler: handler}
+	}
+}
+
+func (a *accessLogHandler) OnConnected(conn Connection) (Action, error) {
+	a.stats.Store(conn, &accessStat{connected: time.Now()})
+	conn.Logger().InfoF("connected")
+	return a.Handler.OnConnected(conn)
+}
+
+func (a *accessLogHandler) OnDisconnected(conn Connection, reason *CloseReason) error {
+	l := conn.Logger()
+	if v, ok := a.stats.LoadAndDelete(conn); ok {
+		stat := v.(*accessStat)
+		l = l.WithField("duration", time.Since(stat.connected).String()).
+			WithField("frames_in", atomic.LoadUint64(&stat.frames)).
+			WithField("bytes_in", atomic.LoadUint64(&stat.bytes))
+	}
+	l.InfoF("disconnected")
+	return a.Handler.OnDisconnected(conn, reason)
+}
+
+func (a *accessLogHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	if v, ok := a.stats.Load(conn); ok {
+		stat := v.(*accessStat)
+		atomic.AddUint64(&stat.frames, 1)
+		atomic.AddUint64(&stat.bytes, uint64(len(frame)))
+	}
+	start := time.Now()
+	action, err := a.Handler.OnReceived(frame, conn)
+	conn.Logger().WithField("bytes", len(frame)).WithField("latency", time.Since(start).String()).
+		WithField("action", int(action)).DebugF("received")
+	return action, err
+}
+
+func (a *accessLogHandler) OnStream(header []byte, body io.Reader, conn Connection) (Action, error) {
+	counter := &countReader{Reader: body, n: uint64(len(header))}
+	start := time.Now()
+	action, err := ForwardStream(a.Handler, header, counter, conn)
+	if v, ok := a.stats.Load(conn); ok {
+		stat := v.(*accessStat)
+		atomic.AddUint64(&stat.frames, 1)
+		atomic.AddUint64(&stat.bytes, counter.n)
+	}
+	conn.Logger().WithField("bytes", counter.n).WithField("latency", time.Since(start).String()).
+		WithField("action", int(action)).DebugF("streamed")
+	return action, err
+}
+
+func (a *accessLogHandler) OnError(conn Connection, err error) Action {
+	conn.Logger().WithField("error", err.Error()).ErrorF("error")
+	return a.Handler.OnError(conn, err)
+}
+
+// countReader is io.Reader counting bytes read
+type countReader struct {
+	io.Reader
+	n uint64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// LatencyRecorder is recording OnReceived latency Histogram of each connection
+type LatencyRecorder struct {
+	bounds []time.Duration
+	total  *Histogram
+	conns  sync.Map
+}
+
+// NewLatencyRecorder will create LatencyRecorder with Histogram bucket bounds
+// When bounds empty, DefaultLatencyBuckets is used.
+func NewLatencyRecorder(bounds ...time.Duration) *LatencyRecorder {
+	return &LatencyRecorder{
+		bounds: bounds,
+		total:  NewHistogram(bounds...),
+	}
+}
+
+// Histogram will return the Histogram of a connected connection
+func (l *LatencyRecorder) Histogram(conn Connection) (*Histogram, bool) {
+	v, ok := l.conns.Load(conn)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Histogram), true
+}
+
+// Total will return the Histogram of all connections, include disconnected
+func (l *LatencyRecorder) Total() *Histogram {
+	return l.total
+}
+
+type latencyHandler struct {
+	Handler
+	recorder *LatencyRecorder
+}
+
+// Latency will record OnReceived latency to recorder
+func Latency(recorder *LatencyRecorder) Middleware {
+	return func(handler Handler) Handler {
+		return &latencyHandler{Handler: handler, recorder: recorder}
+	}
+}
+
+func (l *latencyHandler) OnConnected(conn Connection) (Action, error) {
+	l.recorder.conns.Store(conn, NewHistogram(l.recorder.bounds...))
+	return l.Handler.OnConnected(conn)
+}
+
+func (l *latencyHandler) OnDisconnected(conn Connection, reason *CloseReason) error {
+	l.recorder.conns.Delete(conn)
+	return l.Handler.OnDisconnected(conn, reason)
+}
+
+func (l *latencyHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	start := time.Now()
+	action, err := l.Handler.OnReceived(frame, conn)
+	l.observe(conn, time.Since(start))
+	return action, err
+}
+
+func (l *latencyHandler) OnStream(header []byte, body io.Reader, conn Connection) (Action, error) {
+	start := time.Now()
+	action, err := ForwardStream(l.Handler, header, body, conn)
+	l.observe(conn, time.Since(start))
+	return action, err
+}
+
+// observe will record d to the Histogram of conn and the total
+func (l *latencyHandler) observe(conn Connection, d time.Duration) {
+	if h, ok := l.recorder.Histogram(conn); ok {
+		h.Observe(d)
+	}
+	l.recorder.total.Observe(d)
+}
+
+// Handshake is check frames of a connection before it authenticated
+// It returns true when connection authenticated, false when more handshake frames needed.
+// An error will reject the connection.
+type Handshake func(frame []byte, conn Connection) (bool, error)
+
+type authenticateHandler struct {
+	Handler
+	handshake     Handshake
+	authenticated sync.Map
+}
+
+// Authenticate will pass frames to handshake until it succeeds
+// Frames are not received by the wrapped Handler before authenticated.
+// When handshake failed, the error wrapping ErrUnauthenticated reports to OnError and connection disconnected.
+func Authenticate(handshake Handshake) Middleware {
+	return func(handler Handler) Handler {
+		return &authenticateHandler{Handler: handler, handshake: handshake}
+	}
+}
+
+func (a *authenticateHandler) OnDisconnected(conn Connection, reason *CloseReason) error {
+	a.authenticated.Delete(conn)
+	return a.Handler.OnDisconnected(conn, reason)
+}
+
+func (a *authenticateHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	if _, ok := a.authenticated.Load(conn); ok {
+		return a.Handler.OnReceived(frame, conn)
+	}
+	ok, err := a.handshake(frame, conn)
+	if err != nil {
+		return DisconnectionAction, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	if ok {
+		a.authenticated.Store(conn, struct{}{})
+	}
+	return NothingAction, nil
+}
+
+// OnStream will pass streamed frames to handshake as whole frames before authenticated
+func (a *authenticateHandler) OnStream(header []byte, body io.Reader, conn Connection) (Action, error) {
+	if _, ok := a.authenticated.Load(conn); ok {
+		return ForwardStream(a.Handler, header, body, conn)
+	}
+	return ReceiveStream(a.OnReceived, header, body, conn)
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+)
+
+type testConnection struct {
+	sent     [][]byte
+	closed   bool
+	identity string
+	logger   logger.Logger
+}
+
+func newTestConnection() *testConnection {
+	return &testConnection{logger: logger.NewLogger(logger.WithWriter(io.Discard))}
+}
+
+func (t *testConnection) Send(data []byte, withoutEncode bool) error {
+	t.sent = append(t.sent, data)
+	return nil
+}
+
+func (t *testConnection) SendWait(data []byte, withoutEncode bool) error {
+	return t.Send(append([]byte(nil), data...), withoutEncode)
+}
+
+func (t *testConnection) SendFile(f *os.File, offset, length int64) error {
+	b := make([]byte, length)
+	if _, err := f.ReadAt(b, offset); err != nil {
+		return err
+	}
+	t.sent = append(t.sent, b)
+	return nil
+}
+
+func (t *testConnection) SendStream(header []byte, length int64, body io.Reader) error {
+	b, err := io.ReadAll(io.LimitReader(body, length))
+	if err != nil {
+		return err
+	}
+	t.sent = append(t.sent, append(header, b...))
+	return nil
+}
+
+func (t *testConnection) SetIdentity(identity string) {
+	t.identity = identity
+}
+
+func (t *testConnection) BufferCapacity() int {
+	return buffer.DefaultBufferCapacity
+}
+
+func (t *testConnection) Identity() string {
+	return t.identity
+}
+
+func (t *testConnection) Close() error {
+	t.closed = true
+	return nil
+}
+
+func (t *testConnection) CloseWrite() error {
+	return nil
+}
+
+func (t *testConnection) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (t *testConnection) PauseRead() {}
+
+func (t *testConnection) ResumeRead() {}
+
+func (t *testConnection) Closed() bool {
+	return t.closed
+}
+
+func (t *testConnection) Remote() string {
+	return "remote"
+}
+
+func (t *testConnection) Local() string {
+	return "local"
+}
+
+func (t *testConnection) Logger() logger.Logger {
+	return t.logger
+}
+
+// recordHandler will record events as strings
+type recordHandler struct {
+	name   string
+	events *[]string
+	panic  bool
+}
+
+func (r *recordHandler) OnConnected(conn Connection) (Action, error) {
+	*r.events = append(*r.events, r.name+" connected")
+	return NothingAction, nil
+}
+
+func (r *recordHandler) OnDisconnected(conn Connection, reason *CloseReason) error {
+	*r.events = append(*r.events, r.name+" disconnected "+reason.Code.String())
+	return nil
+}
+
+func (r *recordHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	if r.panic {
+		panic("boom")
+	}
+	*r.events = append(*r.events, r.name+" received "+string(frame))
+	return NothingAction, nil
+}
+
+func (r *recordHandler) OnError(conn Connection, err error) Action {
+	if r.panic {
+		panic("boom")
+	}
+	*r.events = append(*r.events, r.name+" error "+err.Error())
+	return NothingAction
+}
+
+func recordMiddleware(name string, events *[]string) Middleware {
+	return func(handler Handler) Handler {
+		return &namedHandler{Handler: handler, name: name, events: events}
+	}
+}
+
+type namedHandler struct {
+	Handler
+	name   string
+	events *[]string
+}
+
+func (n *namedHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	*n.events = append(*n.events, n.name)
+	return n.Handler.OnReceived(frame, conn)
+}
+
+func TestChain(t *testing.T) {
+	var events []string
+	h := Chain(&recordHandler{name: "h", events: &events}, recordMiddleware("a", &events), recordMiddleware("b", &events))
+	h.OnReceived([]byte("x"), newTestConnection())
+	assert.Equal(t, events, []string{"a", "b", "h received x"})
+	assert.Equal(t, Chain(h), h)
+}
+
+func TestRecovery(t *testing.T) {
+	var events []string
+	h := Chain(&recordHandler{name: "h", events: &events, panic: true}, Recovery())
+	conn := newTestConnection()
+	action, err := h.OnReceived([]byte("x"), conn)
+	assert.Equal(t, action, NothingAction)
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, panicErr.Value, "boom")
+	assert.NotEmpty(t, panicErr.Stack)
+	assert.Equal(t, err.Error(), "handler panic: boom")
+	assert.Equal(t, h.OnError(conn, err), DisconnectionAction)
+	_, err = h.OnConnected(conn)
+	assert.Nil(t, err)
+	assert.Nil(t, h.OnDisconnected(conn, NewCloseReason(ClosePeer, nil)))
+}
+
+func TestAccessLog(t *testing.T) {
+	var events []string
+	var out bytes.Buffer
+	conn := newTestConnection()
+	conn.logger = logger.NewLogger(logger.WithWriter(&out), logger.WithLevel(logger.Debug))
+	h := Chain(&recordHandler{name: "h", events: &events}, AccessLog())
+	h.OnConnected(conn)
+	h.OnReceived([]byte("hello"), conn)
+	h.OnError(conn, errors.New("oops"))
+	h.OnDisconnected(conn, NewCloseReason(ClosePeer, nil))
+	assert.Equal(t, events, []string{"h connected", "h received hello", "h error oops", "h disconnected peer_closed"})
+	log := out.String()
+	assert.Contains(t, log, `"msg":"connected"`)
+	assert.Contains(t, log, `"msg":"received"`)
+	assert.Contains(t, log, `"error":"oops"`)
+	assert.Contains(t, log, `"bytes_in":5`)
+	assert.Contains(t, log, `"frames_in":1`)
+}
+
+func TestLatency(t *testing.T) {
+	var events []string
+	recorder := NewLatencyRecorder()
+	h := Chain(&recordHandler{name: "h", events: &events}, Latency(recorder))
+	conn := newTestConnection()
+	h.OnConnected(conn)
+	h.OnReceived([]byte("a"), conn)
+	h.OnReceived([]byte("b"), conn)
+	hist, ok := recorder.Histogram(conn)
+	assert.True(t, ok)
+	assert.Equal(t, hist.Snapshot().Count, uint64(2))
+	h.OnDisconnected(conn, NewCloseReason(ClosePeer, nil))
+	_, ok = recorder.Histogram(conn)
+	assert.False(t, ok)
+	assert.Equal(t, recorder.Total().Snapshot().Count, uint64(2))
+}
+
+func TestAuthenticate(t *testing.T) {
+	var events []string
+	h := Chain(&recordHandler{name: "h", events: &events}, Authenticate(func(frame []byte, conn Connection) (bool, error) {
+		switch string(frame) {
+		case "hello":
+			return false, nil
+		case "token":
+			return true, nil
+		}
+		return false, errors.New("bad token")
+	}))
+	conn := newTestConnection()
+	h.OnConnected(conn)
+	action, err := h.OnReceived([]byte("hello"), conn)
+	assert.Equal(t, action, NothingAction)
+	assert.Nil(t, err)
+	action, err = h.OnReceived([]byte("token"), conn)
+	assert.Equal(t, action, NothingAction)
+	assert.Nil(t, err)
+	h.OnReceived([]byte("data"), conn)
+	assert.Equal(t, events, []string{"h connected", "h received data"})
+
+	other := newTestConnection()
+	action, err = h.OnReceived([]byte("data"), other)
+	assert.Equal(t, action, DisconnectionAction)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	h.OnDisconnected(conn, NewCloseReason(ClosePeer, nil))
+	action, err = h.OnReceived([]byte("data"), conn)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
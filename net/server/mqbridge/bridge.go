@@ -0,0 +1,155 @@
+package mqbridge
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jarod2011/toolkit/mq"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// subscription is a topic subscribed by a connection
+type subscription struct {
+	ch   chan interface{}
+	done chan struct{}
+}
+
+type subscriber struct {
+	mu     sync.Mutex
+	topics map[string]*subscription
+}
+
+// Bridge is a server.Handler which forwards broker messages to subscribed connections
+type Bridge struct {
+	broker mq.Broker
+	opts   Options
+	conns  sync.Map
+}
+
+// NewBridge will create Bridge of broker
+func NewBridge(broker mq.Broker, opts ...Option) *Bridge {
+	return &Bridge{
+		broker: broker,
+		opts:   newOptions(opts...),
+	}
+}
+
+func (b *Bridge) OnConnected(conn server.Connection) (server.Action, error) {
+	b.conns.Store(conn, &subscriber{topics: make(map[string]*subscription)})
+	return server.NothingAction, nil
+}
+
+func (b *Bridge) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	v, ok := b.conns.LoadAndDelete(conn)
+	if !ok {
+		return nil
+	}
+	sub := v.(*subscriber)
+	// broker is not called under lock, it may block until a message delivered
+	sub.mu.Lock()
+	subs := make([]*subscription, 0, len(sub.topics))
+	for topic, s := range sub.topics {
+		subs = append(subs, s)
+		delete(sub.topics, topic)
+	}
+	sub.mu.Unlock()
+	var err error
+	for _, s := range subs {
+		if e := b.unsubscribe(s); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (b *Bridge) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	if len(frame) == 0 || len(frame)-1 > maxTopicLength {
+		return server.NothingAction, ErrMalformedFrame
+	}
+	v, ok := b.conns.Load(conn)
+	if !ok {
+		return server.NothingAction, nil
+	}
+	sub := v.(*subscriber)
+	topic := string(frame[1:])
+	switch op(frame[0]) {
+	case subscribeOp:
+		return server.NothingAction, b.subscribe(sub, conn, topic)
+	case unsubscribeOp:
+		sub.mu.Lock()
+		s, ok := sub.topics[topic]
+		delete(sub.topics, topic)
+		sub.mu.Unlock()
+		if ok {
+			return server.NothingAction, b.unsubscribe(s)
+		}
+		return server.NothingAction, nil
+	}
+	return server.NothingAction, ErrMalformedFrame
+}
+
+func (b *Bridge) OnError(conn server.Connection, err error) server.Action {
+	conn.Logger().ErrorF("mq bridge error: %v", err)
+	if errors.Is(err, ErrMalformedFrame) {
+		return server.DisconnectionAction
+	}
+	return server.NothingAction
+}
+
+func (b *Bridge) subscribe(sub *subscriber, conn server.Connection, topic string) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if _, ok := sub.topics[topic]; ok {
+		return nil
+	}
+	s := &subscription{
+		ch:   make(chan interface{}, b.opts.Capacity),
+		done: make(chan struct{}),
+	}
+	opts := []mq.Option{mq.WithTimeout(b.opts.Timeout)}
+	if topic != "" {
+		opts = append(opts, mq.WithTopic(topic))
+	} else {
+		// messages of all topics are pushed with their topics
+		opts = append(opts, mq.WithMessage())
+	}
+	if err := b.broker.Subscribe(s.ch, opts...); err != nil {
+		return err
+	}
+	sub.topics[topic] = s
+	go b.forward(conn, topic, s)
+	return nil
+}
+
+// unsubscribe will stop forward goroutine
+// The channel is not closed, broker may still publish remaining messages after closed.
+func (b *Bridge) unsubscribe(s *subscription) error {
+	close(s.done)
+	err := b.broker.Unsubscribe(s.ch)
+	if errors.Is(err, mq.ErrBrokerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (b *Bridge) forward(conn server.Connection, topic string, s *subscription) {
+	for {
+		select {
+		case v := <-s.ch:
+			name := topic
+			if msg, ok := v.(*mq.Message); ok {
+				name, v = msg.Topic, msg.Value
+			}
+			payload, err := b.opts.Serializer.Marshal(v)
+			if err != nil {
+				conn.Logger().ErrorF("mq bridge marshal message of topic %q failed: %v", name, err)
+				continue
+			}
+			if err := conn.Send(messageFrame(name, payload), false); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package mqbridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/mq"
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+// waitFrames will wait conn sent n frames and return them
+func waitFrames(t *testing.T, conn *servertest.Conn, n int) [][]byte {
+	for i := 0; i < 100 && len(conn.Frames()) < n; i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	frames := conn.Frames()
+	assert.Len(t, frames, n)
+	return frames
+}
+
+func TestBridge(t *testing.T) {
+	broker := mq.NewMemoryBroker(context.TODO(), 10)
+	defer broker.Close()
+	h := servertest.New(NewBridge(broker))
+	c1, c2 := h.Connect(), h.Connect()
+	assert.Nil(t, c1.Write(SubscribeFrame("event")))
+	assert.Nil(t, c1.Write(SubscribeFrame("event")))
+	assert.Nil(t, c2.Write(SubscribeFrame("")))
+	time.Sleep(time.Millisecond * 10)
+
+	broker.Publish(map[string]int{"count": 1}, mq.WithTopic("event"))
+	broker.Publish("other", mq.WithTopic("other"))
+	frames := waitFrames(t, c1, 1)
+	topic, payload, err := ParseMessage(frames[0])
+	assert.Nil(t, err)
+	assert.Equal(t, topic, "event")
+	assert.Equal(t, string(payload), `{"count":1}`)
+	frames = waitFrames(t, c2, 2)
+	topic, _, _ = ParseMessage(frames[0])
+	assert.Equal(t, topic, "event")
+	topic, payload, _ = ParseMessage(frames[1])
+	assert.Equal(t, topic, "other")
+	assert.Equal(t, string(payload), `"other"`)
+
+	assert.Nil(t, c1.Write(UnsubscribeFrame("event")))
+	assert.Nil(t, c1.Write(UnsubscribeFrame("none")))
+	broker.Publish(2, mq.WithTopic("event"))
+	waitFrames(t, c2, 3)
+	assert.Len(t, c1.Frames(), 1)
+
+	c2.Hangup()
+	broker.Publish(3, mq.WithTopic("event"))
+	time.Sleep(time.Millisecond * 10)
+	assert.Len(t, c2.Frames(), 3)
+}
+
+func TestBridge_Malformed(t *testing.T) {
+	broker := mq.NewMemoryBroker(context.TODO(), 10)
+	defer broker.Close()
+	h := servertest.New(NewBridge(broker))
+	conn := h.Connect()
+	assert.Nil(t, conn.Write([]byte{0x09, 'a'}))
+	assert.True(t, conn.Disconnected())
+	assert.ErrorIs(t, conn.Errors()[0], ErrMalformedFrame)
+	assert.Equal(t, conn.Actions()[len(conn.Actions())-1], server.DisconnectionAction)
+}
+
+func TestBridge_BrokerClosed(t *testing.T) {
+	broker := mq.NewMemoryBroker(context.TODO(), 10)
+	h := servertest.New(NewBridge(broker, WithSerializer(new(server.GobSerializer)), WithTimeout(time.Millisecond), WithCapacity(1)))
+	conn := h.Connect()
+	assert.Nil(t, conn.Write(SubscribeFrame("event")))
+	broker.Close()
+	time.Sleep(time.Millisecond * 10)
+	conn.Hangup()
+	assert.Empty(t, conn.Errors())
+
+	conn = h.Connect()
+	assert.Nil(t, conn.Write(SubscribeFrame("event")))
+	assert.ErrorIs(t, conn.Errors()[0], mq.ErrBrokerClosed)
+}
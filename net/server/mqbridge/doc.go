@@ -0,0 +1,5 @@
+// Package mqbridge is pushing mq.Broker messages to network clients.
+// Bridge is a server.Handler, a connection subscribes and unsubscribes topics by frames
+// built with SubscribeFrame and UnsubscribeFrame, and receives messages of subscribed topics
+// as frames parsed by ParseMessage. All subscriptions of a connection are unsubscribed when it disconnected.
+package mqbridge
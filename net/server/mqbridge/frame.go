@@ -0,0 +1,54 @@
+package mqbridge
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformedFrame will throw when a frame can not be parsed
+var ErrMalformedFrame = errors.New("malformed mq bridge frame")
+
+// op is the first byte of frame
+type op byte
+
+const (
+	subscribeOp   op = iota + 1 // client subscribe a topic
+	unsubscribeOp               // client unsubscribe a topic
+	messageOp                   // server push a message
+)
+
+// maxTopicLength is the max bytes length of topic
+const maxTopicLength = 1<<16 - 1
+
+// SubscribeFrame will build the frame to subscribe topic
+// The empty topic means subscribe messages of all topics.
+func SubscribeFrame(topic string) []byte {
+	return append([]byte{byte(subscribeOp)}, topic...)
+}
+
+// UnsubscribeFrame will build the frame to unsubscribe topic
+func UnsubscribeFrame(topic string) []byte {
+	return append([]byte{byte(unsubscribeOp)}, topic...)
+}
+
+func messageFrame(topic string, payload []byte) []byte {
+	b := make([]byte, 3+len(topic)+len(payload))
+	b[0] = byte(messageOp)
+	binary.BigEndian.PutUint16(b[1:3], uint16(len(topic)))
+	copy(b[3:], topic)
+	copy(b[3+len(topic):], payload)
+	return b
+}
+
+// ParseMessage will parse a message frame pushed by Bridge
+// The topic is the topic which the message published with, it is empty when published without topic.
+func ParseMessage(frame []byte) (topic string, payload []byte, err error) {
+	if len(frame) < 3 || op(frame[0]) != messageOp {
+		return "", nil, ErrMalformedFrame
+	}
+	size := int(binary.BigEndian.Uint16(frame[1:3]))
+	if len(frame) < 3+size {
+		return "", nil, ErrMalformedFrame
+	}
+	return string(frame[3 : 3+size]), frame[3+size:], nil
+}
@@ -0,0 +1,26 @@
+package mqbridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessage(t *testing.T) {
+	topic, payload, err := ParseMessage(messageFrame("event", []byte("hello")))
+	assert.Nil(t, err)
+	assert.Equal(t, topic, "event")
+	assert.Equal(t, string(payload), "hello")
+	topic, payload, err = ParseMessage(messageFrame("", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, topic, "")
+	assert.Empty(t, payload)
+	for _, invalid := range [][]byte{
+		{byte(messageOp), 0x00},
+		{byte(messageOp), 0x00, 0x02, 'a'},
+		SubscribeFrame("event"),
+	} {
+		_, _, err = ParseMessage(invalid)
+		assert.ErrorIs(t, err, ErrMalformedFrame)
+	}
+}
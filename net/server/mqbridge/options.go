@@ -0,0 +1,55 @@
+package mqbridge
+
+import (
+	"time"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Options defined Bridge options
+type Options struct {
+	// Serializer is used to Marshal messages to frame payload
+	Serializer server.Serializer
+	// Timeout is the subscribe timeout passed by mq.WithTimeout
+	// A message is dropped for a connection when it can not be received in time,
+	// so a slow connection never blocks the broker.
+	Timeout time.Duration
+	// Capacity is the channel capacity of each subscription
+	Capacity int
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Serializer: new(server.JSONSerializer),
+		Timeout:    time.Second,
+		Capacity:   64,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithSerializer is edit Options Serializer field
+func WithSerializer(serializer server.Serializer) Option {
+	return func(options *Options) {
+		options.Serializer = serializer
+	}
+}
+
+// WithTimeout is edit Options Timeout field
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+// WithCapacity is edit Options Capacity field
+func WithCapacity(capacity int) Option {
+	return func(options *Options) {
+		options.Capacity = capacity
+	}
+}
@@ -0,0 +1,5 @@
+// Package mux is multiplexing many logical bidirectional streams over a single connection.
+// Each Stream has its own flow control window, and can be half closed or reset independently.
+// A Session runs on a net.Conn (see Client and Server) or on a server.Connection (see NewHandler),
+// and sends keepalive pings to detect dead peers.
+package mux
@@ -0,0 +1,95 @@
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+// ErrProtocol will throw when receive an invalid frame
+var ErrProtocol = errors.New("mux protocol error")
+
+type frameType byte
+
+const (
+	typeData         frameType = iota // stream payload, length is payload size
+	typeWindowUpdate                  // grant peer more send window, length is the delta
+	typePing                          // keepalive, length is the ping id
+	typeGoAway                        // session is closing
+)
+
+const (
+	flagSYN uint8 = 1 << iota // open a stream or a ping
+	flagACK                   // acknowledge a stream or a ping
+	flagFIN                   // half close a stream
+	flagRST                   // reset a stream
+)
+
+// headerSize is size of type(1) + flags(1) + stream id(4) + length(4)
+const headerSize = 10
+
+type frame struct {
+	typ      frameType
+	flags    uint8
+	streamID uint32
+	length   uint32
+	payload  []byte
+}
+
+func (f *frame) marshal() []byte {
+	b := make([]byte, headerSize+len(f.payload))
+	b[0] = byte(f.typ)
+	b[1] = f.flags
+	binary.BigEndian.PutUint32(b[2:6], f.streamID)
+	binary.BigEndian.PutUint32(b[6:10], f.length)
+	copy(b[headerSize:], f.payload)
+	return b
+}
+
+func parseFrame(b []byte) (*frame, error) {
+	if len(b) < headerSize {
+		return nil, ErrProtocol
+	}
+	f := &frame{
+		typ:      frameType(b[0]),
+		flags:    b[1],
+		streamID: binary.BigEndian.Uint32(b[2:6]),
+		length:   binary.BigEndian.Uint32(b[6:10]),
+		payload:  b[headerSize:],
+	}
+	if f.typ > typeGoAway {
+		return nil, ErrProtocol
+	}
+	if f.typ == typeData && int(f.length) != len(f.payload) {
+		return nil, ErrProtocol
+	}
+	return f, nil
+}
+
+// Codec is server.Codec of mux frames
+// The server serving NewHandler must use this Codec.
+type Codec struct {
+}
+
+// Encode will return b directly, mux frames are already encoded
+func (c *Codec) Encode(b []byte) []byte {
+	return b
+}
+
+// Decode will return a whole mux frame when it is in buffer
+func (c *Codec) Decode(buf buffer.Buffer) []byte {
+	n, h := buf.NextN(headerSize)
+	if n < headerSize {
+		return nil
+	}
+	size := headerSize
+	if frameType(h[0]) == typeData {
+		size += int(binary.BigEndian.Uint32(h[6:10]))
+	}
+	if buf.Size() < size {
+		return nil
+	}
+	_, b := buf.ReadN(size)
+	return append([]byte{}, b...)
+}
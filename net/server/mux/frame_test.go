@@ -0,0 +1,43 @@
+package mux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+func TestFrame(t *testing.T) {
+	f := &frame{typ: typeData, flags: flagSYN | flagFIN, streamID: 3, length: 2, payload: []byte{0x01, 0x02}}
+	b := f.marshal()
+	assert.Equal(t, len(b), headerSize+2)
+	got, err := parseFrame(b)
+	assert.Nil(t, err)
+	assert.Equal(t, got, f)
+
+	_, err = parseFrame(b[:headerSize-1])
+	assert.ErrorIs(t, err, ErrProtocol)
+	_, err = parseFrame(b[:headerSize+1])
+	assert.ErrorIs(t, err, ErrProtocol)
+	b[0] = 0xff
+	_, err = parseFrame(b)
+	assert.ErrorIs(t, err, ErrProtocol)
+}
+
+func TestCodec(t *testing.T) {
+	codec := new(Codec)
+	data := (&frame{typ: typeData, streamID: 1, length: 3, payload: []byte{0x01, 0x02, 0x03}}).marshal()
+	ping := (&frame{typ: typePing, flags: flagSYN, length: 7}).marshal()
+	assert.EqualValues(t, codec.Encode(data), data)
+	buf := buffer.NewBuffer(100)
+	buf.Write(data[:headerSize-1])
+	assert.Nil(t, codec.Decode(buf))
+	buf.Write(data[headerSize-1 : headerSize+1])
+	assert.Nil(t, codec.Decode(buf))
+	buf.Write(data[headerSize+1:])
+	buf.Write(ping)
+	assert.EqualValues(t, codec.Decode(buf), data)
+	assert.EqualValues(t, codec.Decode(buf), ping)
+	assert.Equal(t, buf.Size(), 0)
+}
@@ -0,0 +1,64 @@
+package mux
+
+import (
+	"sync"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+type handler struct {
+	opts     Options
+	serve    func(session *Session)
+	sessions sync.Map
+}
+
+// NewHandler will create a server.Handler which runs a server side Session on every connection
+// The serve function will be called in a new goroutine when connection connected,
+// it usually loops Session Accept until error. The Session closed when connection disconnected,
+// and the connection closed when Session closed.
+// The server must use Codec as its Codec, and its BufferCapacity must hold a whole frame,
+// see Options MaxFrameSize. Both of the defaults fit.
+func NewHandler(serve func(session *Session), opts ...Option) server.Handler {
+	return &handler{
+		opts:  newOptions(opts...),
+		serve: serve,
+	}
+}
+
+func (h *handler) OnConnected(conn server.Connection) (server.Action, error) {
+	s := newSession(func(b []byte) error {
+		return conn.Send(b, false)
+	}, conn.Close, false, h.opts)
+	h.sessions.Store(conn, s)
+	s.start()
+	go h.serve(s)
+	return server.NothingAction, nil
+}
+
+func (h *handler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	if v, ok := h.sessions.LoadAndDelete(conn); ok {
+		v.(*Session).closeWithErr(ErrSessionClosed)
+	}
+	return nil
+}
+
+func (h *handler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	v, ok := h.sessions.Load(conn)
+	if !ok {
+		return server.NothingAction, nil
+	}
+	s := v.(*Session)
+	if err := s.handleFrame(frame); err != nil {
+		s.closeWithErr(err)
+		return server.DisconnectionAction, err
+	}
+	if s.IsClosed() {
+		return server.DisconnectionAction, nil
+	}
+	return server.NothingAction, nil
+}
+
+func (h *handler) OnError(conn server.Connection, err error) server.Action {
+	conn.Logger().ErrorF("mux error: %v", err)
+	return server.NothingAction
+}
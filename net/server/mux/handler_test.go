@@ -0,0 +1,173 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+// pipeConnection is Connection writing to a net.Conn, methods not used by handler are left unimplemented
+type pipeConnection struct {
+	server.Connection
+	conn net.Conn
+}
+
+func (p *pipeConnection) Send(data []byte, withoutEncode bool) error {
+	_, err := p.conn.Write(data)
+	return err
+}
+
+func (p *pipeConnection) Remote() string {
+	return "pipe"
+}
+
+func (p *pipeConnection) Local() string {
+	return "pipe"
+}
+
+func (p *pipeConnection) Logger() logger.Logger {
+	return logger.NewLogger(logger.WithWriter(io.Discard))
+}
+
+func (p *pipeConnection) Close() error {
+	return p.conn.Close()
+}
+
+func TestNewHandler(t *testing.T) {
+	c1, c2 := net.Pipe()
+	h := NewHandler(func(session *Session) {
+		for {
+			st, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(st, st)
+				st.Close()
+			}()
+		}
+	}, WithKeepAlive(0, 0))
+	go func() {
+		conn := &pipeConnection{conn: c1}
+		h.OnConnected(conn)
+		defer h.OnDisconnected(conn, nil)
+		codec := new(Codec)
+		buf := buffer.NewBuffer(headerSize + initialWindow)
+		b := make([]byte, buf.Capacity())
+		for {
+			n, err := c1.Read(b[:buf.Capacity()-buf.Size()])
+			if err != nil {
+				return
+			}
+			buf.Write(b[:n])
+			for buf.Size() > 0 {
+				frame := codec.Decode(buf)
+				if frame == nil {
+					break
+				}
+				if action, _ := h.OnReceived(frame, conn); action == server.DisconnectionAction {
+					c1.Close()
+					return
+				}
+			}
+		}
+	}()
+	client := Client(c2)
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		st, err := client.Open()
+		assert.Nil(t, err)
+		_, err = st.Write([]byte("hello"))
+		assert.Nil(t, err)
+		assert.Nil(t, st.Close())
+		b, err := io.ReadAll(st)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), "hello")
+	}
+}
+
+func TestNewHandler_Harness(t *testing.T) {
+	h := NewHandler(func(session *Session) {
+		for {
+			st, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(st, st)
+				st.Close()
+			}()
+		}
+	}, WithKeepAlive(0, 0))
+	conn, _ := servertest.New(h, servertest.WithCodec(new(Codec))).Pipe()
+	client := Client(conn)
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		st, err := client.Open()
+		assert.Nil(t, err)
+		_, err = st.Write([]byte("hello"))
+		assert.Nil(t, err)
+		assert.Nil(t, st.Close())
+		b, err := io.ReadAll(st)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), "hello")
+	}
+}
+
+func TestNewHandler_Server(t *testing.T) {
+	h := NewHandler(func(session *Session) {
+		for {
+			st, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(st, st)
+				st.Close()
+			}()
+		}
+	}, WithKeepAlive(0, 0))
+	// the default options of server and mux work together
+	path := filepath.Join(t.TempDir(), "mux.sock")
+	s := server.NewServer(server.WithCodec(new(Codec)), server.WithLogger(logger.NewLogger(logger.WithWriter(io.Discard))))
+	assert.Nil(t, s.Bind(server.NewAddress("unix", path), h))
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Start()
+	}()
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if !assert.Nil(t, err) {
+		return
+	}
+	client := Client(conn, WithKeepAlive(0, 0))
+	st, err := client.Open()
+	assert.Nil(t, err)
+	data := bytes.Repeat([]byte("0123456789"), 2048)
+	go func() {
+		st.Write(data)
+		st.Close()
+	}()
+	b, err := io.ReadAll(st)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(b, data))
+	assert.Nil(t, client.Close())
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, server.ErrServerClosed)
+}
@@ -0,0 +1,85 @@
+package mux
+
+import (
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+// defaultMaxFrameSize makes a whole data frame fit in the default server read buffer
+const defaultMaxFrameSize = buffer.DefaultBufferCapacity - headerSize
+
+// initialWindow is the stream window every peer start with
+// A bigger Options Window is granted to peer when stream open.
+const initialWindow = 256 * 1024
+
+// Options defined mux session options
+type Options struct {
+	// Window is the receive window size of each stream
+	// It can not be less than 256KB.
+	Window uint32
+	// MaxFrameSize is the max payload size of a data frame, default fits in buffer.DefaultBufferCapacity
+	// A peer served by NewHandler must not send frames larger than the server BufferCapacity,
+	// so the server BufferCapacity should be at least MaxFrameSize plus 10 bytes of frame header.
+	MaxFrameSize uint32
+	// AcceptBacklog is the count of opened streams waiting for Accept
+	// When backlog full, new streams will be reset.
+	AcceptBacklog int
+	// KeepAliveInterval is the interval of keepalive ping
+	// Zero means disable keepalive.
+	KeepAliveInterval time.Duration
+	// KeepAliveTimeout is the max time waiting a ping acknowledge
+	KeepAliveTimeout time.Duration
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Window:            initialWindow,
+		MaxFrameSize:      defaultMaxFrameSize,
+		AcceptBacklog:     256,
+		KeepAliveInterval: 30 * time.Second,
+		KeepAliveTimeout:  10 * time.Second,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Window < initialWindow {
+		options.Window = initialWindow
+	}
+	if options.MaxFrameSize == 0 {
+		options.MaxFrameSize = defaultMaxFrameSize
+	}
+	return options
+}
+
+// WithWindow is edit Options Window field
+func WithWindow(window uint32) Option {
+	return func(options *Options) {
+		options.Window = window
+	}
+}
+
+// WithMaxFrameSize is edit Options MaxFrameSize field
+func WithMaxFrameSize(size uint32) Option {
+	return func(options *Options) {
+		options.MaxFrameSize = size
+	}
+}
+
+// WithAcceptBacklog is edit Options AcceptBacklog field
+func WithAcceptBacklog(backlog int) Option {
+	return func(options *Options) {
+		options.AcceptBacklog = backlog
+	}
+}
+
+// WithKeepAlive is edit Options KeepAliveInterval and KeepAliveTimeout fields
+func WithKeepAlive(interval, timeout time.Duration) Option {
+	return func(options *Options) {
+		options.KeepAliveInterval = interval
+		options.KeepAliveTimeout = timeout
+	}
+}
@@ -0,0 +1,367 @@
+package mux
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+var (
+	// ErrSessionClosed will throw when use a closed Session
+	ErrSessionClosed = errors.New("mux session closed")
+	// ErrRemoteGoAway will throw when the peer closed the Session
+	ErrRemoteGoAway = errors.New("mux session closed by remote")
+	// ErrKeepAliveTimeout will throw when keepalive ping not acknowledged in time
+	ErrKeepAliveTimeout = errors.New("mux keepalive timeout")
+	// ErrStreamsExhausted will throw when no more stream id can be used
+	ErrStreamsExhausted = errors.New("mux stream ids exhausted")
+)
+
+// Session is a multiplexing session of a connection
+type Session struct {
+	opts    Options
+	client  bool
+	write   func(b []byte) error
+	closeFn func() error
+
+	mu       sync.Mutex
+	streams  map[uint32]*Stream
+	nextID   uint32
+	pingID   uint32
+	pings    map[uint32]chan struct{}
+	acceptCh chan *Stream
+	err      error
+	done     chan struct{}
+}
+
+func newSession(write func(b []byte) error, closeFn func() error, client bool, opts Options) *Session {
+	s := &Session{
+		opts:     opts,
+		client:   client,
+		write:    write,
+		closeFn:  closeFn,
+		streams:  make(map[uint32]*Stream),
+		pings:    make(map[uint32]chan struct{}),
+		acceptCh: make(chan *Stream, opts.AcceptBacklog),
+		done:     make(chan struct{}),
+	}
+	// client use odd stream ids and server use even stream ids
+	if client {
+		s.nextID = 1
+	} else {
+		s.nextID = 2
+	}
+	return s
+}
+
+func (s *Session) start() {
+	if s.opts.KeepAliveInterval > 0 {
+		go s.keepalive()
+	}
+}
+
+// Client will create client side Session on conn
+// The Session owns conn, it will be closed when Session closed.
+func Client(conn io.ReadWriteCloser, opts ...Option) *Session {
+	return newConnSession(conn, true, newOptions(opts...))
+}
+
+// Server will create server side Session on conn
+// The Session owns conn, it will be closed when Session closed.
+func Server(conn io.ReadWriteCloser, opts ...Option) *Session {
+	return newConnSession(conn, false, newOptions(opts...))
+}
+
+func newConnSession(conn io.ReadWriteCloser, client bool, opts Options) *Session {
+	// frames are written by a single goroutine, so receive loop never blocks on writing
+	sendCh := make(chan []byte, 64)
+	var s *Session
+	s = newSession(func(b []byte) error {
+		select {
+		case sendCh <- b:
+			return nil
+		case <-s.done:
+			return s.Err()
+		}
+	}, conn.Close, client, opts)
+	go s.sendLoop(conn, sendCh)
+	go s.recvLoop(conn)
+	s.start()
+	return s
+}
+
+func (s *Session) sendLoop(conn io.Writer, sendCh <-chan []byte) {
+	for {
+		select {
+		case b := <-sendCh:
+			if _, err := conn.Write(b); err != nil {
+				s.closeWithErr(err)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Session) recvLoop(conn io.Reader) {
+	codec := new(Codec)
+	buf := buffer.NewBuffer(headerSize + int(s.opts.Window))
+	b := make([]byte, buf.Capacity())
+	for {
+		n, err := conn.Read(b[:buf.Capacity()-buf.Size()])
+		if err != nil {
+			s.closeWithErr(err)
+			return
+		}
+		_, _ = buf.Write(b[:n])
+		for buf.Size() > 0 {
+			f := codec.Decode(buf)
+			if f == nil {
+				break
+			}
+			if err := s.handleFrame(f); err != nil {
+				s.closeWithErr(err)
+				return
+			}
+		}
+		if buf.Size() == buf.Capacity() {
+			s.closeWithErr(ErrProtocol)
+			return
+		}
+	}
+}
+
+// Open will open a new Stream to peer
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	id := s.nextID
+	if id == 0 || id > id+2 {
+		s.mu.Unlock()
+		return nil, ErrStreamsExhausted
+	}
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+	if err := s.sendFrame(typeWindowUpdate, flagSYN, id, s.opts.Window-initialWindow, nil); err != nil {
+		s.remove(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept will wait and return a Stream opened by peer
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.acceptCh:
+		return st, nil
+	case <-s.done:
+		return nil, s.Err()
+	}
+}
+
+// Ping will send a ping to peer and return the round trip time
+func (s *Session) Ping() (time.Duration, error) {
+	ch := make(chan struct{})
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return 0, s.err
+	}
+	s.pingID++
+	id := s.pingID
+	s.pings[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pings, id)
+		s.mu.Unlock()
+	}()
+	start := time.Now()
+	if err := s.sendFrame(typePing, flagSYN, 0, id, nil); err != nil {
+		return 0, err
+	}
+	timer := time.NewTimer(s.opts.KeepAliveTimeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, ErrKeepAliveTimeout
+	case <-s.done:
+		return 0, s.Err()
+	}
+}
+
+// NumStreams will return the count of streams not closed
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// Close will notify peer and close the Session
+// All streams of Session will be closed.
+func (s *Session) Close() error {
+	if s.IsClosed() {
+		return nil
+	}
+	_ = s.sendFrame(typeGoAway, 0, 0, 0, nil)
+	s.closeWithErr(ErrSessionClosed)
+	return nil
+}
+
+// IsClosed will return whether the Session closed
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done will return a channel closed when Session closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err will return the reason of Session closed
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Session) closeWithErr(err error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.err = err
+	streams := s.streams
+	s.streams = make(map[uint32]*Stream)
+	close(s.done)
+	s.mu.Unlock()
+	for _, st := range streams {
+		st.notify()
+	}
+	if s.closeFn != nil {
+		_ = s.closeFn()
+	}
+}
+
+func (s *Session) keepalive() {
+	ticker := time.NewTicker(s.opts.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if _, err := s.Ping(); err == ErrKeepAliveTimeout {
+				s.closeWithErr(err)
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) sendFrame(typ frameType, flags uint8, id uint32, length uint32, payload []byte) error {
+	if s.IsClosed() {
+		return s.Err()
+	}
+	f := &frame{typ: typ, flags: flags, streamID: id, length: length, payload: payload}
+	return s.write(f.marshal())
+}
+
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+func (s *Session) handleFrame(b []byte) error {
+	f, err := parseFrame(b)
+	if err != nil {
+		return err
+	}
+	switch f.typ {
+	case typePing:
+		if f.flags&flagSYN != 0 {
+			return s.sendFrame(typePing, flagACK, 0, f.length, nil)
+		}
+		s.mu.Lock()
+		ch, ok := s.pings[f.length]
+		delete(s.pings, f.length)
+		s.mu.Unlock()
+		if ok {
+			close(ch)
+		}
+		return nil
+	case typeGoAway:
+		s.closeWithErr(ErrRemoteGoAway)
+		return nil
+	}
+	st, err := s.streamOf(f)
+	if err != nil || st == nil {
+		return err
+	}
+	if f.typ == typeWindowUpdate {
+		st.grant(f.length)
+	} else if err := st.push(f.payload); err != nil {
+		return err
+	}
+	if f.flags&flagFIN != 0 {
+		st.remoteClose()
+	}
+	if f.flags&flagRST != 0 {
+		st.remoteReset()
+	}
+	return nil
+}
+
+// streamOf will find the stream of frame, or create it when frame open a new stream
+// It returns nil Stream when frame belongs to a closed stream.
+func (s *Session) streamOf(f *frame) (*Stream, error) {
+	s.mu.Lock()
+	st, ok := s.streams[f.streamID]
+	if f.flags&flagSYN == 0 {
+		s.mu.Unlock()
+		if !ok {
+			return nil, nil
+		}
+		return st, nil
+	}
+	// peer must open streams with its own id parity
+	if ok || f.streamID == 0 || (f.streamID%2 == 1) == s.client {
+		s.mu.Unlock()
+		return nil, ErrProtocol
+	}
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	st = newStream(s, f.streamID)
+	s.streams[f.streamID] = st
+	s.mu.Unlock()
+	if err := s.sendFrame(typeWindowUpdate, flagACK, f.streamID, s.opts.Window-initialWindow, nil); err != nil {
+		return nil, err
+	}
+	select {
+	case s.acceptCh <- st:
+		return st, nil
+	default:
+		s.remove(f.streamID)
+		return nil, s.sendFrame(typeWindowUpdate, flagRST, f.streamID, 0, nil)
+	}
+}
@@ -0,0 +1,187 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPipeSessions(opts ...Option) (*Session, *Session) {
+	c1, c2 := net.Pipe()
+	return Client(c1, opts...), Server(c2, opts...)
+}
+
+func TestSession_OpenAccept(t *testing.T) {
+	client, server := newPipeSessions()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		for {
+			st, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(st, st)
+				st.Close()
+			}()
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		st, err := client.Open()
+		assert.Nil(t, err)
+		assert.Equal(t, st.ID(), uint32(2*i+1))
+		_, err = st.Write([]byte("hello"))
+		assert.Nil(t, err)
+		b := make([]byte, 5)
+		_, err = io.ReadFull(st, b)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), "hello")
+		assert.Nil(t, st.Close())
+		_, err = st.Read(b)
+		assert.ErrorIs(t, err, io.EOF)
+		_, err = st.Write(b)
+		assert.ErrorIs(t, err, ErrStreamClosed)
+	}
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, client.NumStreams(), 0)
+	assert.Equal(t, server.NumStreams(), 0)
+}
+
+func TestSession_FlowControl(t *testing.T) {
+	client, server := newPipeSessions(WithMaxFrameSize(4096))
+	defer client.Close()
+	defer server.Close()
+	data := bytes.Repeat([]byte("0123456789"), initialWindow/5)
+	done := make(chan []byte)
+	go func() {
+		st, err := server.Accept()
+		assert.Nil(t, err)
+		// nothing read yet, so writer must stop at the window
+		time.Sleep(time.Millisecond * 50)
+		st.mu.Lock()
+		assert.Equal(t, st.recv.Size(), initialWindow)
+		st.mu.Unlock()
+		b, err := io.ReadAll(st)
+		assert.Nil(t, err)
+		done <- b
+	}()
+	st, err := client.Open()
+	assert.Nil(t, err)
+	n, err := st.Write(data)
+	assert.Nil(t, err)
+	assert.Equal(t, n, len(data))
+	assert.Nil(t, st.Close())
+	assert.Equal(t, <-done, data)
+}
+
+func TestSession_LargeWindow(t *testing.T) {
+	client, server := newPipeSessions(WithWindow(1 << 20))
+	defer client.Close()
+	defer server.Close()
+	// more than initial window is sent before reader starts, as the granted window allows
+	data := bytes.Repeat([]byte("0123456789"), 60*1024)
+	done := make(chan []byte)
+	go func() {
+		st, err := server.Accept()
+		assert.Nil(t, err)
+		time.Sleep(time.Millisecond * 50)
+		st.mu.Lock()
+		assert.Equal(t, st.recv.Size(), len(data))
+		st.mu.Unlock()
+		b, err := io.ReadAll(st)
+		assert.Nil(t, err)
+		done <- b
+	}()
+	st, err := client.Open()
+	assert.Nil(t, err)
+	n, err := st.Write(data)
+	assert.Nil(t, err)
+	assert.Equal(t, n, len(data))
+	assert.Nil(t, st.Close())
+	assert.Equal(t, <-done, data)
+}
+
+func TestStream_Reset(t *testing.T) {
+	client, server := newPipeSessions()
+	defer client.Close()
+	defer server.Close()
+	st, err := client.Open()
+	assert.Nil(t, err)
+	_, err = st.Write([]byte("hello"))
+	assert.Nil(t, err)
+	remote, err := server.Accept()
+	assert.Nil(t, err)
+	assert.Nil(t, st.Reset())
+	_, err = st.Write([]byte("hello"))
+	assert.ErrorIs(t, err, ErrStreamReset)
+	b := make([]byte, 5)
+	_, err = io.ReadFull(remote, b)
+	assert.Nil(t, err)
+	_, err = remote.Read(b)
+	assert.ErrorIs(t, err, ErrStreamReset)
+}
+
+func TestSession_AcceptBacklog(t *testing.T) {
+	client, server := newPipeSessions(WithAcceptBacklog(1))
+	defer client.Close()
+	defer server.Close()
+	st1, err := client.Open()
+	assert.Nil(t, err)
+	st2, err := client.Open()
+	assert.Nil(t, err)
+	_, err = st2.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrStreamReset)
+	accepted, err := server.Accept()
+	assert.Nil(t, err)
+	assert.Equal(t, accepted.ID(), st1.ID())
+}
+
+func TestSession_Ping(t *testing.T) {
+	client, server := newPipeSessions()
+	defer client.Close()
+	defer server.Close()
+	rtt, err := client.Ping()
+	assert.Nil(t, err)
+	assert.Greater(t, rtt, time.Duration(0))
+	_, err = server.Ping()
+	assert.Nil(t, err)
+}
+
+func TestSession_KeepAliveTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	// the peer reads nothing but never answers
+	go io.Copy(io.Discard, c2)
+	client := Client(c1, WithKeepAlive(time.Millisecond*10, time.Millisecond*20))
+	select {
+	case <-client.Done():
+		assert.ErrorIs(t, client.Err(), ErrKeepAliveTimeout)
+	case <-time.After(time.Second):
+		t.Error("session should be closed by keepalive timeout")
+	}
+}
+
+func TestSession_Close(t *testing.T) {
+	client, server := newPipeSessions()
+	st, err := client.Open()
+	assert.Nil(t, err)
+	remote, err := server.Accept()
+	assert.Nil(t, err)
+	assert.Nil(t, client.Close())
+	assert.Nil(t, client.Close())
+	assert.True(t, client.IsClosed())
+	_, err = client.Open()
+	assert.ErrorIs(t, err, ErrSessionClosed)
+	_, err = st.Write([]byte("hello"))
+	assert.ErrorIs(t, err, ErrSessionClosed)
+	<-server.Done()
+	_, err = remote.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	_, err = server.Accept()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,242 @@
+package mux
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+var (
+	// ErrStreamClosed will throw when write to a closed Stream
+	ErrStreamClosed = errors.New("mux stream closed")
+	// ErrStreamReset will throw when use a reset Stream
+	ErrStreamReset = errors.New("mux stream reset")
+)
+
+// Stream is a logical bidirectional stream of Session
+// It implements io.ReadWriteCloser.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mu           sync.Mutex
+	recv         buffer.Buffer
+	recvWindow   uint32
+	consumed     uint32
+	sendWindow   uint32
+	localClosed  bool
+	remoteClosed bool
+	reset        bool
+	readCh       chan struct{}
+	writeCh      chan struct{}
+}
+
+func newStream(session *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    session,
+		recv:       buffer.NewBuffer(int(session.opts.Window)),
+		recvWindow: session.opts.Window,
+		sendWindow: initialWindow,
+		readCh:     make(chan struct{}, 1),
+		writeCh:    make(chan struct{}, 1),
+	}
+}
+
+// ID will return the stream id
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Session will return the Session of Stream
+func (s *Stream) Session() *Session {
+	return s.session
+}
+
+// Read will read data from Stream
+// It returns io.EOF when peer closed the Stream and all data read.
+func (s *Stream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		s.mu.Lock()
+		if s.recv.Size() > 0 {
+			n, b := s.recv.ReadN(len(p))
+			copy(p, b)
+			s.consumed += uint32(n)
+			var delta uint32
+			// grant peer window after half of window consumed, avoid too many updates
+			if s.consumed >= s.session.opts.Window/2 && !s.remoteClosed && !s.reset {
+				delta = s.consumed
+				s.recvWindow += delta
+				s.consumed = 0
+			}
+			s.mu.Unlock()
+			if delta > 0 {
+				if err := s.session.sendFrame(typeWindowUpdate, 0, s.id, delta, nil); err != nil {
+					return n, err
+				}
+			}
+			return n, nil
+		}
+		if s.reset {
+			s.mu.Unlock()
+			return 0, ErrStreamReset
+		}
+		if s.remoteClosed {
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.readCh:
+		case <-s.session.done:
+			s.mu.Lock()
+			empty := s.recv.Size() == 0
+			s.mu.Unlock()
+			if empty {
+				return 0, s.session.Err()
+			}
+		}
+	}
+}
+
+// Write will write data to Stream
+// It blocks when peer window exhausted.
+func (s *Stream) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		s.mu.Lock()
+		if s.reset {
+			s.mu.Unlock()
+			return total, ErrStreamReset
+		}
+		if s.localClosed {
+			s.mu.Unlock()
+			return total, ErrStreamClosed
+		}
+		if s.sendWindow == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.writeCh:
+			case <-s.session.done:
+				return total, s.session.Err()
+			}
+			continue
+		}
+		n := uint32(len(p) - total)
+		if n > s.sendWindow {
+			n = s.sendWindow
+		}
+		if n > s.session.opts.MaxFrameSize {
+			n = s.session.opts.MaxFrameSize
+		}
+		s.sendWindow -= n
+		s.mu.Unlock()
+		if err := s.session.sendFrame(typeData, 0, s.id, n, p[total:total+int(n)]); err != nil {
+			return total, err
+		}
+		total += int(n)
+	}
+	return total, nil
+}
+
+// Close will half close the Stream
+// Peer will read io.EOF after all data read, and the Stream can still read data from peer.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.localClosed || s.reset {
+		s.mu.Unlock()
+		return nil
+	}
+	s.localClosed = true
+	both := s.remoteClosed
+	s.mu.Unlock()
+	s.notify()
+	if both {
+		s.session.remove(s.id)
+	}
+	if s.session.IsClosed() {
+		return nil
+	}
+	return s.session.sendFrame(typeData, flagFIN, s.id, 0, nil)
+}
+
+// Reset will close the Stream in both directions immediately
+// Unread data will be dropped, peer will get ErrStreamReset.
+func (s *Stream) Reset() error {
+	s.mu.Lock()
+	if s.reset || (s.localClosed && s.remoteClosed) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.reset = true
+	s.mu.Unlock()
+	s.notify()
+	s.session.remove(s.id)
+	if s.session.IsClosed() {
+		return nil
+	}
+	return s.session.sendFrame(typeWindowUpdate, flagRST, s.id, 0, nil)
+}
+
+func (s *Stream) notify() {
+	select {
+	case s.readCh <- struct{}{}:
+	default:
+	}
+	select {
+	case s.writeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Stream) grant(delta uint32) {
+	if delta == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.sendWindow += delta
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *Stream) push(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	if uint32(len(b)) > s.recvWindow {
+		s.mu.Unlock()
+		return ErrProtocol
+	}
+	s.recvWindow -= uint32(len(b))
+	if !s.reset {
+		_, _ = s.recv.Write(b)
+	}
+	s.mu.Unlock()
+	s.notify()
+	return nil
+}
+
+func (s *Stream) remoteClose() {
+	s.mu.Lock()
+	s.remoteClosed = true
+	both := s.localClosed
+	s.mu.Unlock()
+	s.notify()
+	if both {
+		s.session.remove(s.id)
+	}
+}
+
+func (s *Stream) remoteReset() {
+	s.mu.Lock()
+	s.reset = true
+	s.mu.Unlock()
+	s.notify()
+	s.session.remove(s.id)
+}
@@ -12,6 +12,15 @@ type Options struct {
 	// Codec is Codec implements
 	// All data receive and send will use Codec Encode and Decode
 	Codec Codec
+	// BufferCapacity is the read buffer capacity of each connection
+	// A frame larger than this capacity can not be decoded.
+	BufferCapacity int
+	// Capture will record traffic of connections matched by its filter when not nil
+	Capture *Capture
+	// MemoryBudget is the max bytes of read buffers and queued data of all connections, zero means no limit
+	// When it is exhausted, idle connections release read buffers to the pool, and the connections holding
+	// most bytes stop reading until usage falls to it.
+	MemoryBudget int
 }
 
 type Option func(options *Options)
@@ -36,3 +45,24 @@ func WithCodec(codec Codec) Option {
 		options.Codec = codec
 	}
 }
+
+// WithBufferCapacity is edit Options BufferCapacity field
+func WithBufferCapacity(capacity int) Option {
+	return func(options *Options) {
+		options.BufferCapacity = capacity
+	}
+}
+
+// WithCapture is edit Options Capture field
+func WithCapture(capture *Capture) Option {
+	return func(options *Options) {
+		options.Capture = capture
+	}
+}
+
+// WithMemoryBudget is edit Options MemoryBudget field
+func WithMemoryBudget(budget int) Option {
+	return func(options *Options) {
+		options.MemoryBudget = budget
+	}
+}
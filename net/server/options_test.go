@@ -31,3 +31,10 @@ func TestWithCodec(t *testing.T) {
 	WithCodec(new(NothingCodec))(&options)
 	assert.NotNil(t, options.Codec)
 }
+
+func TestWithBufferCapacity(t *testing.T) {
+	options := Options{}
+	assert.Zero(t, options.BufferCapacity)
+	WithBufferCapacity(1024)(&options)
+	assert.Equal(t, options.BufferCapacity, 1024)
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"hash/crc32"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// virtualNodes is the count of nodes of each backend in consistent hashing ring
+const virtualNodes = 160
+
+type backend struct {
+	addr     string
+	healthy  bool
+	draining bool
+	sessions map[*session]struct{}
+	// drainTimer closes sessions after Options DrainTimeout, it is stopped when backend added again
+	drainTimer *time.Timer
+}
+
+// BackendStatus is the status of a backend
+type BackendStatus struct {
+	Addr string
+	// Healthy is the last health check result, backends are healthy before checked
+	Healthy bool
+	// Draining is whether the backend is removed and waiting connections closed
+	Draining bool
+	// Active is the count of connections forwarded to the backend
+	Active int
+}
+
+type ringNode struct {
+	hash    uint32
+	backend *backend
+}
+
+// ring is a consistent hashing ring of backends
+type ring []ringNode
+
+func newRing(backends []*backend) ring {
+	r := make(ring, 0, len(backends)*virtualNodes)
+	for _, b := range backends {
+		if b.draining {
+			continue
+		}
+		for i := 0; i < virtualNodes; i++ {
+			r = append(r, ringNode{hash: crc32.ChecksumIEEE([]byte(b.addr + "#" + strconv.Itoa(i))), backend: b})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].hash < r[j].hash
+	})
+	return r
+}
+
+// get will return the first backend accepted by ok clockwise from hash of key
+func (r ring) get(key string, ok func(*backend) bool) *backend {
+	if len(r) == 0 {
+		return nil
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r), func(i int) bool {
+		return r[i].hash >= h
+	})
+	for i := 0; i < len(r); i++ {
+		if b := r[(start+i)%len(r)].backend; ok(b) {
+			return b
+		}
+	}
+	return nil
+}
+
+// sourceIP will return the IP of remote address, or remote when it is not host:port
+func sourceIP(remote string) string {
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
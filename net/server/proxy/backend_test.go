@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing_get(t *testing.T) {
+	a, b, c := &backend{addr: "a"}, &backend{addr: "b"}, &backend{addr: "c"}
+	all := func(*backend) bool { return true }
+	r := newRing([]*backend{a, b, c})
+	assert.Len(t, r, 3*virtualNodes)
+	assert.Nil(t, newRing(nil).get("x", all))
+
+	before := make(map[string]*backend)
+	counts := make(map[*backend]int)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("10.0.0.%d", i)
+		before[key] = r.get(key, all)
+		counts[before[key]]++
+	}
+	assert.Len(t, counts, 3)
+	// only keys of the removed backend are moved
+	c.draining = true
+	r = newRing([]*backend{a, b, c})
+	for key, chosen := range before {
+		if chosen != c {
+			assert.Equal(t, r.get(key, all), chosen)
+		} else {
+			assert.NotEqual(t, r.get(key, all), c)
+		}
+	}
+	assert.Equal(t, r.get("x", func(v *backend) bool { return v == b }), b)
+}
+
+func TestSourceIP(t *testing.T) {
+	assert.Equal(t, sourceIP("10.0.0.1:1234"), "10.0.0.1")
+	assert.Equal(t, sourceIP("[::1]:1234"), "::1")
+	assert.Equal(t, sourceIP("pipe"), "pipe")
+}
@@ -0,0 +1,6 @@
+// Package proxy is a L4 reverse proxy and load balancer on net/server.
+// Proxy is a server.Handler which forwards each connection to a backend chosen by Strategy,
+// skipping backends failed the active health check. A removed backend is draining,
+// it gets no new connections while connections already forwarded are served until closed or DrainTimeout.
+// Serve it with server.NothingCodec, so received bytes are forwarded as is.
+package proxy
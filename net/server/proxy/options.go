@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+// Strategy is how Proxy chooses a backend for a connection
+type Strategy int
+
+const (
+	RoundRobin       Strategy = iota // choose backends in turn
+	LeastConnections                 // choose the backend with least active connections
+	SourceHash                       // choose backend by consistent hashing of client IP
+)
+
+// HealthCheck will check whether backend of addr is healthy
+type HealthCheck func(ctx context.Context, addr string) error
+
+// DialHealthCheck is the default HealthCheck which succeeds when backend accepts a TCP connection
+func DialHealthCheck(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Options defined Proxy options
+type Options struct {
+	// Strategy is how to choose a backend, default RoundRobin
+	Strategy Strategy
+	// DialTimeout is the timeout to connect a backend
+	DialTimeout time.Duration
+	// HealthCheck is the active health check of backends, default DialHealthCheck
+	HealthCheck HealthCheck
+	// HealthCheckInterval is the interval of health checks, zero disables health check
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout is the timeout of each health check
+	HealthCheckTimeout time.Duration
+	// DrainTimeout will close connections of a removed backend after this duration, zero waits them closed by peers
+	DrainTimeout time.Duration
+	// BufferCapacity is the capacity of pooled buffers piping backend to client
+	BufferCapacity int
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Strategy:           RoundRobin,
+		DialTimeout:        5 * time.Second,
+		HealthCheck:        DialHealthCheck,
+		HealthCheckTimeout: 2 * time.Second,
+		BufferCapacity:     buffer.DefaultBufferCapacity,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.BufferCapacity <= 0 {
+		options.BufferCapacity = buffer.DefaultBufferCapacity
+	}
+	return options
+}
+
+// WithStrategy is edit Options Strategy field
+func WithStrategy(strategy Strategy) Option {
+	return func(options *Options) {
+		options.Strategy = strategy
+	}
+}
+
+// WithDialTimeout is edit Options DialTimeout field
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.DialTimeout = timeout
+	}
+}
+
+// WithHealthCheck is edit Options HealthCheck, HealthCheckInterval and HealthCheckTimeout fields
+func WithHealthCheck(check HealthCheck, interval, timeout time.Duration) Option {
+	return func(options *Options) {
+		options.HealthCheck = check
+		options.HealthCheckInterval = interval
+		options.HealthCheckTimeout = timeout
+	}
+}
+
+// WithDrainTimeout is edit Options DrainTimeout field
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.DrainTimeout = timeout
+	}
+}
+
+// WithBufferCapacity is edit Options BufferCapacity field
+func WithBufferCapacity(capacity int) Option {
+	return func(options *Options) {
+		options.BufferCapacity = capacity
+	}
+}
@@ -0,0 +1,313 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// ErrNoBackend will throw when no healthy backend can be connected
+var ErrNoBackend = errors.New("no available backend")
+
+// session is a client connection forwarded to a backend
+type session struct {
+	backend *backend
+	// upstream is set after backend connected, it is accessed with Proxy mu
+	upstream net.Conn
+}
+
+// Proxy is a server.Handler forwarding connections to backends
+type Proxy struct {
+	opts Options
+	// pool is the buffers of piping backend to client
+	pool     *buffer.Pool
+	mu       sync.Mutex
+	backends []*backend
+	ring     ring
+	next     int
+	sessions sync.Map
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewProxy will create Proxy of backend addresses
+// The health check is running until Proxy Close when Options HealthCheckInterval is positive.
+func NewProxy(backends []string, opts ...Option) *Proxy {
+	p := &Proxy{
+		opts: newOptions(opts...),
+		done: make(chan struct{}),
+	}
+	p.pool = buffer.NewPool(p.opts.BufferCapacity)
+	for _, addr := range backends {
+		p.AddBackend(addr)
+	}
+	if p.opts.HealthCheckInterval > 0 {
+		go p.healthCheckLoop()
+	}
+	return p
+}
+
+// AddBackend will add backend of addr, a draining backend is serving again
+func (p *Proxy) AddBackend(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.addr == addr {
+			if b.draining {
+				b.draining = false
+				if b.drainTimer != nil {
+					b.drainTimer.Stop()
+					b.drainTimer = nil
+				}
+				p.ring = newRing(p.backends)
+			}
+			return
+		}
+	}
+	p.backends = append(p.backends, &backend{addr: addr, healthy: true, sessions: make(map[*session]struct{})})
+	p.ring = newRing(p.backends)
+}
+
+// RemoveBackend will drain backend of addr
+// The backend gets no new connections, and it is removed when all its connections closed.
+// Connections are closed after Options DrainTimeout when it is positive.
+func (p *Proxy) RemoveBackend(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.addr != addr || b.draining {
+			continue
+		}
+		b.draining = true
+		p.ring = newRing(p.backends)
+		if len(b.sessions) == 0 {
+			p.remove(b)
+		} else if p.opts.DrainTimeout > 0 {
+			b.drainTimer = time.AfterFunc(p.opts.DrainTimeout, func() {
+				p.closeSessions(b)
+			})
+		}
+		return
+	}
+}
+
+// Backends will return status of backends, include draining ones
+func (p *Proxy) Backends() []BackendStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := make([]BackendStatus, 0, len(p.backends))
+	for _, b := range p.backends {
+		status = append(status, BackendStatus{Addr: b.addr, Healthy: b.healthy, Draining: b.draining, Active: len(b.sessions)})
+	}
+	return status
+}
+
+// Close will stop health check
+func (p *Proxy) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
+
+func (p *Proxy) OnConnected(conn server.Connection) (server.Action, error) {
+	tried := make(map[*backend]bool)
+	for {
+		s := p.pick(conn.Remote(), tried)
+		if s == nil {
+			return server.DisconnectionAction, ErrNoBackend
+		}
+		upstream, err := net.DialTimeout("tcp", s.backend.addr, p.opts.DialTimeout)
+		if err != nil {
+			conn.Logger().WarnF("connect backend %s failed: %v", s.backend.addr, err)
+			tried[s.backend] = true
+			p.release(s, p.opts.HealthCheckInterval > 0)
+			continue
+		}
+		p.mu.Lock()
+		s.upstream = upstream
+		p.mu.Unlock()
+		p.sessions.Store(conn, s)
+		go p.pipe(conn, s)
+		return server.NothingAction, nil
+	}
+}
+
+func (p *Proxy) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	v, ok := p.sessions.LoadAndDelete(conn)
+	if !ok {
+		return nil
+	}
+	s := v.(*session)
+	err := s.upstream.Close()
+	p.release(s, false)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (p *Proxy) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	v, ok := p.sessions.Load(conn)
+	if !ok {
+		return server.DisconnectionAction, nil
+	}
+	s := v.(*session)
+	if _, err := s.upstream.Write(frame); err != nil {
+		return server.DisconnectionAction, err
+	}
+	return server.NothingAction, nil
+}
+
+func (p *Proxy) OnError(conn server.Connection, err error) server.Action {
+	conn.Logger().WarnF("proxy error: %v", err)
+	return server.NothingAction
+}
+
+// pick will choose a backend not tried and create session of it
+func (p *Proxy) pick(remote string, tried map[*backend]bool) *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	available := func(b *backend) bool {
+		return !b.draining && b.healthy && !tried[b]
+	}
+	var chosen *backend
+	switch p.opts.Strategy {
+	case LeastConnections:
+		for _, b := range p.backends {
+			if available(b) && (chosen == nil || len(b.sessions) < len(chosen.sessions)) {
+				chosen = b
+			}
+		}
+	case SourceHash:
+		chosen = p.ring.get(sourceIP(remote), available)
+	default:
+		for i := 0; i < len(p.backends); i++ {
+			b := p.backends[(p.next+i)%len(p.backends)]
+			if available(b) {
+				chosen = b
+				p.next = (p.next + i + 1) % len(p.backends)
+				break
+			}
+		}
+	}
+	if chosen == nil {
+		return nil
+	}
+	s := &session{backend: chosen}
+	chosen.sessions[s] = struct{}{}
+	return s
+}
+
+// release will remove session from its backend, and mark backend unhealthy when failed
+func (p *Proxy) release(s *session, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := s.backend
+	delete(b.sessions, s)
+	if failed {
+		b.healthy = false
+	}
+	if b.draining && len(b.sessions) == 0 {
+		p.remove(b)
+	}
+}
+
+// remove will delete backend, the caller must hold mu
+func (p *Proxy) remove(b *backend) {
+	for i, v := range p.backends {
+		if v == b {
+			p.backends = append(p.backends[:i:i], p.backends[i+1:]...)
+			break
+		}
+	}
+	if p.next >= len(p.backends) {
+		p.next = 0
+	}
+}
+
+// closeSessions will close upstreams of draining backend
+func (p *Proxy) closeSessions(b *backend) {
+	p.mu.Lock()
+	if !b.draining {
+		// added again after the timer fired
+		p.mu.Unlock()
+		return
+	}
+	b.drainTimer = nil
+	upstreams := make([]net.Conn, 0, len(b.sessions))
+	for s := range b.sessions {
+		if s.upstream != nil {
+			upstreams = append(upstreams, s.upstream)
+		}
+	}
+	p.mu.Unlock()
+	for _, upstream := range upstreams {
+		upstream.Close()
+	}
+}
+
+// pipe will forward bytes from backend to client through a pooled buffer
+// The buffer is sent without copy and reused after written, so backend is not read while client is slow.
+// The client is closed after the queued bytes flushed when backend closed.
+func (p *Proxy) pipe(conn server.Connection, s *session) {
+	defer conn.Close()
+	buf := p.pool.Get()
+	defer p.pool.Put(buf)
+	for {
+		n, err := buf.Fill(s.upstream)
+		if n > 0 {
+			if conn.SendWait(buf.Bytes(), true) != nil {
+				return
+			}
+			buf.Reset()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) healthCheckLoop() {
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.checkHealth()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// checkHealth will check all serving backends concurrently
+func (p *Proxy) checkHealth() {
+	p.mu.Lock()
+	backends := make([]*backend, 0, len(p.backends))
+	for _, b := range p.backends {
+		if !b.draining {
+			backends = append(backends, b)
+		}
+	}
+	p.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, b := range backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), p.opts.HealthCheckTimeout)
+			defer cancel()
+			err := p.opts.HealthCheck(ctx, b.addr)
+			p.mu.Lock()
+			b.healthy = err == nil
+			p.mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+}
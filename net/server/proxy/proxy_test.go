@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+// startBackend will start a backend greeting with name and echo received bytes
+func startBackend(t *testing.T, name string) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				conn.Write([]byte(name))
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String(), func() {
+		ln.Close()
+	}
+}
+
+// greeting will read the backend name from client
+func greeting(t *testing.T, client net.Conn) string {
+	b := make([]byte, 1)
+	_, err := io.ReadFull(client, b)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func TestProxy_RoundRobin(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	b, stopB := startBackend(t, "b")
+	defer stopB()
+	p := NewProxy([]string{a, b})
+	defer p.Close()
+	h := servertest.New(p)
+	var names []string
+	for i := 0; i < 3; i++ {
+		client, _ := h.Pipe()
+		names = append(names, greeting(t, client))
+		client.Close()
+	}
+	assert.Equal(t, names, []string{"a", "b", "a"})
+
+	client, _ := h.Pipe()
+	defer client.Close()
+	assert.Equal(t, greeting(t, client), "b")
+	client.Write([]byte("hello"))
+	reply := make([]byte, 5)
+	_, err := io.ReadFull(client, reply)
+	assert.Nil(t, err)
+	assert.Equal(t, string(reply), "hello")
+}
+
+func TestProxy_LeastConnections(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	b, stopB := startBackend(t, "b")
+	defer stopB()
+	p := NewProxy([]string{a, b}, WithStrategy(LeastConnections))
+	h := servertest.New(p)
+	first, _ := h.Pipe()
+	defer first.Close()
+	assert.Equal(t, greeting(t, first), "a")
+	second, _ := h.Pipe()
+	assert.Equal(t, greeting(t, second), "b")
+	second.Close()
+	for i := 0; i < 100 && p.Backends()[1].Active > 0; i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	third, _ := h.Pipe()
+	defer third.Close()
+	assert.Equal(t, greeting(t, third), "b")
+}
+
+func TestProxy_SourceHash(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	p := NewProxy([]string{a}, WithStrategy(SourceHash))
+	h := servertest.New(p)
+	client, _ := h.Pipe()
+	defer client.Close()
+	assert.Equal(t, greeting(t, client), "a")
+}
+
+func TestProxy_HealthCheck(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	b, stopB := startBackend(t, "b")
+	defer stopB()
+	var mu sync.Mutex
+	down := map[string]bool{a: true}
+	check := func(ctx context.Context, addr string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if down[addr] {
+			return errors.New("down")
+		}
+		return DialHealthCheck(ctx, addr)
+	}
+	p := NewProxy([]string{a, b}, WithHealthCheck(check, time.Millisecond*10, time.Second))
+	defer p.Close()
+	for i := 0; i < 100 && p.Backends()[0].Healthy; i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.Equal(t, p.Backends(), []BackendStatus{{Addr: a}, {Addr: b, Healthy: true}})
+	h := servertest.New(p)
+	for i := 0; i < 2; i++ {
+		client, _ := h.Pipe()
+		assert.Equal(t, greeting(t, client), "b")
+		client.Close()
+	}
+
+	mu.Lock()
+	down = map[string]bool{}
+	mu.Unlock()
+	for i := 0; i < 100 && !p.Backends()[0].Healthy; i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.True(t, p.Backends()[0].Healthy)
+}
+
+func TestProxy_NoBackend(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed := ln.Addr().String()
+	ln.Close()
+
+	// the backend can not be connected is skipped
+	p := NewProxy([]string{closed, a}, WithDialTimeout(time.Second))
+	h := servertest.New(p)
+	client, _ := h.Pipe()
+	assert.Equal(t, greeting(t, client), "a")
+	client.Close()
+
+	p = NewProxy([]string{closed})
+	conn := servertest.New(p).Connect()
+	assert.True(t, conn.Disconnected())
+	assert.ErrorIs(t, conn.Errors()[0], ErrNoBackend)
+	// OnConnected and OnError
+	assert.Equal(t, conn.Actions(), []server.Action{server.DisconnectionAction, server.NothingAction})
+}
+
+func TestProxy_RemoveBackend(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	b, stopB := startBackend(t, "b")
+	defer stopB()
+	p := NewProxy([]string{a, b}, WithDrainTimeout(time.Millisecond*50))
+	h := servertest.New(p)
+	client, _ := h.Pipe()
+	defer client.Close()
+	assert.Equal(t, greeting(t, client), "a")
+
+	p.RemoveBackend(a)
+	assert.Equal(t, p.Backends(), []BackendStatus{{Addr: a, Healthy: true, Draining: true, Active: 1}, {Addr: b, Healthy: true}})
+	other, _ := h.Pipe()
+	assert.Equal(t, greeting(t, other), "b")
+	other.Close()
+	// the draining connection is still served
+	client.Write([]byte("x"))
+	assert.Equal(t, greeting(t, client), "x")
+
+	// the backend is removed after connections closed by DrainTimeout
+	time.Sleep(time.Millisecond * 80)
+	client.Write([]byte("y"))
+	_, err := client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	for i := 0; i < 100 && len(p.Backends()) > 1; i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.Equal(t, p.Backends(), []BackendStatus{{Addr: b, Healthy: true}})
+
+	p.RemoveBackend(b)
+	assert.Len(t, p.Backends(), 0)
+	p.AddBackend(a)
+	p.AddBackend(a)
+	assert.Len(t, p.Backends(), 1)
+}
+
+func TestProxy_AddBackendWhileDraining(t *testing.T) {
+	a, stopA := startBackend(t, "a")
+	defer stopA()
+	p := NewProxy([]string{a}, WithDrainTimeout(time.Millisecond*30))
+	h := servertest.New(p)
+	client, _ := h.Pipe()
+	defer client.Close()
+	assert.Equal(t, greeting(t, client), "a")
+
+	p.RemoveBackend(a)
+	p.AddBackend(a)
+	// the drain timer is stopped, so the connection is still served after DrainTimeout
+	time.Sleep(time.Millisecond * 60)
+	client.Write([]byte("x"))
+	assert.Equal(t, greeting(t, client), "x")
+	assert.Equal(t, p.Backends(), []BackendStatus{{Addr: a, Healthy: true, Active: 1}})
+}
+
+func TestProxy_Backpressure(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 512*1024)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write(data)
+		conn.Close()
+	}()
+	p := NewProxy([]string{ln.Addr().String()})
+	defer p.Close()
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	s := server.NewServer(server.WithLogger(logger.NewLogger(logger.WithWriter(io.Discard))))
+	assert.Nil(t, s.Bind(server.NewAddress("unix", path), p))
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Start()
+	}()
+	var client net.Conn
+	for i := 0; i < 100; i++ {
+		if client, err = net.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer client.Close()
+	// the slow client stops reading of backend instead of queuing the response in memory
+	time.Sleep(time.Millisecond * 100)
+	b, err := io.ReadAll(client)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(b, data))
+	assert.Less(t, s.Stats().Memory.Peak, int64(len(data)/8))
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, server.ErrServerClosed)
+}
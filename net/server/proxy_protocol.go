@@ -0,0 +1,335 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrProxyHeaderInvalid will throw when PROXY protocol header can not be parsed
+	ErrProxyHeaderInvalid = errors.New("invalid proxy protocol header")
+	// ErrProxyHeaderRequired will throw when a trusted source not send PROXY protocol header
+	ErrProxyHeaderRequired = errors.New("proxy protocol header required")
+)
+
+// ProxyCommand is the command of PROXY protocol header
+type ProxyCommand byte
+
+const (
+	ProxyLocal ProxyCommand = iota // connection established by proxy itself, such as health check
+	ProxyProxy                     // connection relayed for a client
+)
+
+// ProxyTLV is a type-length-value extension of PROXY protocol v2 header
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyHeader is a parsed PROXY protocol v1 or v2 header
+type ProxyHeader struct {
+	// Version is 1 for text header and 2 for binary header
+	Version int
+	// Command is ProxyProxy or ProxyLocal, version 1 header is always ProxyProxy
+	Command ProxyCommand
+	// Source is the real client address, nil when unknown
+	Source net.Addr
+	// Destination is the address client connected to, nil when unknown
+	Destination net.Addr
+	// TLVs is the extensions of version 2 header
+	TLVs []ProxyTLV
+}
+
+// TLV will return the first extension value of type t
+func (p *ProxyHeader) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range p.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ProxyProtocol is the Address option to parse PROXY protocol header
+// The header is parsed before any bytes reach the Codec, and Connection Remote will report the Source.
+type ProxyProtocol struct {
+	// TrustedCIDRs is the networks allowed to send PROXY protocol header
+	// Connections from other sources are served as is, their bytes will not be parsed as header.
+	// Empty means all sources are trusted.
+	TrustedCIDRs []*net.IPNet
+	// Required will reject connections of trusted sources without PROXY protocol header
+	Required bool
+	// Timeout is the max time to wait the header, default 5 seconds
+	// When not Required, a connection sending nothing before timeout is served without header,
+	// so the protocols server speaks first still work, after the timeout delay.
+	Timeout time.Duration
+}
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+	proxyV2Signature = "\r\n\r\n\x00\r\nQUIT\n"
+	// proxyV2HeaderSize is signature(12) + version and command(1) + family(1) + length(2)
+	proxyV2HeaderSize = 16
+)
+
+// ParseCIDRs will parse networks for ProxyProtocol TrustedCIDRs
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (p *ProxyProtocol) trusted(addr net.Addr) bool {
+	if len(p.TrustedCIDRs) == 0 {
+		return true
+	}
+	ip := addrIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.TrustedCIDRs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// readHeader will read PROXY protocol header from conn
+// It returns the header (nil when conn not send header) and the bytes read after header.
+func (p *ProxyProtocol) readHeader(conn net.Conn) (*ProxyHeader, []byte, error) {
+	if !p.trusted(conn.RemoteAddr()) {
+		return nil, nil, nil
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, nil, err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+	var data []byte
+	b := make([]byte, 256)
+	for {
+		header, size, err := parseProxyHeader(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if size > 0 {
+			return header, data[size:], nil
+		}
+		if size < 0 {
+			if p.Required {
+				return nil, nil, ErrProxyHeaderRequired
+			}
+			return nil, data, nil
+		}
+		n, err := conn.Read(b)
+		if err != nil {
+			var ne net.Error
+			if !p.Required && len(data) == 0 && errors.As(err, &ne) && ne.Timeout() {
+				// client may be waiting the server to speak first
+				return nil, nil, nil
+			}
+			return nil, nil, err
+		}
+		data = append(data, b[:n]...)
+	}
+}
+
+// parseProxyHeader will parse header in data
+// The size is header length when header complete, 0 when need more data, -1 when data is not a header.
+func parseProxyHeader(data []byte) (*ProxyHeader, int, error) {
+	if matchPrefix(data, proxyV1Prefix) {
+		if len(data) < len(proxyV1Prefix) {
+			return nil, 0, nil
+		}
+		return parseProxyV1(data)
+	}
+	if matchPrefix(data, proxyV2Signature) {
+		if len(data) < proxyV2HeaderSize {
+			return nil, 0, nil
+		}
+		return parseProxyV2(data)
+	}
+	return nil, -1, nil
+}
+
+// matchPrefix will return whether data and prefix are same at their common length
+func matchPrefix(data []byte, prefix string) bool {
+	n := len(data)
+	if n > len(prefix) {
+		n = len(prefix)
+	}
+	return string(data[:n]) == prefix[:n]
+}
+
+func parseProxyV1(data []byte) (*ProxyHeader, int, error) {
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		if len(data) >= proxyV1MaxLength {
+			return nil, 0, ErrProxyHeaderInvalid
+		}
+		return nil, 0, nil
+	}
+	if end+2 > proxyV1MaxLength {
+		return nil, 0, ErrProxyHeaderInvalid
+	}
+	fields := strings.Split(string(data[:end]), " ")
+	header := &ProxyHeader{Version: 1, Command: ProxyProxy}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return header, end + 2, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, 0, ErrProxyHeaderInvalid
+	}
+	src, err := parseProxyV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, 0, err
+	}
+	dst, err := parseProxyV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, 0, err
+	}
+	header.Source, header.Destination = src, dst
+	return header, end + 2, nil
+}
+
+func parseProxyV1Addr(host, port string, v4 bool) (net.Addr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ip.To4() != nil) != v4 {
+		return nil, ErrProxyHeaderInvalid
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrProxyHeaderInvalid
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func parseProxyV2(data []byte) (*ProxyHeader, int, error) {
+	if data[12]>>4 != 2 {
+		return nil, 0, ErrProxyHeaderInvalid
+	}
+	command := ProxyCommand(data[12] & 0x0f)
+	if command > ProxyProxy {
+		return nil, 0, ErrProxyHeaderInvalid
+	}
+	size := proxyV2HeaderSize + int(binary.BigEndian.Uint16(data[14:16]))
+	if len(data) < size {
+		return nil, 0, nil
+	}
+	header := &ProxyHeader{Version: 2, Command: command}
+	body := data[proxyV2HeaderSize:size]
+	family, transport := data[13]>>4, data[13]&0x0f
+	var addrLength int
+	switch family {
+	case 0x1:
+		addrLength = 12
+	case 0x2:
+		addrLength = 36
+	case 0x3:
+		addrLength = 216
+	}
+	if len(body) < addrLength {
+		return nil, 0, ErrProxyHeaderInvalid
+	}
+	if command == ProxyProxy {
+		header.Source, header.Destination = parseProxyV2Addr(family, transport, body[:addrLength])
+	}
+	tlvs, err := parseProxyTLVs(body[addrLength:])
+	if err != nil {
+		return nil, 0, err
+	}
+	header.TLVs = tlvs
+	return header, size, nil
+}
+
+func parseProxyV2Addr(family, transport byte, b []byte) (net.Addr, net.Addr) {
+	var src, dst net.IP
+	var ports []byte
+	switch family {
+	case 0x1:
+		src, dst, ports = net.IP(b[0:4]), net.IP(b[4:8]), b[8:12]
+	case 0x2:
+		src, dst, ports = net.IP(b[0:16]), net.IP(b[16:32]), b[32:36]
+	case 0x3:
+		return &net.UnixAddr{Name: unixName(b[:108]), Net: "unix"}, &net.UnixAddr{Name: unixName(b[108:]), Net: "unix"}
+	default:
+		return nil, nil
+	}
+	src, dst = append(net.IP{}, src...), append(net.IP{}, dst...)
+	sp, dp := int(binary.BigEndian.Uint16(ports[0:2])), int(binary.BigEndian.Uint16(ports[2:4]))
+	if transport == 0x2 {
+		return &net.UDPAddr{IP: src, Port: sp}, &net.UDPAddr{IP: dst, Port: dp}
+	}
+	return &net.TCPAddr{IP: src, Port: sp}, &net.TCPAddr{IP: dst, Port: dp}
+}
+
+func unixName(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func parseProxyTLVs(b []byte) ([]ProxyTLV, error) {
+	var tlvs []ProxyTLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, ErrProxyHeaderInvalid
+		}
+		size := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+size {
+			return nil, ErrProxyHeaderInvalid
+		}
+		tlvs = append(tlvs, ProxyTLV{Type: b[0], Value: append([]byte{}, b[3:3+size]...)})
+		b = b[3+size:]
+	}
+	return tlvs, nil
+}
+
+// ProxyHeaderOf will return the PROXY protocol header of conn
+// It returns false when conn not send header.
+func ProxyHeaderOf(conn Connection) (*ProxyHeader, bool) {
+	c, ok := conn.(interface{ ProxyHeader() *ProxyHeader })
+	if !ok || c.ProxyHeader() == nil {
+		return nil, false
+	}
+	return c.ProxyHeader(), true
+}
+
+// String will describe the header, used for logging
+func (p *ProxyHeader) String() string {
+	return fmt.Sprintf("PROXY v%d %v -> %v", p.Version, p.Source, p.Destination)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func proxyV2Header(command ProxyCommand, family byte, body []byte) []byte {
+	b := append([]byte(proxyV2Signature), 0x20|byte(command), family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:16], uint16(len(body)))
+	return append(b, body...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	t.Run("test version 1", func(t *testing.T) {
+		data := []byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nhello")
+		header, size, err := parseProxyHeader(data)
+		assert.Nil(t, err)
+		assert.Equal(t, string(data[size:]), "hello")
+		assert.Equal(t, header.Version, 1)
+		assert.Equal(t, header.Source.String(), "192.168.0.1:56324")
+		assert.Equal(t, header.Destination.String(), "10.0.0.1:443")
+
+		header, size, err = parseProxyHeader([]byte("PROXY TCP6 ::1 ::2 1 2\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, header.Source.String(), "[::1]:1")
+
+		header, size, err = parseProxyHeader([]byte("PROXY UNKNOWN\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, size, 15)
+		assert.Nil(t, header.Source)
+
+		_, size, err = parseProxyHeader([]byte("PROXY TCP4 192.168.0.1"))
+		assert.Nil(t, err)
+		assert.Equal(t, size, 0)
+		for _, invalid := range []string{
+			"PROXY TCP4 192.168.0.1 10.0.0.1 56324\r\n",
+			"PROXY TCP4 ::1 10.0.0.1 56324 443\r\n",
+			"PROXY TCP4 192.168.0.1 10.0.0.1 56324 70000\r\n",
+			"PROXY UDP4 192.168.0.1 10.0.0.1 56324 443\r\n",
+		} {
+			_, _, err = parseProxyHeader([]byte(invalid))
+			assert.ErrorIs(t, err, ErrProxyHeaderInvalid, invalid)
+		}
+		_, _, err = parseProxyHeader(append([]byte("PROXY "), make([]byte, proxyV1MaxLength)...))
+		assert.ErrorIs(t, err, ErrProxyHeaderInvalid)
+	})
+	t.Run("test version 2", func(t *testing.T) {
+		body := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0xdc, 0x04, 0x01, 0xbb}
+		body = append(body, 0x01, 0x00, 0x02, 'h', '2', 0xe0, 0x00, 0x00)
+		data := append(proxyV2Header(ProxyProxy, 0x11, body), "hello"...)
+		for i := 0; i < len(data)-5; i++ {
+			_, size, err := parseProxyHeader(data[:i])
+			assert.Nil(t, err)
+			assert.Equal(t, size, 0)
+		}
+		header, size, err := parseProxyHeader(data)
+		assert.Nil(t, err)
+		assert.Equal(t, string(data[size:]), "hello")
+		assert.Equal(t, header.Version, 2)
+		assert.Equal(t, header.Command, ProxyProxy)
+		assert.Equal(t, header.Source.String(), "192.168.0.1:56324")
+		assert.Equal(t, header.Destination.String(), "10.0.0.1:443")
+		assert.Len(t, header.TLVs, 2)
+		alpn, ok := header.TLV(0x01)
+		assert.True(t, ok)
+		assert.Equal(t, string(alpn), "h2")
+		_, ok = header.TLV(0x02)
+		assert.False(t, ok)
+
+		header, _, err = parseProxyHeader(proxyV2Header(ProxyLocal, 0x00, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, header.Command, ProxyLocal)
+		assert.Nil(t, header.Source)
+
+		_, _, err = parseProxyHeader(proxyV2Header(ProxyProxy, 0x11, body[:8]))
+		assert.ErrorIs(t, err, ErrProxyHeaderInvalid)
+		_, _, err = parseProxyHeader(proxyV2Header(ProxyProxy, 0x11, append(body, 0x01)))
+		assert.ErrorIs(t, err, ErrProxyHeaderInvalid)
+	})
+	t.Run("test not header", func(t *testing.T) {
+		_, size, err := parseProxyHeader([]byte("GET / HTTP/1.1\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, size, -1)
+		_, size, err = parseProxyHeader([]byte("\r\n\r\nX"))
+		assert.Nil(t, err)
+		assert.Equal(t, size, -1)
+		_, size, err = parseProxyHeader([]byte("PRO"))
+		assert.Nil(t, err)
+		assert.Equal(t, size, 0)
+	})
+}
+
+func TestProxyProtocol_readHeader(t *testing.T) {
+	read := func(proxy *ProxyProtocol, data string) (*ProxyHeader, []byte, error) {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		defer c2.Close()
+		go c2.Write([]byte(data))
+		return proxy.readHeader(c1)
+	}
+	header, rest, err := read(&ProxyProtocol{}, "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nhello")
+	assert.Nil(t, err)
+	assert.Equal(t, header.Source.String(), "192.168.0.1:56324")
+	assert.Equal(t, string(rest), "hello")
+
+	header, rest, err = read(&ProxyProtocol{}, "hello")
+	assert.Nil(t, err)
+	assert.Nil(t, header)
+	assert.Equal(t, string(rest), "hello")
+
+	_, _, err = read(&ProxyProtocol{Required: true}, "hello")
+	assert.ErrorIs(t, err, ErrProxyHeaderRequired)
+
+	_, _, err = read(&ProxyProtocol{Timeout: time.Millisecond * 10}, "PROXY ")
+	assert.NotNil(t, err)
+
+	// client sending nothing is served without header unless required
+	header, rest, err = read(&ProxyProtocol{Timeout: time.Millisecond * 10}, "")
+	assert.Nil(t, err)
+	assert.Nil(t, header)
+	assert.Empty(t, rest)
+	_, _, err = read(&ProxyProtocol{Timeout: time.Millisecond * 10, Required: true}, "")
+	assert.NotNil(t, err)
+
+	// net.Pipe address is not an ip, so it is never trusted by cidrs
+	cidrs, err := ParseCIDRs("10.0.0.0/8")
+	assert.Nil(t, err)
+	header, rest, err = read(&ProxyProtocol{TrustedCIDRs: cidrs, Required: true}, "PROXY UNKNOWN\r\n")
+	assert.Nil(t, err)
+	assert.Nil(t, header)
+	assert.Empty(t, rest)
+	_, err = ParseCIDRs("10.0.0.0")
+	assert.NotNil(t, err)
+}
+
+func TestProxyProtocol_trusted(t *testing.T) {
+	cidrs, _ := ParseCIDRs("10.0.0.0/8", "::1/128")
+	proxy := &ProxyProtocol{TrustedCIDRs: cidrs}
+	assert.True(t, proxy.trusted(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}))
+	assert.True(t, proxy.trusted(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 1}))
+	assert.False(t, proxy.trusted(&net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 1}))
+	assert.False(t, proxy.trusted(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}))
+	assert.True(t, (&ProxyProtocol{}).trusted(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}))
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucket is a token bucket rate limiter
+// It is not safe for concurrent use, callers must hold their own lock.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket will create a full bucket filled rate tokens per second
+// When burst not positive, the bucket size is rate and at least 1.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	size := float64(burst)
+	if size <= 0 {
+		size = math.Max(rate, 1)
+	}
+	return &tokenBucket{rate: rate, burst: size, tokens: size}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// take will take n tokens and return whether tokens enough
+func (b *tokenBucket) take(now time.Time, n float64) bool {
+	b.refill(now)
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// reserve will take n tokens even not enough, and return the duration until tokens repaid
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
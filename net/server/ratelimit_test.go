@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 2)
+	assert.True(t, b.take(now, 1))
+	assert.True(t, b.take(now, 1))
+	assert.False(t, b.take(now, 1))
+	assert.True(t, b.take(now.Add(time.Millisecond*100), 1))
+	assert.False(t, b.take(now.Add(time.Millisecond*100), 1))
+	// tokens never above burst
+	assert.True(t, b.take(now.Add(time.Hour), 2))
+	assert.False(t, b.take(now.Add(time.Hour), 1))
+
+	b = newTokenBucket(0.5, 0)
+	assert.Equal(t, b.burst, float64(1))
+	assert.Equal(t, newTokenBucket(100, 0).burst, float64(100))
+
+	b = newTokenBucket(100, 100)
+	assert.Zero(t, b.reserve(now, 50))
+	assert.Zero(t, b.reserve(now, 50))
+	assert.Equal(t, b.reserve(now, 50), time.Millisecond*500)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/jarod2011/toolkit/logger"
+)
+
+// CloseCode is the cause of a connection closed
+type CloseCode int
+
+const (
+	ClosePeer        CloseCode = iota // client closed connection
+	CloseHandler                      // Handler returned DisconnectionAction or closed the Connection
+	CloseCodecError                   // frame malformed, too large or not completed in time
+	CloseTimeout                      // read deadline exceeded and OnError returned DisconnectionAction
+	CloseRateLimited                  // inbound limit exceeded and OnError returned DisconnectionAction
+	CloseIOError                      // reading from or writing to client failed
+	CloseServerStop                   // the server or the Address stopped
+	CloseKilled                       // closed by server Kill
+)
+
+// closeCodes is count of CloseCode
+const closeCodes = int(CloseKilled) + 1
+
+func (c CloseCode) String() string {
+	switch c {
+	case ClosePeer:
+		return "peer_closed"
+	case CloseHandler:
+		return "handler"
+	case CloseCodecError:
+		return "codec_error"
+	case CloseTimeout:
+		return "timeout"
+	case CloseRateLimited:
+		return "rate_limited"
+	case CloseIOError:
+		return "io_error"
+	case CloseServerStop:
+		return "server_stop"
+	case CloseKilled:
+		return "killed"
+	}
+	return "unknown"
+}
+
+// Initiator will return which side decided to close for the code
+func (c CloseCode) Initiator() CloseInitiator {
+	switch c {
+	case ClosePeer, CloseIOError:
+		return InitiatorPeer
+	case CloseHandler:
+		return InitiatorHandler
+	}
+	return InitiatorServer
+}
+
+// CloseInitiator is which side decided to close a connection
+type CloseInitiator int
+
+const (
+	InitiatorPeer    CloseInitiator = iota // the client or the network
+	InitiatorHandler                       // the Handler
+	InitiatorServer                        // the server engine or its operator
+)
+
+func (i CloseInitiator) String() string {
+	switch i {
+	case InitiatorPeer:
+		return "peer"
+	case InitiatorHandler:
+		return "handler"
+	case InitiatorServer:
+		return "server"
+	}
+	return "unknown"
+}
+
+// CloseReason is why a connection closed, it is passed to Handler OnDisconnected
+type CloseReason struct {
+	Code      CloseCode
+	Initiator CloseInitiator
+	// Err is the error caused closing, nil when closed normally
+	Err error
+}
+
+// NewCloseReason will create CloseReason of code initiated by the code Initiator
+func NewCloseReason(code CloseCode, err error) *CloseReason {
+	return &CloseReason{Code: code, Initiator: code.Initiator(), Err: err}
+}
+
+func (r *CloseReason) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s by %s: %v", r.Code, r.Initiator, r.Err)
+	}
+	return fmt.Sprintf("%s by %s", r.Code, r.Initiator)
+}
+
+// Logger will return l with fields of the reason
+func (r *CloseReason) Logger(l logger.Logger) logger.Logger {
+	l = l.WithField("close_code", r.Code.String()).WithField("close_initiator", r.Initiator.String())
+	if r.Err != nil {
+		l = l.WithField("close_error", r.Err.Error())
+	}
+	return l
+}
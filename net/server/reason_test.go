@@ -0,0 +1,28 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/logger"
+)
+
+func TestCloseReason(t *testing.T) {
+	reason := NewCloseReason(CloseTimeout, ErrReadDeadline)
+	assert.Equal(t, reason.Initiator, InitiatorServer)
+	assert.Equal(t, reason.String(), "timeout by server: connection read deadline exceeded")
+	assert.Equal(t, NewCloseReason(ClosePeer, nil).String(), "peer_closed by peer")
+	assert.Equal(t, NewCloseReason(CloseHandler, nil).Initiator, InitiatorHandler)
+	assert.Equal(t, NewCloseReason(CloseIOError, errors.New("reset")).Initiator, InitiatorPeer)
+	assert.Equal(t, CloseCode(-1).String(), "unknown")
+	assert.Equal(t, CloseInitiator(-1).String(), "unknown")
+
+	var out bytes.Buffer
+	reason.Logger(logger.NewLogger(logger.WithWriter(&out))).InfoF("disconnected")
+	assert.Contains(t, out.String(), `"close_code":"timeout"`)
+	assert.Contains(t, out.String(), `"close_initiator":"server"`)
+	assert.Contains(t, out.String(), `"close_error":"connection read deadline exceeded"`)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrRouteNotFound is reported to Handler OnError when no route matches a frame and no NotFound hook is set
+var ErrRouteNotFound = errors.New("route not found")
+
+// ReceiveFunc is a function receiving frames like Handler OnReceived
+type ReceiveFunc func(frame []byte, conn Connection) (Action, error)
+
+// RouteMiddleware is wrapping a ReceiveFunc of a route to add behaviours
+type RouteMiddleware func(next ReceiveFunc) ReceiveFunc
+
+// RouteKey will extract the route key of a frame and the payload passed to the route
+// It returns false when the frame has no key, such frames are passed to the NotFound hook.
+type RouteKey func(frame []byte) (key string, payload []byte, ok bool)
+
+// OpcodeKey will return RouteKey of the first byte, the payload is the rest bytes
+func OpcodeKey() RouteKey {
+	return func(frame []byte) (string, []byte, bool) {
+		if len(frame) == 0 {
+			return "", nil, false
+		}
+		return string(frame[:1]), frame[1:], true
+	}
+}
+
+// CommandKey will return RouteKey of the first token separated by sep, the payload is the bytes after sep
+func CommandKey(sep byte) RouteKey {
+	return func(frame []byte) (string, []byte, bool) {
+		if len(frame) == 0 {
+			return "", nil, false
+		}
+		i := bytes.IndexByte(frame, sep)
+		if i < 0 {
+			return string(frame), frame[len(frame):], true
+		}
+		return string(frame[:i]), frame[i+1:], true
+	}
+}
+
+// Router is Handler dispatching received frames to routes by key
+// Routes must be registered before the Router serving connections.
+type Router struct {
+	key      RouteKey
+	events   Handler
+	routes   map[string]ReceiveFunc
+	notFound ReceiveFunc
+}
+
+// NewRouter will create Router dispatching frames by key
+// The connection events except OnReceived are passed to events, they are ignored when events is nil.
+func NewRouter(key RouteKey, events Handler) *Router {
+	return &Router{
+		key:    key,
+		events: events,
+		routes: make(map[string]ReceiveFunc),
+	}
+}
+
+// Handle will register fn as route of key, a route of the same key is replaced
+// The middlewares wrap fn in order, the first middleware is the outermost.
+func (r *Router) Handle(key string, fn ReceiveFunc, middlewares ...RouteMiddleware) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		fn = middlewares[i](fn)
+	}
+	r.routes[key] = fn
+}
+
+// HandleOpcode will register fn as route of opcode, it is used with OpcodeKey
+func (r *Router) HandleOpcode(opcode byte, fn ReceiveFunc, middlewares ...RouteMiddleware) {
+	r.Handle(string([]byte{opcode}), fn, middlewares...)
+}
+
+// NotFound will set fn to receive whole frames no route matched
+// Without it, ErrRouteNotFound is reported to OnError.
+func (r *Router) NotFound(fn ReceiveFunc) {
+	r.notFound = fn
+}
+
+func (r *Router) OnConnected(conn Connection) (Action, error) {
+	if r.events == nil {
+		return NothingAction, nil
+	}
+	return r.events.OnConnected(conn)
+}
+
+func (r *Router) OnDisconnected(conn Connection, reason *CloseReason) error {
+	if r.events == nil {
+		return nil
+	}
+	return r.events.OnDisconnected(conn, reason)
+}
+
+func (r *Router) OnReceived(frame []byte, conn Connection) (Action, error) {
+	key, payload, ok := r.key(frame)
+	if ok {
+		if fn, found := r.routes[key]; found {
+			return fn(payload, conn)
+		}
+	}
+	if r.notFound != nil {
+		return r.notFound(frame, conn)
+	}
+	return NothingAction, fmt.Errorf("%w: %q", ErrRouteNotFound, key)
+}
+
+// OnStream will pass streamed frames to events when it is a StreamHandler, otherwise the whole frames are routed
+func (r *Router) OnStream(header []byte, body io.Reader, conn Connection) (Action, error) {
+	if sh, ok := r.events.(StreamHandler); ok {
+		return sh.OnStream(header, body, conn)
+	}
+	return ReceiveStream(r.OnReceived, header, body, conn)
+}
+
+func (r *Router) OnError(conn Connection, err error) Action {
+	if r.events == nil {
+		return NothingAction
+	}
+	return r.events.OnError(conn, err)
+}
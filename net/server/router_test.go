@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpcodeKey(t *testing.T) {
+	key, payload, ok := OpcodeKey()([]byte{0x01, 0x02})
+	assert.True(t, ok)
+	assert.Equal(t, key, "\x01")
+	assert.Equal(t, payload, []byte{0x02})
+	_, _, ok = OpcodeKey()(nil)
+	assert.False(t, ok)
+}
+
+func TestCommandKey(t *testing.T) {
+	key, payload, ok := CommandKey(' ')([]byte("SET k v"))
+	assert.True(t, ok)
+	assert.Equal(t, key, "SET")
+	assert.Equal(t, string(payload), "k v")
+	key, payload, ok = CommandKey(' ')([]byte("PING"))
+	assert.True(t, ok)
+	assert.Equal(t, key, "PING")
+	assert.Empty(t, payload)
+	_, _, ok = CommandKey(' ')([]byte{})
+	assert.False(t, ok)
+}
+
+func TestRouter(t *testing.T) {
+	var events []string
+	router := NewRouter(CommandKey(' '), &recordHandler{name: "h", events: &events})
+	tag := func(name string) RouteMiddleware {
+		return func(next ReceiveFunc) ReceiveFunc {
+			return func(frame []byte, conn Connection) (Action, error) {
+				events = append(events, name)
+				return next(frame, conn)
+			}
+		}
+	}
+	router.Handle("ECHO", func(frame []byte, conn Connection) (Action, error) {
+		return NothingAction, conn.Send(frame, false)
+	}, tag("outer"), tag("inner"))
+	router.Handle("QUIT", func(frame []byte, conn Connection) (Action, error) {
+		return DisconnectionAction, nil
+	})
+	conn := newTestConnection()
+
+	action, err := router.OnConnected(conn)
+	assert.Equal(t, action, NothingAction)
+	assert.Nil(t, err)
+	action, err = router.OnReceived([]byte("ECHO hello"), conn)
+	assert.Equal(t, action, NothingAction)
+	assert.Nil(t, err)
+	assert.Equal(t, conn.sent, [][]byte{[]byte("hello")})
+	action, _ = router.OnReceived([]byte("QUIT"), conn)
+	assert.Equal(t, action, DisconnectionAction)
+
+	action, err = router.OnReceived([]byte("NOPE x"), conn)
+	assert.Equal(t, action, NothingAction)
+	assert.ErrorIs(t, err, ErrRouteNotFound)
+	assert.Equal(t, router.OnError(conn, err), NothingAction)
+	assert.Nil(t, router.OnDisconnected(conn, NewCloseReason(ClosePeer, nil)))
+	assert.Equal(t, events, []string{"h connected", "outer", "inner", `h error route not found: "NOPE"`, "h disconnected peer_closed"})
+
+	router.NotFound(func(frame []byte, conn Connection) (Action, error) {
+		return StopServerAction, errors.New(string(frame))
+	})
+	action, err = router.OnReceived([]byte("NOPE x"), conn)
+	assert.Equal(t, action, StopServerAction)
+	assert.EqualError(t, err, "NOPE x")
+}
+
+func TestRouter_Opcode(t *testing.T) {
+	router := NewRouter(OpcodeKey(), nil)
+	router.HandleOpcode(0x01, func(frame []byte, conn Connection) (Action, error) {
+		return NothingAction, conn.Send(frame, false)
+	})
+	conn := newTestConnection()
+	action, err := router.OnConnected(conn)
+	assert.Equal(t, action, NothingAction)
+	assert.Nil(t, err)
+	router.OnReceived([]byte{0x01, 0x02}, conn)
+	assert.Equal(t, conn.sent, [][]byte{{0x02}})
+	// streamed frames are routed as whole frames when events is not a StreamHandler
+	action, err = router.OnStream([]byte{0x01}, bytes.NewReader([]byte{0x03}), conn)
+	assert.Equal(t, action, NothingAction)
+	assert.Nil(t, err)
+	assert.Equal(t, conn.sent, [][]byte{{0x02}, {0x03}})
+	_, err = router.OnReceived(nil, conn)
+	assert.ErrorIs(t, err, ErrRouteNotFound)
+	assert.Equal(t, router.OnError(conn, err), NothingAction)
+	assert.Nil(t, router.OnDisconnected(conn, NewCloseReason(ClosePeer, nil)))
+}
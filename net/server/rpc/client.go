@@ -0,0 +1,221 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+var (
+	// ErrClientClosed will throw when call on a closed Client
+	ErrClientClosed = errors.New("rpc client closed")
+	// ErrFrameTooLarge will throw when a received frame larger than Client buffer capacity
+	ErrFrameTooLarge = errors.New("rpc frame too large")
+)
+
+// Error is the error replied by server method
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is make errors.Is(err, ErrMethodNotFound) and errors.Is(err, ErrDuplicateID) work with replied error
+func (e *Error) Is(target error) bool {
+	return (target == ErrMethodNotFound || target == ErrDuplicateID) && e.Message == target.Error()
+}
+
+// Client is rpc client of a connection
+// It is safe to Call from multiple goroutines.
+type Client struct {
+	opts    Options
+	conn    net.Conn
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *message
+	err     error
+	done    chan struct{}
+}
+
+// Dial will connect to address and create Client
+func Dial(network, address string, opts ...Option) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn, opts...), nil
+}
+
+// NewClient will create Client on conn
+// The Client owns conn, it will be closed when Client closed.
+func NewClient(conn net.Conn, opts ...Option) *Client {
+	c := &Client{
+		opts:    newOptions(opts...),
+		conn:    conn,
+		pending: make(map[uint64]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.loop()
+	return c
+}
+
+// Call will call method with args and Unmarshal result to reply
+// The reply can be nil when caller don't care the result.
+// The call stops when ctx done or Options Timeout reached, and server will be notified to cancel it.
+func (c *Client) Call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if len(method) > maxMethodLength {
+		return ErrMalformedMessage
+	}
+	payload, err := c.opts.Serializer.Marshal(args)
+	if err != nil {
+		return err
+	}
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	if err := c.write(&message{kind: requestKind, id: id, method: method, payload: payload}); err != nil {
+		c.forget(id)
+		return err
+	}
+	select {
+	case msg := <-ch:
+		if msg == nil {
+			return c.closedErr()
+		}
+		if msg.kind == errorKind {
+			return &Error{Message: string(msg.payload)}
+		}
+		if reply == nil {
+			return nil
+		}
+		return c.opts.Serializer.Unmarshal(msg.payload, reply)
+	case <-ctx.Done():
+		if c.forget(id) {
+			_ = c.write(&message{kind: cancelKind, id: id, method: method})
+		}
+		return ctx.Err()
+	}
+}
+
+// Close will close the Client and its connection
+// All pending calls will get ErrClientClosed error.
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	c.fail(ErrClientClosed)
+	return err
+}
+
+// Done will return a channel closed when Client closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err will return the reason of Client closed
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) closedErr() error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return ErrClientClosed
+}
+
+func (c *Client) forget(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.pending[id]
+	delete(c.pending, id)
+	return ok
+}
+
+func (c *Client) write(msg *message) error {
+	frame := c.opts.Codec.Encode(msg.marshal())
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	close(c.done)
+}
+
+func (c *Client) dispatch(frame []byte) error {
+	msg, err := unmarshalMessage(frame)
+	if err != nil {
+		return err
+	}
+	if msg.kind != responseKind && msg.kind != errorKind {
+		return ErrMalformedMessage
+	}
+	c.mu.Lock()
+	ch, ok := c.pending[msg.id]
+	delete(c.pending, msg.id)
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+	return nil
+}
+
+func (c *Client) loop() {
+	buf := buffer.NewBuffer(c.opts.BufferCapacity)
+	b := make([]byte, buf.Capacity())
+	for {
+		n, err := c.conn.Read(b[:buf.Capacity()-buf.Size()])
+		if err != nil {
+			c.conn.Close()
+			c.fail(err)
+			return
+		}
+		_, _ = buf.Write(b[:n])
+		for buf.Size() > 0 {
+			frame := c.opts.Codec.Decode(buf)
+			if frame == nil {
+				break
+			}
+			if err := c.dispatch(frame); err != nil {
+				c.conn.Close()
+				c.fail(err)
+				return
+			}
+		}
+		if buf.Size() == buf.Capacity() {
+			c.conn.Close()
+			c.fail(ErrFrameTooLarge)
+			return
+		}
+	}
+}
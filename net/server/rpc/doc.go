@@ -0,0 +1,6 @@
+// Package rpc is a request/response layer on top of server Codec frames.
+// Every frame carries a message kind, a correlation id and a method name before the payload,
+// so many calls can be in flight on a single connection and completed out of order.
+// Server is a server.Handler dispatching requests to registered methods,
+// Client matches responses to pending calls and supports per-call timeout and cancellation.
+package rpc
@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformedMessage will throw when a frame can not be parsed as rpc message
+var ErrMalformedMessage = errors.New("malformed rpc message")
+
+// kind is the rpc message kind
+type kind byte
+
+const (
+	requestKind  kind = iota // call a method
+	responseKind             // result of a call
+	errorKind                // a call failed, payload is error message
+	cancelKind               // the caller gives up a call
+)
+
+// messageHeaderSize is size of kind(1) + id(8) + method length(2)
+const messageHeaderSize = 11
+
+// maxMethodLength is the max bytes length of method name
+const maxMethodLength = 1<<16 - 1
+
+type message struct {
+	kind    kind
+	id      uint64
+	method  string
+	payload []byte
+}
+
+func (m *message) marshal() []byte {
+	b := make([]byte, messageHeaderSize+len(m.method)+len(m.payload))
+	b[0] = byte(m.kind)
+	binary.BigEndian.PutUint64(b[1:9], m.id)
+	binary.BigEndian.PutUint16(b[9:11], uint16(len(m.method)))
+	copy(b[messageHeaderSize:], m.method)
+	copy(b[messageHeaderSize+len(m.method):], m.payload)
+	return b
+}
+
+func unmarshalMessage(b []byte) (*message, error) {
+	if len(b) < messageHeaderSize {
+		return nil, ErrMalformedMessage
+	}
+	m := &message{
+		kind: kind(b[0]),
+		id:   binary.BigEndian.Uint64(b[1:9]),
+	}
+	if m.kind > cancelKind {
+		return nil, ErrMalformedMessage
+	}
+	methodLength := int(binary.BigEndian.Uint16(b[9:11]))
+	if len(b) < messageHeaderSize+methodLength {
+		return nil, ErrMalformedMessage
+	}
+	m.method = string(b[messageHeaderSize : messageHeaderSize+methodLength])
+	// copy payload, the frame may be reused by the codec after return
+	m.payload = append([]byte{}, b[messageHeaderSize+methodLength:]...)
+	return m, nil
+}
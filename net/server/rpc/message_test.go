@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage(t *testing.T) {
+	msg := &message{kind: requestKind, id: 42, method: "echo", payload: []byte("hello")}
+	b := msg.marshal()
+	assert.Equal(t, len(b), messageHeaderSize+4+5)
+	got, err := unmarshalMessage(b)
+	assert.Nil(t, err)
+	assert.Equal(t, got, msg)
+	got, err = unmarshalMessage((&message{kind: cancelKind, id: 1}).marshal())
+	assert.Nil(t, err)
+	assert.Equal(t, got.kind, cancelKind)
+	assert.Equal(t, got.method, "")
+	assert.Empty(t, got.payload)
+
+	_, err = unmarshalMessage(b[:messageHeaderSize-1])
+	assert.ErrorIs(t, err, ErrMalformedMessage)
+	_, err = unmarshalMessage(b[:messageHeaderSize+2])
+	assert.ErrorIs(t, err, ErrMalformedMessage)
+	b[0] = 0xff
+	_, err = unmarshalMessage(b)
+	assert.ErrorIs(t, err, ErrMalformedMessage)
+}
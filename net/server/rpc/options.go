@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Options defined rpc server and client options
+type Options struct {
+	// Serializer is used to Marshal and Unmarshal call arguments and replies
+	Serializer server.Serializer
+	// Codec is used by Client to split frames from connection
+	// It must be same as the server Codec
+	Codec server.Codec
+	// Timeout is the default timeout of each Client call
+	// Zero means no timeout, the call only stop by context
+	Timeout time.Duration
+	// BufferCapacity is the Client read buffer capacity
+	// It limits the max frame size the Client can receive
+	BufferCapacity int
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Serializer:     new(server.JSONSerializer),
+		Codec:          new(server.LengthFieldCodec),
+		BufferCapacity: 64 * 1024,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithSerializer is edit Options Serializer field
+func WithSerializer(serializer server.Serializer) Option {
+	return func(options *Options) {
+		options.Serializer = serializer
+	}
+}
+
+// WithCodec is edit Options Codec field
+func WithCodec(codec server.Codec) Option {
+	return func(options *Options) {
+		options.Codec = codec
+	}
+}
+
+// WithTimeout is edit Options Timeout field
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+// WithBufferCapacity is edit Options BufferCapacity field
+func WithBufferCapacity(capacity int) Option {
+	return func(options *Options) {
+		options.BufferCapacity = capacity
+	}
+}
@@ -0,0 +1,199 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+var (
+	// ErrMethodExists will throw when register a method name twice
+	ErrMethodExists = errors.New("rpc method already registered")
+	// ErrMethodNotFound is the error message replied when call an unregistered method
+	ErrMethodNotFound = errors.New("rpc method not found")
+	// ErrDuplicateID is the error message replied when call with the id of a call still in flight
+	ErrDuplicateID = errors.New("rpc call id already in flight")
+)
+
+// Method is the registered function of a rpc method
+// The ctx will be canceled when the caller cancels the call or the connection disconnected.
+// The returned value will be marshaled by Serializer as the reply.
+type Method func(ctx context.Context, req *Request) (interface{}, error)
+
+// Request is a received call
+type Request struct {
+	// ID is the correlation id of the call
+	ID uint64
+	// Method is the called method name
+	Method string
+	// Conn is the connection which the call come from
+	Conn server.Connection
+
+	payload    []byte
+	serializer server.Serializer
+}
+
+// Decode will Unmarshal call arguments to v
+func (r *Request) Decode(v interface{}) error {
+	return r.serializer.Unmarshal(r.payload, v)
+}
+
+// Payload will return the raw arguments bytes
+func (r *Request) Payload() []byte {
+	return r.payload
+}
+
+type session struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	calls  map[uint64]context.CancelFunc
+}
+
+// Server is a server.Handler dispatch rpc requests to registered methods
+// Every request runs in its own goroutine, so Connection.Send must be safe for concurrent use.
+type Server struct {
+	opts     Options
+	mu       sync.RWMutex
+	methods  map[string]Method
+	sessions sync.Map
+}
+
+// NewServer will create rpc Server
+func NewServer(opts ...Option) *Server {
+	return &Server{
+		opts:    newOptions(opts...),
+		methods: make(map[string]Method),
+	}
+}
+
+// Register is register method by name
+// When name already registered will throw ErrMethodExists error
+func (s *Server) Register(name string, method Method) error {
+	if len(name) > maxMethodLength {
+		return fmt.Errorf("rpc method name too long: %d", len(name))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.methods[name]; ok {
+		return ErrMethodExists
+	}
+	s.methods[name] = method
+	return nil
+}
+
+func (s *Server) method(name string) (Method, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.methods[name]
+	return m, ok
+}
+
+func (s *Server) OnConnected(conn server.Connection) (server.Action, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.sessions.Store(conn, &session{ctx: ctx, cancel: cancel, calls: make(map[uint64]context.CancelFunc)})
+	return server.NothingAction, nil
+}
+
+func (s *Server) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	if v, ok := s.sessions.LoadAndDelete(conn); ok {
+		v.(*session).cancel()
+	}
+	return nil
+}
+
+func (s *Server) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	msg, err := unmarshalMessage(frame)
+	if err != nil {
+		return server.NothingAction, err
+	}
+	v, ok := s.sessions.Load(conn)
+	if !ok {
+		return server.NothingAction, nil
+	}
+	sess := v.(*session)
+	switch msg.kind {
+	case requestKind:
+		sess.mu.Lock()
+		if _, ok := sess.calls[msg.id]; ok {
+			sess.mu.Unlock()
+			// the call in flight keeps its entry, so it can still be canceled
+			reply := &message{kind: errorKind, id: msg.id, payload: []byte(ErrDuplicateID.Error())}
+			return server.NothingAction, conn.Send(reply.marshal(), false)
+		}
+		ctx, cancel := context.WithCancel(sess.ctx)
+		sess.calls[msg.id] = cancel
+		sess.mu.Unlock()
+		go s.serve(ctx, sess, conn, msg)
+	case cancelKind:
+		sess.mu.Lock()
+		cancel, ok := sess.calls[msg.id]
+		sess.mu.Unlock()
+		if ok {
+			cancel()
+		}
+	default:
+		return server.NothingAction, ErrMalformedMessage
+	}
+	return server.NothingAction, nil
+}
+
+func (s *Server) OnError(conn server.Connection, err error) server.Action {
+	conn.Logger().ErrorF("rpc error: %v", err)
+	if errors.Is(err, ErrMalformedMessage) {
+		return server.DisconnectionAction
+	}
+	return server.NothingAction
+}
+
+func (s *Server) serve(ctx context.Context, sess *session, conn server.Connection, msg *message) {
+	defer func() {
+		sess.mu.Lock()
+		cancel := sess.calls[msg.id]
+		delete(sess.calls, msg.id)
+		sess.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+	}()
+	reply := &message{kind: responseKind, id: msg.id}
+	if err := s.call(ctx, conn, msg, reply); err != nil {
+		reply.kind = errorKind
+		reply.payload = []byte(err.Error())
+	}
+	if ctx.Err() != nil {
+		// the caller gave up or connection closed, nobody wait the reply
+		return
+	}
+	if err := conn.Send(reply.marshal(), false); err != nil {
+		conn.Logger().WarnF("rpc reply %s#%d failed: %v", msg.method, msg.id, err)
+	}
+}
+
+func (s *Server) call(ctx context.Context, conn server.Connection, msg *message, reply *message) (err error) {
+	method, ok := s.method(msg.method)
+	if !ok {
+		return ErrMethodNotFound
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			conn.Logger().ErrorF("rpc method %s panic: %v", msg.method, r)
+			err = fmt.Errorf("rpc method %s panic: %v", msg.method, r)
+		}
+	}()
+	result, err := method(ctx, &Request{
+		ID:         msg.id,
+		Method:     msg.method,
+		Conn:       conn,
+		payload:    msg.payload,
+		serializer: s.opts.Serializer,
+	})
+	if err != nil {
+		return err
+	}
+	reply.payload, err = s.opts.Serializer.Marshal(result)
+	return err
+}
@@ -0,0 +1,332 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+// pipeConnection is Connection writing to a net.Conn, methods not used by handlers are left unimplemented
+type pipeConnection struct {
+	server.Connection
+	conn  net.Conn
+	codec server.Codec
+}
+
+func (p *pipeConnection) Send(data []byte, withoutEncode bool) error {
+	if !withoutEncode {
+		data = p.codec.Encode(data)
+	}
+	_, err := p.conn.Write(data)
+	return err
+}
+
+func (p *pipeConnection) Remote() string {
+	return "pipe"
+}
+
+func (p *pipeConnection) Local() string {
+	return "pipe"
+}
+
+func (p *pipeConnection) Logger() logger.Logger {
+	return logger.NewLogger(logger.WithWriter(io.Discard))
+}
+
+// serve will drive handler with frames read from conn until conn closed
+func serve(t *testing.T, conn net.Conn, handler server.Handler) {
+	codec := new(server.LengthFieldCodec)
+	pc := &pipeConnection{conn: conn, codec: codec}
+	_, err := handler.OnConnected(pc)
+	assert.Nil(t, err)
+	defer handler.OnDisconnected(pc, nil)
+	buf := buffer.NewBuffer(1024)
+	b := make([]byte, 1024)
+	for {
+		n, err := conn.Read(b[:buf.Capacity()-buf.Size()])
+		if err != nil {
+			return
+		}
+		buf.Write(b[:n])
+		for buf.Size() > 0 {
+			frame := codec.Decode(buf)
+			if frame == nil {
+				break
+			}
+			if _, err := handler.OnReceived(frame, pc); err != nil {
+				if handler.OnError(pc, err) == server.DisconnectionAction {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}
+}
+
+// serveHarness will return client side of a connection served by handler in servertest Harness
+func serveHarness(handler server.Handler) net.Conn {
+	client, _ := servertest.New(handler, servertest.WithCodec(new(server.LengthFieldCodec))).Pipe()
+	return client
+}
+
+func newTestServer(t *testing.T) *Server {
+	s := NewServer()
+	assert.Nil(t, s.Register("echo", func(ctx context.Context, req *Request) (interface{}, error) {
+		var v string
+		if err := req.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}))
+	assert.Nil(t, s.Register("fail", func(ctx context.Context, req *Request) (interface{}, error) {
+		return nil, errors.New("something wrong")
+	}))
+	assert.Nil(t, s.Register("panic", func(ctx context.Context, req *Request) (interface{}, error) {
+		panic("boom")
+	}))
+	return s
+}
+
+func TestServer_Register(t *testing.T) {
+	s := newTestServer(t)
+	assert.ErrorIs(t, s.Register("echo", nil), ErrMethodExists)
+}
+
+func TestClient_Call(t *testing.T) {
+	s := newTestServer(t)
+	released := make(chan struct{})
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		<-released
+		return "released", nil
+	}))
+	c1, c2 := net.Pipe()
+	go serve(t, c1, s)
+	client := NewClient(c2)
+	defer client.Close()
+
+	t.Run("test call", func(t *testing.T) {
+		var reply string
+		assert.Nil(t, client.Call(context.Background(), "echo", "hello", &reply))
+		assert.Equal(t, reply, "hello")
+		assert.Nil(t, client.Call(context.Background(), "echo", "nothing", nil))
+	})
+	t.Run("test error reply", func(t *testing.T) {
+		err := client.Call(context.Background(), "fail", nil, nil)
+		assert.Equal(t, err, &Error{Message: "something wrong"})
+		err = client.Call(context.Background(), "unknown", nil, nil)
+		assert.ErrorIs(t, err, ErrMethodNotFound)
+		err = client.Call(context.Background(), "panic", nil, nil)
+		assert.Contains(t, err.Error(), "boom")
+	})
+	t.Run("test out of order", func(t *testing.T) {
+		done := make(chan string)
+		go func() {
+			var reply string
+			assert.Nil(t, client.Call(context.Background(), "block", nil, &reply))
+			done <- reply
+		}()
+		var reply string
+		assert.Nil(t, client.Call(context.Background(), "echo", "first", &reply))
+		assert.Equal(t, reply, "first")
+		close(released)
+		assert.Equal(t, <-done, "released")
+	})
+}
+
+func TestClient_CallHarness(t *testing.T) {
+	s := newTestServer(t)
+	released := make(chan struct{})
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		<-released
+		return "released", nil
+	}))
+	conn := serveHarness(s)
+	client := NewClient(conn)
+	defer client.Close()
+
+	t.Run("test call", func(t *testing.T) {
+		var reply string
+		assert.Nil(t, client.Call(context.Background(), "echo", "hello", &reply))
+		assert.Equal(t, reply, "hello")
+		assert.Nil(t, client.Call(context.Background(), "echo", "nothing", nil))
+	})
+	t.Run("test error reply", func(t *testing.T) {
+		err := client.Call(context.Background(), "fail", nil, nil)
+		assert.Equal(t, err, &Error{Message: "something wrong"})
+		err = client.Call(context.Background(), "unknown", nil, nil)
+		assert.ErrorIs(t, err, ErrMethodNotFound)
+		err = client.Call(context.Background(), "panic", nil, nil)
+		assert.Contains(t, err.Error(), "boom")
+	})
+	t.Run("test out of order", func(t *testing.T) {
+		done := make(chan string)
+		go func() {
+			var reply string
+			assert.Nil(t, client.Call(context.Background(), "block", nil, &reply))
+			done <- reply
+		}()
+		var reply string
+		assert.Nil(t, client.Call(context.Background(), "echo", "first", &reply))
+		assert.Equal(t, reply, "first")
+		close(released)
+		assert.Equal(t, <-done, "released")
+	})
+}
+
+func TestClient_Cancel(t *testing.T) {
+	s := NewServer(WithSerializer(new(server.GobSerializer)))
+	canceled := make(chan struct{})
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}))
+	c1, c2 := net.Pipe()
+	go serve(t, c1, s)
+	client := NewClient(c2, WithSerializer(new(server.GobSerializer)), WithTimeout(time.Millisecond*50))
+	defer client.Close()
+	err := client.Call(context.Background(), "block", 1, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("server method should be canceled")
+	}
+}
+
+func TestClient_CancelHarness(t *testing.T) {
+	s := NewServer(WithSerializer(new(server.GobSerializer)))
+	canceled := make(chan struct{})
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}))
+	conn := serveHarness(s)
+	client := NewClient(conn, WithSerializer(new(server.GobSerializer)), WithTimeout(time.Millisecond*50))
+	defer client.Close()
+	err := client.Call(context.Background(), "block", 1, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("server method should be canceled")
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	s := NewServer()
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	c1, c2 := net.Pipe()
+	go serve(t, c1, s)
+	client := NewClient(c2)
+	errCh := make(chan error)
+	go func() {
+		errCh <- client.Call(context.Background(), "block", nil, nil)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	assert.Nil(t, client.Close())
+	assert.ErrorIs(t, <-errCh, ErrClientClosed)
+	<-client.Done()
+	assert.ErrorIs(t, client.Call(context.Background(), "block", nil, nil), ErrClientClosed)
+}
+
+func TestClient_CloseHarness(t *testing.T) {
+	s := NewServer()
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	conn := serveHarness(s)
+	client := NewClient(conn)
+	errCh := make(chan error)
+	go func() {
+		errCh <- client.Call(context.Background(), "block", nil, nil)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	assert.Nil(t, client.Close())
+	assert.ErrorIs(t, <-errCh, ErrClientClosed)
+	<-client.Done()
+	assert.ErrorIs(t, client.Call(context.Background(), "block", nil, nil), ErrClientClosed)
+}
+
+func TestServer_Malformed(t *testing.T) {
+	c1, c2 := net.Pipe()
+	go serve(t, c1, NewServer())
+	_, err := c2.Write(new(server.LengthFieldCodec).Encode([]byte{0x01}))
+	assert.Nil(t, err)
+	_, err = c2.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_MalformedHarness(t *testing.T) {
+	conn := serveHarness(NewServer())
+	_, err := conn.Write(new(server.LengthFieldCodec).Encode([]byte{0x01}))
+	assert.Nil(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// sentConnection will record data sent by handler, other methods are not used
+type sentConnection struct {
+	server.Connection
+	sent chan []byte
+}
+
+func (c *sentConnection) Send(data []byte, withoutEncode bool) error {
+	c.sent <- data
+	return nil
+}
+
+func (c *sentConnection) Logger() logger.Logger {
+	return logger.NewLogger(logger.WithWriter(io.Discard))
+}
+
+func TestServer_DuplicateID(t *testing.T) {
+	s := NewServer()
+	started := make(chan struct{}, 1)
+	canceled := make(chan struct{})
+	assert.Nil(t, s.Register("block", func(ctx context.Context, req *Request) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}))
+	conn := &sentConnection{sent: make(chan []byte, 1)}
+	_, err := s.OnConnected(conn)
+	assert.Nil(t, err)
+	defer s.OnDisconnected(conn, nil)
+	call := &message{kind: requestKind, id: 1, method: "block"}
+	_, err = s.OnReceived(call.marshal(), conn)
+	assert.Nil(t, err)
+	<-started
+	_, err = s.OnReceived(call.marshal(), conn)
+	assert.Nil(t, err)
+	reply, err := unmarshalMessage(<-conn.sent)
+	assert.Nil(t, err)
+	assert.Equal(t, reply.kind, errorKind)
+	assert.Equal(t, reply.id, uint64(1))
+	assert.ErrorIs(t, &Error{Message: string(reply.payload)}, ErrDuplicateID)
+	// the first call can still be canceled
+	cancel := &message{kind: cancelKind, id: 1}
+	_, err = s.OnReceived(cancel.marshal(), conn)
+	assert.Nil(t, err)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("first call should be canceled")
+	}
+}
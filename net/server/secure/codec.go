@@ -0,0 +1,118 @@
+package secure
+
+import (
+	"sync"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Codec is server.ConnCodec encrypting frames of each connection as the responder of Session
+// It is used as server Codec, each connection gets its own Session by NewConnCodec.
+// Frames sent before handshake completed are held, and sent sealed after the server hello.
+type Codec struct {
+	key     []byte
+	inner   server.Codec
+	options Options
+}
+
+// NewCodec will create Codec of pre-shared key, records are framed by inner
+func NewCodec(key []byte, inner server.Codec, opts ...Option) *Codec {
+	return &Codec{key: key, inner: inner, options: newOptions(opts...)}
+}
+
+// Encode will return nil, frames are only encoded by the Codec of each connection
+func (c *Codec) Encode(b []byte) []byte {
+	return nil
+}
+
+// Decode will return nil, frames are only decoded by the Codec of each connection
+func (c *Codec) Decode(buf buffer.Buffer) []byte {
+	return nil
+}
+
+func (c *Codec) NewConnCodec(conn server.Connection) server.Codec {
+	cc := &connCodec{Codec: c, conn: conn}
+	cc.session, cc.err = newSession(c.key, false, c.options)
+	return cc
+}
+
+type connCodec struct {
+	*Codec
+	conn    server.Connection
+	session *Session
+	// err is the error of creating session, it is reported by decoding
+	err error
+
+	// mu serializes sealing with handshake, so held frames are sent before the later ones
+	mu   sync.Mutex
+	held [][]byte
+}
+
+func (c *connCodec) Encode(b []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil || !c.session.Established() {
+		c.held = append(c.held, append([]byte{}, b...))
+		return []byte{}
+	}
+	record, err := c.session.Seal(b)
+	if err != nil {
+		return []byte{}
+	}
+	return c.inner.Encode(record)
+}
+
+func (c *connCodec) Decode(buf buffer.Buffer) []byte {
+	frame, _ := c.DecodeError(buf)
+	return frame
+}
+
+func (c *connCodec) DecodeError(buf buffer.Buffer) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	for {
+		record, err := c.decodeRecord(buf)
+		if err != nil || record == nil {
+			return nil, err
+		}
+		if c.session.Established() {
+			return c.session.Open(record)
+		}
+		// the hello is consumed, so the records following it are decoded in this call
+		if err := c.handshake(record); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *connCodec) decodeRecord(buf buffer.Buffer) ([]byte, error) {
+	if ec, ok := c.inner.(server.ErrorCodec); ok {
+		return ec.DecodeError(buf)
+	}
+	return c.inner.Decode(buf), nil
+}
+
+// handshake will accept the client hello, reply the server hello and send held frames
+func (c *connCodec) handshake(hello []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.session.Accept(hello); err != nil {
+		return err
+	}
+	if err := c.conn.Send(c.inner.Encode(c.session.Hello()), true); err != nil {
+		return err
+	}
+	for _, frame := range c.held {
+		record, err := c.session.Seal(frame)
+		if err != nil {
+			return err
+		}
+		if err := c.conn.Send(c.inner.Encode(record), true); err != nil {
+			return err
+		}
+	}
+	c.held = nil
+	return nil
+}
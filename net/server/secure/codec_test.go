@@ -0,0 +1,154 @@
+package secure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/net/server"
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+type echoHandler struct {
+	greeting []byte
+}
+
+func (e *echoHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	if e.greeting != nil {
+		return server.NothingAction, conn.Send(e.greeting, false)
+	}
+	return server.NothingAction, nil
+}
+
+func (e *echoHandler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	return nil
+}
+
+func (e *echoHandler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	return server.NothingAction, conn.Send(frame, false)
+}
+
+func (e *echoHandler) OnError(conn server.Connection, err error) server.Action {
+	return server.NothingAction
+}
+
+// client is the initiator side reading records sent by servertest Conn
+type client struct {
+	t       *testing.T
+	conn    *servertest.Conn
+	session *Session
+	codec   *server.LengthFieldCodec
+	// read is bytes length of Conn Bytes decoded
+	read int
+}
+
+func connect(t *testing.T, h *servertest.Harness, key []byte) *client {
+	session, err := NewSession(key, true)
+	assert.Nil(t, err)
+	c := &client{t: t, conn: h.Connect(), session: session, codec: new(server.LengthFieldCodec)}
+	assert.Nil(t, c.conn.Write(c.codec.Encode(session.Hello())))
+	return c
+}
+
+// records will return records sent by server since last call
+func (c *client) records() [][]byte {
+	raw := c.conn.Bytes()[c.read:]
+	c.read += len(raw)
+	buf := buffer.NewBuffer(len(raw) + 1)
+	buf.Write(raw)
+	var records [][]byte
+	for record := c.codec.Decode(buf); record != nil; record = c.codec.Decode(buf) {
+		records = append(records, record)
+	}
+	return records
+}
+
+func (c *client) handshake() {
+	records := c.records()
+	if assert.NotEmpty(c.t, records) {
+		assert.Nil(c.t, c.session.Accept(records[0]))
+	}
+}
+
+func (c *client) seal(frame string) []byte {
+	record, err := c.session.Seal([]byte(frame))
+	assert.Nil(c.t, err)
+	return c.codec.Encode(record)
+}
+
+func (c *client) frames() []string {
+	var frames []string
+	for _, record := range c.records() {
+		frame, err := c.session.Open(record)
+		assert.Nil(c.t, err)
+		frames = append(frames, string(frame))
+	}
+	return frames
+}
+
+func TestCodec(t *testing.T) {
+	key := []byte("pre-shared key")
+	handler := &echoHandler{greeting: []byte("welcome")}
+	h := servertest.New(handler, servertest.WithCodec(NewCodec(key, new(server.LengthFieldCodec))))
+
+	t.Run("test echo", func(t *testing.T) {
+		c := connect(t, h, key)
+		records := c.records()
+		// the greeting sent by OnConnected is held until handshake completed
+		assert.Len(t, records, 2)
+		assert.Nil(t, c.session.Accept(records[0]))
+		frame, err := c.session.Open(records[1])
+		assert.Nil(t, err)
+		assert.Equal(t, string(frame), "welcome")
+
+		assert.Nil(t, c.conn.Write(append(c.seal("hello"), c.seal("world")...)))
+		assert.Equal(t, c.frames(), []string{"hello", "world"})
+		assert.NotContains(t, string(c.conn.Bytes()), "hello")
+		assert.False(t, c.conn.Disconnected())
+	})
+
+	t.Run("test tampered", func(t *testing.T) {
+		c := connect(t, h, key)
+		c.handshake()
+		data := c.seal("hello")
+		data[len(data)-1] ^= 1
+		assert.Nil(t, c.conn.Write(data))
+		assert.True(t, c.conn.Disconnected())
+		assert.ErrorIs(t, c.conn.Errors()[0], ErrTampered)
+		assert.Equal(t, c.conn.Reason().Code, server.CloseCodecError)
+	})
+
+	t.Run("test replayed", func(t *testing.T) {
+		c := connect(t, h, key)
+		c.handshake()
+		data := c.seal("hello")
+		assert.Nil(t, c.conn.Write(data))
+		assert.Equal(t, c.frames(), []string{"hello"})
+		assert.Nil(t, c.conn.Write(data))
+		assert.True(t, c.conn.Disconnected())
+		assert.ErrorIs(t, c.conn.Errors()[0], ErrReplayed)
+	})
+
+	t.Run("test wrong key", func(t *testing.T) {
+		c := connect(t, h, []byte("wrong key"))
+		assert.True(t, c.conn.Disconnected())
+		assert.ErrorIs(t, c.conn.Errors()[0], ErrHandshake)
+		assert.Empty(t, c.records())
+	})
+}
+
+func TestCodec_SplitHello(t *testing.T) {
+	key := []byte("pre-shared key")
+	h := servertest.New(new(echoHandler), servertest.WithCodec(NewCodec(key, new(server.LengthFieldCodec))))
+	session, err := NewSession(key, true)
+	assert.Nil(t, err)
+	c := &client{t: t, conn: h.Connect(), session: session, codec: new(server.LengthFieldCodec)}
+	hello := c.codec.Encode(session.Hello())
+	assert.Nil(t, c.conn.WriteChunks(hello[:40], 10, 30))
+	assert.Empty(t, c.records())
+	assert.Nil(t, c.conn.Write(hello[40:]))
+	c.handshake()
+	assert.Nil(t, c.conn.Write(c.seal("a")))
+	assert.Equal(t, c.frames(), []string{"a"})
+}
@@ -0,0 +1,10 @@
+// Package secure is an encrypted framing Codec for links which can not use TLS.
+// Codec wraps an inner server.Codec, like server.LengthFieldCodec, and each inner frame is a record.
+// The first record of each side is a hello carrying an ephemeral P-256 ECDH public key authenticated by the pre-shared key,
+// the client (initiator) sends its hello first and the server (responder) replies.
+// Keys and nonce prefixes of each direction are derived from the pre-shared key and the ECDH shared secret,
+// the following records are sealed by an AEAD, AES-256-GCM by default or ChaCha20-Poly1305 plugged by WithCipher.
+// Each record carries its sequence number, records replayed or too old are rejected,
+// and tampered records are reported as decode errors so the connection is disconnected.
+// Clients use Session to run the same handshake and seal records.
+package secure
@@ -0,0 +1,42 @@
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// Options defined Session and Codec options
+type Options struct {
+	// Cipher will create the AEAD of a 32 bytes key, default AES-256-GCM
+	// The AEAD nonce size must be 12 bytes, so chacha20poly1305.New of golang.org/x/crypto fits.
+	Cipher func(key []byte) (cipher.AEAD, error)
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Cipher: AESGCM,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithCipher is edit Options Cipher field
+func WithCipher(cipher func(key []byte) (cipher.AEAD, error)) Option {
+	return func(options *Options) {
+		options.Cipher = cipher
+	}
+}
+
+// AESGCM will create AES-GCM AEAD of key
+func AESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
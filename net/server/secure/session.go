@@ -0,0 +1,238 @@
+package secure
+
+import (
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// KeySize is the bytes length of AEAD keys
+	KeySize = 32
+	// NonceSize is the bytes length of AEAD nonces, a 4 bytes prefix of direction and the sequence number
+	NonceSize = 12
+	// HelloSize is the bytes length of hello records
+	HelloSize = publicKeySize + sha256.Size
+	// SeqSize is the bytes length of the sequence number beginning each sealed record
+	SeqSize = 8
+	// ReplayWindow is how many records before the newest one can still be received out of order
+	ReplayWindow = 64
+
+	publicKeySize = 65
+	prefixSize    = NonceSize - SeqSize
+)
+
+var (
+	// ErrHandshake will throw when the peer hello is malformed or not authenticated by the pre-shared key
+	ErrHandshake = errors.New("secure handshake failed")
+	// ErrNotEstablished will throw when sealing or opening records before handshake completed
+	ErrNotEstablished = errors.New("secure session not established")
+	// ErrTampered will throw when a record is malformed or fails authentication
+	ErrTampered = errors.New("secure record tampered")
+	// ErrReplayed will throw when a record was received or is older than ReplayWindow
+	ErrReplayed = errors.New("secure record replayed")
+)
+
+// Session is the encryption state of one side of a connection
+// The initiator (client) sends Hello first, the responder (server) replies its Hello after Accept.
+// Seal is safe for concurrent use, Open must be called by one goroutine.
+type Session struct {
+	options   Options
+	key       []byte
+	initiator bool
+	private   []byte
+	hello     []byte
+
+	established bool
+	send        cipher.AEAD
+	recv        cipher.AEAD
+	sendPrefix  []byte
+	recvPrefix  []byte
+	// seq is the next sequence number sealed, it is accessed atomically
+	seq    uint64
+	window replayWindow
+}
+
+// NewSession will create Session of pre-shared key with a fresh ECDH key pair
+func NewSession(key []byte, initiator bool, opts ...Option) (*Session, error) {
+	return newSession(key, initiator, newOptions(opts...))
+}
+
+func newSession(key []byte, initiator bool, options Options) (*Session, error) {
+	private, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		options:   options,
+		key:       key,
+		initiator: initiator,
+		private:   private,
+	}
+	public := elliptic.Marshal(elliptic.P256(), x, y)
+	s.hello = append(public, s.helloMAC(public, initiator)...)
+	return s, nil
+}
+
+// Hello will return the hello record sent to peer
+func (s *Session) Hello() []byte {
+	return s.hello
+}
+
+// Established will return whether handshake completed
+func (s *Session) Established() bool {
+	return s.established
+}
+
+// Accept will complete handshake by the peer hello record
+// It must be called before Seal and Open, and only once.
+func (s *Session) Accept(hello []byte) error {
+	if s.established {
+		return fmt.Errorf("%w: hello accepted already", ErrHandshake)
+	}
+	if len(hello) != HelloSize {
+		return fmt.Errorf("%w: hello of %d bytes", ErrHandshake, len(hello))
+	}
+	public, mac := hello[:publicKeySize], hello[publicKeySize:]
+	// the peer has the other role, so a reflected hello is rejected
+	if !hmac.Equal(mac, s.helloMAC(public, !s.initiator)) {
+		return fmt.Errorf("%w: hello not authenticated", ErrHandshake)
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), public)
+	if x == nil {
+		return fmt.Errorf("%w: invalid public key", ErrHandshake)
+	}
+	shared, _ := elliptic.P256().ScalarMult(x, y, s.private)
+	secret := make([]byte, KeySize)
+	shared.FillBytes(secret)
+
+	// the transcript binds keys to both hellos in the order of roles
+	transcript := append(append([]byte{}, s.hello[:publicKeySize]...), public...)
+	if !s.initiator {
+		transcript = append(append([]byte{}, public...), s.hello[:publicKeySize]...)
+	}
+	prk := mac256(s.key, secret)
+	sendKey, recvKey := mac256(prk, []byte("initiator key"), transcript), mac256(prk, []byte("responder key"), transcript)
+	sendPrefix := mac256(prk, []byte("initiator nonce"), transcript)[:prefixSize]
+	recvPrefix := mac256(prk, []byte("responder nonce"), transcript)[:prefixSize]
+	if !s.initiator {
+		sendKey, recvKey = recvKey, sendKey
+		sendPrefix, recvPrefix = recvPrefix, sendPrefix
+	}
+	var err error
+	if s.send, err = s.aead(sendKey); err != nil {
+		return err
+	}
+	if s.recv, err = s.aead(recvKey); err != nil {
+		return err
+	}
+	s.sendPrefix, s.recvPrefix = sendPrefix, recvPrefix
+	s.private = nil
+	s.established = true
+	return nil
+}
+
+// Seal will encrypt frame to a record of its sequence number and ciphertext
+func (s *Session) Seal(frame []byte) ([]byte, error) {
+	if !s.established {
+		return nil, ErrNotEstablished
+	}
+	seq := atomic.AddUint64(&s.seq, 1) - 1
+	record := make([]byte, SeqSize, SeqSize+len(frame)+s.send.Overhead())
+	binary.BigEndian.PutUint64(record, seq)
+	return s.send.Seal(record, nonce(s.sendPrefix, seq), frame, nil), nil
+}
+
+// Open will decrypt a record sealed by peer
+// It returns ErrTampered when the record fails authentication and ErrReplayed when it is replayed or too old.
+func (s *Session) Open(record []byte) ([]byte, error) {
+	if !s.established {
+		return nil, ErrNotEstablished
+	}
+	if len(record) < SeqSize+s.recv.Overhead() {
+		return nil, fmt.Errorf("%w: record of %d bytes", ErrTampered, len(record))
+	}
+	seq := binary.BigEndian.Uint64(record)
+	if !s.window.check(seq) {
+		return nil, fmt.Errorf("%w: sequence %d", ErrReplayed, seq)
+	}
+	frame, err := s.recv.Open(make([]byte, 0, len(record)), nonce(s.recvPrefix, seq), record[SeqSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTampered, err)
+	}
+	// only authenticated records move the window, so forged sequence numbers can not block the peer
+	s.window.accept(seq)
+	return frame, nil
+}
+
+func (s *Session) helloMAC(public []byte, initiator bool) []byte {
+	role := []byte("responder hello")
+	if initiator {
+		role = []byte("initiator hello")
+	}
+	return mac256(s.key, role, public)
+}
+
+func (s *Session) aead(key []byte) (cipher.AEAD, error) {
+	aead, err := s.options.Cipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if aead.NonceSize() != NonceSize {
+		return nil, fmt.Errorf("secure cipher nonce size %d, want %d", aead.NonceSize(), NonceSize)
+	}
+	return aead, nil
+}
+
+func nonce(prefix []byte, seq uint64) []byte {
+	n := make([]byte, NonceSize)
+	copy(n, prefix)
+	binary.BigEndian.PutUint64(n[prefixSize:], seq)
+	return n
+}
+
+func mac256(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// replayWindow is the sliding window of received sequence numbers
+type replayWindow struct {
+	// next is the newest sequence number received plus one, zero means nothing received
+	next uint64
+	// seen has bit i set when sequence number next-1-i received
+	seen uint64
+}
+
+// check will return whether seq is not received and inside the window
+func (w *replayWindow) check(seq uint64) bool {
+	if seq >= w.next {
+		return true
+	}
+	diff := w.next - 1 - seq
+	return diff < ReplayWindow && w.seen&(1<<diff) == 0
+}
+
+// accept will mark seq received, it must be checked before
+func (w *replayWindow) accept(seq uint64) {
+	if seq < w.next {
+		w.seen |= 1 << (w.next - 1 - seq)
+		return
+	}
+	if shift := seq + 1 - w.next; shift >= ReplayWindow {
+		w.seen = 0
+	} else {
+		w.seen <<= shift
+	}
+	w.seen |= 1
+	w.next = seq + 1
+}
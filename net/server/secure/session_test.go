@@ -0,0 +1,130 @@
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSessions(t *testing.T, clientKey, serverKey []byte) (*Session, *Session) {
+	client, err := NewSession(clientKey, true)
+	assert.Nil(t, err)
+	server, err := NewSession(serverKey, false)
+	assert.Nil(t, err)
+	return client, server
+}
+
+func TestSession(t *testing.T) {
+	key := []byte("pre-shared key")
+	client, server := newSessions(t, key, key)
+	assert.Len(t, client.Hello(), HelloSize)
+	_, err := client.Seal([]byte("x"))
+	assert.ErrorIs(t, err, ErrNotEstablished)
+	assert.Nil(t, server.Accept(client.Hello()))
+	assert.Nil(t, client.Accept(server.Hello()))
+	assert.True(t, client.Established())
+	assert.ErrorIs(t, client.Accept(server.Hello()), ErrHandshake)
+
+	record, err := client.Seal([]byte("hello"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(record), "hello")
+	frame, err := server.Open(record)
+	assert.Nil(t, err)
+	assert.Equal(t, string(frame), "hello")
+
+	t.Run("test replayed", func(t *testing.T) {
+		_, err := server.Open(record)
+		assert.ErrorIs(t, err, ErrReplayed)
+	})
+
+	t.Run("test direction", func(t *testing.T) {
+		// a record can not be reflected to its sender
+		_, err := client.Open(record)
+		assert.ErrorIs(t, err, ErrTampered)
+		record, err := server.Seal([]byte("world"))
+		assert.Nil(t, err)
+		frame, err := client.Open(record)
+		assert.Nil(t, err)
+		assert.Equal(t, string(frame), "world")
+	})
+
+	t.Run("test tampered", func(t *testing.T) {
+		record, _ := client.Seal([]byte("hello"))
+		record[len(record)-1] ^= 1
+		_, err := server.Open(record)
+		assert.ErrorIs(t, err, ErrTampered)
+		_, err = server.Open(record[:SeqSize])
+		assert.ErrorIs(t, err, ErrTampered)
+	})
+
+	t.Run("test empty frame", func(t *testing.T) {
+		record, _ := client.Seal(nil)
+		frame, err := server.Open(record)
+		assert.Nil(t, err)
+		assert.NotNil(t, frame)
+		assert.Empty(t, frame)
+	})
+}
+
+func TestSession_Handshake(t *testing.T) {
+	client, server := newSessions(t, []byte("key"), []byte("other"))
+	assert.ErrorIs(t, server.Accept(client.Hello()), ErrHandshake)
+
+	client, server = newSessions(t, []byte("key"), []byte("key"))
+	other, _ := NewSession([]byte("key"), false)
+	// a hello of the same role is rejected
+	assert.ErrorIs(t, server.Accept(other.Hello()), ErrHandshake)
+	assert.ErrorIs(t, server.Accept(client.Hello()[1:]), ErrHandshake)
+	hello := append([]byte{}, client.Hello()...)
+	hello[10] ^= 1
+	assert.ErrorIs(t, server.Accept(hello), ErrHandshake)
+	assert.False(t, server.Established())
+
+	client, err := NewSession([]byte("key"), true, WithCipher(func(key []byte) (cipher.AEAD, error) {
+		block, _ := aes.NewCipher(key)
+		return cipher.NewGCMWithNonceSize(block, 16)
+	}))
+	assert.Nil(t, err)
+	assert.EqualError(t, client.Accept(server.Hello()), "secure cipher nonce size 16, want 12")
+}
+
+func TestSession_OutOfOrder(t *testing.T) {
+	client, server := newSessions(t, []byte("key"), []byte("key"))
+	assert.Nil(t, server.Accept(client.Hello()))
+	assert.Nil(t, client.Accept(server.Hello()))
+	records := make([][]byte, ReplayWindow+2)
+	for i := range records {
+		records[i], _ = client.Seal([]byte{byte(i)})
+	}
+	_, err := server.Open(records[1])
+	assert.Nil(t, err)
+	frame, err := server.Open(records[0])
+	assert.Nil(t, err)
+	assert.Equal(t, frame, []byte{0})
+	_, err = server.Open(records[0])
+	assert.ErrorIs(t, err, ErrReplayed)
+
+	_, err = server.Open(records[ReplayWindow+1])
+	assert.Nil(t, err)
+	// record 1 is out of the window, record 2 is the oldest inside it
+	_, err = server.Open(records[1])
+	assert.ErrorIs(t, err, ErrReplayed)
+	_, err = server.Open(records[2])
+	assert.Nil(t, err)
+	_, err = server.Open(records[2])
+	assert.ErrorIs(t, err, ErrReplayed)
+}
+
+func TestReplayWindow(t *testing.T) {
+	var w replayWindow
+	assert.True(t, w.check(0))
+	w.accept(0)
+	assert.False(t, w.check(0))
+	w.accept(1000)
+	assert.False(t, w.check(1000))
+	assert.False(t, w.check(1000-ReplayWindow))
+	assert.True(t, w.check(1000-ReplayWindow+1))
+	assert.True(t, w.check(1001))
+}
@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// maxSendFileSize is the max bytes of a sendfile call
+const maxSendFileSize = 1 << 30
+
+// sendFile will write file section to conn by sendfile(2)
+// The file offset is not changed, so the file can be sent by connections concurrently.
+// It is not handled when the file or connection does not support sendfile and nothing written.
+func sendFile(conn *net.TCPConn, f *os.File, offset, length int64) (written int64, handled bool, err error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	fc, err := f.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	var werr error
+	unsupported := false
+	cerr := fc.Control(func(in uintptr) {
+		err = rc.Write(func(out uintptr) bool {
+			for written < length {
+				size := length - written
+				if size > maxSendFileSize {
+					size = maxSendFileSize
+				}
+				n, e := syscall.Sendfile(int(out), int(in), &offset, int(size))
+				if n > 0 {
+					written += int64(n)
+				}
+				switch {
+				case e == syscall.EINTR:
+					continue
+				case e == syscall.EAGAIN:
+					// wait until connection writable
+					return false
+				case written == 0 && (e == syscall.EINVAL || e == syscall.ENOSYS || e == syscall.EOPNOTSUPP):
+					unsupported = true
+					return true
+				case e != nil:
+					werr = os.NewSyscallError("sendfile", e)
+					return true
+				case n == 0:
+					// file is shorter than length
+					werr = io.ErrUnexpectedEOF
+					return true
+				}
+			}
+			return true
+		})
+	})
+	if cerr != nil {
+		return written, true, cerr
+	}
+	if err != nil {
+		return written, true, err
+	}
+	if unsupported {
+		return 0, false, nil
+	}
+	return written, true, werr
+}
@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendFile_Unsupported(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+	conn, err := ln.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+	// proc files generated on read are rejected by sendfile with EINVAL, but can be read
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	n, handled, err := sendFile(conn.(*net.TCPConn), f, 0, 10)
+	if handled && err == nil {
+		t.Skip("sendfile supports proc files on this kernel")
+	}
+	assert.False(t, handled)
+	assert.Nil(t, err)
+	assert.Equal(t, n, int64(0))
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fileHandler will send file between frames when received "file"
+type fileHandler struct {
+	*echoHandler
+	file *os.File
+}
+
+func (f *fileHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	if string(frame) != "file" {
+		return f.echoHandler.OnReceived(frame, conn)
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return DisconnectionAction, err
+	}
+	conn.Send([]byte("head"), false)
+	conn.SendFile(f.file, 2, info.Size()-2)
+	return NothingAction, conn.Send([]byte("tail"), false)
+}
+
+// testTLSConfig will return server tls.Config of a self-signed certificate
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestNetServer_SendFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100*1024)
+	path := filepath.Join(t.TempDir(), "blob")
+	assert.Nil(t, os.WriteFile(path, content, 0600))
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	s := newTestServer(WithCodec(new(LengthFieldCodec)))
+	handler := &fileHandler{echoHandler: newEchoHandler(), file: f}
+	plain := NewAddress("tcp", "127.0.0.1:0")
+	secure := NewAddress("tcp", "127.0.0.1:0", WithTLS(testTLSConfig(t)))
+	assert.Nil(t, s.Bind(plain, handler))
+	assert.Nil(t, s.Bind(secure, handler))
+	listening, result := startServer(t, s, plain, secure)
+	codec := new(LengthFieldCodec)
+
+	check := func(t *testing.T, conn net.Conn) {
+		// files are sent concurrently by shared offset
+		for i := 0; i < 2; i++ {
+			conn.Write(codec.Encode([]byte("file")))
+		}
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, readFrame(t, conn), "head")
+			b := make([]byte, len(content)-2)
+			_, err := io.ReadFull(conn, b)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(b, content[2:]))
+			assert.Equal(t, readFrame(t, conn), "tail")
+		}
+	}
+
+	t.Run("test sendfile", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[plain])
+		assert.Nil(t, err)
+		defer conn.Close()
+		check(t, conn)
+		offset, err := f.Seek(0, io.SeekCurrent)
+		assert.Nil(t, err)
+		assert.Equal(t, offset, int64(0))
+	})
+
+	t.Run("test tls", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", listening[secure], &tls.Config{InsecureSkipVerify: true})
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.Write(codec.Encode([]byte("hello")))
+		assert.Equal(t, readFrame(t, conn), "hello")
+		check(t, conn)
+	})
+
+	waitFor(t, func() bool {
+		total := uint64(0)
+		for _, st := range s.Stats().Addresses {
+			total += st.BytesOut
+		}
+		return total >= uint64(4*(len(content)-2))
+	})
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Serializer will Marshal value to bytes and Unmarshal bytes to value
+// It is used by layers which carry Go values inside Codec frames
+type Serializer interface {
+	// Marshal will convert value to bytes
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal will parse bytes and store the result in the value pointed by v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONSerializer is Serializer implements by encoding/json
+type JSONSerializer struct {
+}
+
+func (j *JSONSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (j *JSONSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobSerializer is Serializer implements by encoding/gob
+// Every value is encoded with its own type information, so values can be decoded independently
+type GobSerializer struct {
+}
+
+func (g *GobSerializer) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *GobSerializer) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
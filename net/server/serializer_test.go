@@ -0,0 +1,28 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type serializerValue struct {
+	Name  string
+	Count int
+}
+
+func TestSerializer(t *testing.T) {
+	for name, s := range map[string]Serializer{
+		"json": new(JSONSerializer),
+		"gob":  new(GobSerializer),
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := s.Marshal(&serializerValue{Name: "hello", Count: 3})
+			assert.Nil(t, err)
+			var v serializerValue
+			assert.Nil(t, s.Unmarshal(b, &v))
+			assert.Equal(t, v, serializerValue{Name: "hello", Count: 3})
+			assert.NotNil(t, s.Unmarshal([]byte{0xff}, &v))
+		})
+	}
+}
@@ -2,6 +2,9 @@ package server
 
 import (
 	"errors"
+	"io"
+	"net/http"
+	"time"
 )
 
 // Action is control server or connection next action
@@ -13,22 +16,76 @@ const (
 	StopServerAction                  // this action will stop server
 )
 
-// ErrServerClosed will throw when server closed
-var ErrServerClosed = errors.New("server closed")
-
-type Address struct {
+func (a Action) String() string {
+	switch a {
+	case NothingAction:
+		return "nothing"
+	case DisconnectionAction:
+		return "disconnection"
+	case StopServerAction:
+		return "stop_server"
+	}
+	return "unknown"
 }
 
+var (
+	// ErrServerClosed will throw when server closed
+	ErrServerClosed = errors.New("server closed")
+	// ErrServerRunning will throw when Start a running server
+	ErrServerRunning = errors.New("server is running")
+	// ErrAddressBound will throw when Bind an address already bound
+	ErrAddressBound = errors.New("address already bound")
+)
+
 // Server is multi address handler server
 type Server interface {
 	// Bind is bind address and handler to server
+	// When server running, the address starts listening without affecting other addresses.
 	Bind(address *Address, handler Handler) error
 
 	// Stop will stop input addresses
+	// When server running, other addresses are not affected.
 	// When addresses empty, the server will stop all bind address
 	Stop(addresses ...*Address) error
 
 	// Start is start the server and blocking.
 	// When server all addresses stop, will throw ErrServerClosed
 	Start() error
+
+	// State will return the state of address, AddressStopped when address not bound
+	State(address *Address) AddressState
+
+	Monitor
+	Graceful
+}
+
+// Monitor is the statistics and inspection of a Server
+type Monitor interface {
+	// Stats will return statistics snapshot of all bound addresses
+	Stats() Stats
+	// Connections will return statistics snapshot of connections being served sorted by ID
+	Connections() []ConnectionStats
+	// Kill will disconnect the connection of id, queued data is flushed before closed
+	// It returns false when no such connection.
+	Kill(id uint64) bool
+	// WritePrometheus will write Stats to w in Prometheus text exposition format
+	WritePrometheus(w io.Writer) error
+	// PublishExpvar will publish Stats as expvar of name
+	// Like expvar.Publish, it panics when name is already published.
+	PublishExpvar(name string)
+	// AdminHandler will return a http.Handler serving Stats, metrics and connections
+	AdminHandler() http.Handler
+}
+
+// Graceful is the graceful restart of a Server
+type Graceful interface {
+	// Drain will stop accepting new connections and wait existing connections closed until timeout
+	Drain(timeout time.Duration) error
+	// Upgrade will start a new process of current executable inheriting all listeners, then drain with timeout
+	// It returns the pid of new process.
+	Upgrade(timeout time.Duration, args ...string) (int, error)
+	// HandOff will send all listeners to the process calling ReceiveListeners of path, then drain with timeout
+	HandOff(path string, timeout time.Duration) error
+	// ReceiveListeners will receive listeners sent by HandOff of path, they are used when Start
+	ReceiveListeners(path string) error
 }
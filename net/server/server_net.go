@@ -0,0 +1,463 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+)
+
+type listener struct {
+	address *Address
+	handler Handler
+	stats   *addressStats
+	ln      net.Listener
+	mu      sync.Mutex
+	conns   map[uint64]*netConnection
+	state   AddressState
+	wg      sync.WaitGroup
+}
+
+func newListener(address *Address, handler Handler) *listener {
+	return &listener{
+		address: address,
+		handler: handler,
+		stats:   newAddressStats(),
+		conns:   make(map[uint64]*netConnection),
+		state:   AddressBinding,
+	}
+}
+
+func (l *listener) getState() AddressState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// setState will change the state unless listener stopped, it returns the state before
+func (l *listener) setState(state AddressState) AddressState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.state
+	if old != AddressStopped {
+		l.state = state
+	}
+	return old
+}
+
+func (l *listener) isStopped() bool {
+	state := l.getState()
+	return state == AddressStopped || state == AddressDraining
+}
+
+// netServer is Server implements by net.Listener
+// Every connection is served by a read goroutine and a write goroutine.
+type netServer struct {
+	opts      Options
+	pool      *buffer.Pool
+	budget    *memoryBudget
+	mu        sync.Mutex
+	listeners map[*Address]*listener
+	running   bool
+	done      chan struct{}
+	// wg is waiting accept goroutines and connections of all listeners, including listeners bound while running
+	wg     sync.WaitGroup
+	connID uint64
+	// inherited is the listeners handed off by another process, keyed by Address String
+	inherited map[string]net.Listener
+	// scratch is the pool of *[]byte read scratch of connections, its length is BufferCapacity
+	scratch sync.Pool
+}
+
+// NewServer will create a Server listening by net package
+func NewServer(opts ...Option) Server {
+	options := Options{Codec: new(NothingCodec), BufferCapacity: buffer.DefaultBufferCapacity}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Logger == nil {
+		options.Logger = logger.NewLogger()
+	}
+	if options.Codec == nil {
+		options.Codec = new(NothingCodec)
+	}
+	if options.BufferCapacity <= 0 {
+		options.BufferCapacity = buffer.DefaultBufferCapacity
+	}
+	s := &netServer{
+		opts:      options,
+		pool:      buffer.NewPool(options.BufferCapacity),
+		budget:    newMemoryBudget(int64(options.MemoryBudget)),
+		listeners: make(map[*Address]*listener),
+		done:      make(chan struct{}),
+		inherited: make(map[string]net.Listener),
+	}
+	s.scratch.New = func() interface{} {
+		b := make([]byte, options.BufferCapacity)
+		return &b
+	}
+	return s
+}
+
+// Bind is bind address and handler to server
+// When server running, the address is listened before return, and other addresses are not affected.
+func (s *netServer) Bind(address *Address, handler Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.listeners[address]; ok {
+		return ErrAddressBound
+	}
+	l := newListener(address, handler)
+	if s.running {
+		ln, err := s.listen(address)
+		if err != nil {
+			return err
+		}
+		l.ln = ln
+		l.state = AddressListening
+		s.opts.Logger.InfoF("server listening on %s", address)
+		s.startAccept(l)
+	}
+	s.listeners[address] = l
+	return nil
+}
+
+// Stop will close listeners and connections of addresses
+// When server running, connections of stopped addresses are drained by AddressOptions DrainTimeout,
+// and stopping a draining address closes its connections immediately.
+// When addresses empty, the server will stop all bind address and close connections immediately.
+func (s *netServer) Stop(addresses ...*Address) error {
+	s.mu.Lock()
+	all := len(addresses) == 0
+	if all {
+		for address := range s.listeners {
+			addresses = append(addresses, address)
+		}
+	}
+	var stopped, draining []*listener
+	for _, address := range addresses {
+		l, ok := s.listeners[address]
+		if !ok {
+			continue
+		}
+		if s.running && !all && address.Options.DrainTimeout > 0 && l.getState() == AddressListening {
+			draining = append(draining, l)
+			continue
+		}
+		delete(s.listeners, address)
+		stopped = append(stopped, l)
+	}
+	s.closeIfEmpty()
+	s.mu.Unlock()
+	for _, l := range stopped {
+		l.stop()
+	}
+	for _, l := range draining {
+		s.drain(l)
+	}
+	return nil
+}
+
+// closeIfEmpty will stop the running server when no listener left, the caller must hold mu
+func (s *netServer) closeIfEmpty() {
+	if s.running && len(s.listeners) == 0 {
+		s.running = false
+		close(s.done)
+	}
+}
+
+// drain will close listener and serve its connections until closed or AddressOptions DrainTimeout
+func (s *netServer) drain(l *listener) {
+	if l.setState(AddressDraining) != AddressListening {
+		return
+	}
+	l.ln.Close()
+	s.opts.Logger.InfoF("server draining %s", l.address)
+	go func() {
+		drained := make(chan struct{})
+		go func() {
+			l.wg.Wait()
+			close(drained)
+		}()
+		timer := time.NewTimer(l.address.Options.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-drained:
+		case <-timer.C:
+			s.opts.Logger.WarnF("server drain %s timeout, close remaining connections", l.address)
+		}
+		s.mu.Lock()
+		if s.listeners[l.address] == l {
+			delete(s.listeners, l.address)
+			s.closeIfEmpty()
+		}
+		s.mu.Unlock()
+		l.stop()
+	}()
+}
+
+// State will return the state of address, AddressStopped when address not bound
+func (s *netServer) State(address *Address) AddressState {
+	s.mu.Lock()
+	l, ok := s.listeners[address]
+	s.mu.Unlock()
+	if !ok {
+		return AddressStopped
+	}
+	return l.getState()
+}
+
+// Start will listen all bound addresses and blocking until all addresses stopped
+// Addresses can be bound and stopped while it is blocking.
+func (s *netServer) Start() error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrServerRunning
+	}
+	if len(s.listeners) == 0 {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.loadInherited()
+	for address, l := range s.listeners {
+		ln, err := s.listen(address)
+		if err != nil {
+			for _, opened := range s.listeners {
+				if opened.ln != nil {
+					opened.ln.Close()
+					opened.ln = nil
+				}
+			}
+			s.mu.Unlock()
+			return err
+		}
+		l.ln = ln
+	}
+	s.closeInherited()
+	s.running = true
+	s.done = make(chan struct{})
+	done := s.done
+	for _, l := range s.listeners {
+		l.setState(AddressListening)
+		s.opts.Logger.InfoF("server listening on %s", l.address)
+		s.startAccept(l)
+	}
+	s.mu.Unlock()
+	if s.opts.Task != nil {
+		go s.runTask(done)
+	}
+	<-done
+	s.wg.Wait()
+	return ErrServerClosed
+}
+
+func (s *netServer) runTask(done <-chan struct{}) {
+	for {
+		next, action := s.opts.Task()
+		if action == StopServerAction {
+			s.Stop()
+			return
+		}
+		if next <= 0 {
+			return
+		}
+		timer := time.NewTimer(next)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// startAccept will accept connections of l in a goroutine, the caller must hold mu
+// The goroutine is counted by wait groups, so connections are added to them before Wait returns.
+func (s *netServer) startAccept(l *listener) {
+	l.wg.Add(1)
+	s.wg.Add(1)
+	go s.accept(l)
+}
+
+func (s *netServer) accept(l *listener) {
+	defer s.wg.Done()
+	defer l.wg.Done()
+	var delay time.Duration
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if l.isStopped() {
+				return
+			}
+			// retry with backoff, such as too many open files
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			s.opts.Logger.WarnF("server accept on %s failed: %v, retry in %v", l.address, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		atomic.AddUint64(&l.stats.accepted, 1)
+		l.wg.Add(1)
+		s.wg.Add(1)
+		go s.serve(l, conn)
+	}
+}
+
+func (l *listener) stop() {
+	l.mu.Lock()
+	l.state = AddressStopped
+	conns := make([]*netConnection, 0, len(l.conns))
+	for _, c := range l.conns {
+		conns = append(conns, c)
+	}
+	l.mu.Unlock()
+	if l.ln != nil {
+		l.ln.Close()
+	}
+	for _, c := range conns {
+		c.close(NewCloseReason(CloseServerStop, nil))
+	}
+}
+
+func (l *listener) add(c *netConnection) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == AddressStopped {
+		return false
+	}
+	l.conns[c.id] = c
+	return true
+}
+
+func (l *listener) remove(c *netConnection) {
+	l.mu.Lock()
+	delete(l.conns, c.id)
+	l.mu.Unlock()
+}
+
+func (s *netServer) serve(l *listener, conn net.Conn) {
+	defer s.wg.Done()
+	defer l.wg.Done()
+	if wrap := l.address.Options.WrapConn; wrap != nil {
+		conn = wrap(conn)
+	}
+	c := newNetConnection(s, l, conn)
+	defer c.free()
+	var rest []byte
+	if proxy := l.address.Options.ProxyProtocol; proxy != nil {
+		header, b, err := proxy.readHeader(conn)
+		if err != nil {
+			c.logger.WarnF("read proxy protocol header failed: %v", err)
+			atomic.AddUint64(&l.stats.rejected, 1)
+			conn.Close()
+			return
+		}
+		c.setProxyHeader(header)
+		rest = b
+	}
+	// connection is captured after the remote address resolved by PROXY protocol
+	s.opts.Capture.record(c, CaptureConnect, nil, false)
+	defer s.opts.Capture.record(c, CaptureDisconnect, nil, false)
+	if config := l.address.Options.TLS; config != nil {
+		// bytes read with PROXY protocol header are the beginning of TLS stream
+		if len(rest) > 0 {
+			conn = &rewindConn{Conn: conn, rest: rest}
+			rest = nil
+		}
+		c.conn = tls.Server(conn, config)
+	}
+	c.read(rest)
+	if admission := l.address.Options.Admission; admission != nil {
+		if err := admission.admit(c.addr); err != nil {
+			c.logger.DebugF("connection rejected: %v", err)
+			atomic.AddUint64(&l.stats.rejected, 1)
+			admission.reject(conn, err)
+			conn.Close()
+			return
+		}
+		defer admission.release(c.addr)
+	}
+	c.initBuffers()
+	_, _ = c.buf.Write(rest)
+	if sniffer := l.address.Options.Sniffer; sniffer != nil {
+		route, err := sniffer.sniff(c)
+		if err != nil {
+			c.logger.DebugF("sniff protocol failed: %v", err)
+			atomic.AddUint64(&l.stats.rejected, 1)
+			conn.Close()
+			return
+		}
+		c.setRoute(route)
+	}
+	if !l.add(c) {
+		conn.Close()
+		return
+	}
+	defer l.remove(c)
+	go c.writeLoop()
+	action, err := c.handler.OnConnected(c)
+	if !s.handle(c, action, err, CloseHandler) {
+		c.readLoop()
+	}
+	// the read loop is returned after connection closed, except the server is stopping
+	c.close(NewCloseReason(CloseServerStop, nil))
+	<-c.done
+	reason := c.closeReason()
+	l.stats.disconnect(reason.Code)
+	if err := c.handler.OnDisconnected(c, reason); err != nil {
+		c.Logger().WarnF("disconnected with error: %v", err)
+	}
+}
+
+// handle will execute action and handle err by Handler OnError
+// The connection is closed with code when DisconnectionAction executed.
+// It returns whether the connection should stop reading.
+func (s *netServer) handle(c *netConnection, action Action, err error, code CloseCode) bool {
+	if err != nil {
+		// the stronger action of handler returned and OnError returned is executed
+		if a := c.handler.OnError(c, err); a > action {
+			action = a
+		}
+	}
+	c.stats.action(action)
+	switch action {
+	case DisconnectionAction:
+		c.close(NewCloseReason(code, err))
+		return true
+	case StopServerAction:
+		go s.Stop()
+		return true
+	}
+	return false
+}
+
+// rewindConn is net.Conn reading rest bytes before reading Conn
+type rewindConn struct {
+	net.Conn
+	rest []byte
+}
+
+func (r *rewindConn) Read(b []byte) (int, error) {
+	if len(r.rest) > 0 {
+		n := copy(b, r.rest)
+		r.rest = r.rest[n:]
+		return n, nil
+	}
+	return r.Conn.Read(b)
+}
+
+func (r *rewindConn) CloseWrite() error {
+	if cw, ok := r.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return ErrCloseWriteNotSupported
+}
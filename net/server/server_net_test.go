@@ -0,0 +1,367 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/logger"
+)
+
+// echoHandler will echo frames and record connection events
+type echoHandler struct {
+	mu           sync.Mutex
+	remotes      []string
+	errs         []error
+	reasons      []*CloseReason
+	disconnected chan Connection
+}
+
+func newEchoHandler() *echoHandler {
+	return &echoHandler{disconnected: make(chan Connection, 10)}
+}
+
+func (e *echoHandler) OnConnected(conn Connection) (Action, error) {
+	e.mu.Lock()
+	e.remotes = append(e.remotes, conn.Remote())
+	e.mu.Unlock()
+	return NothingAction, nil
+}
+
+func (e *echoHandler) OnDisconnected(conn Connection, reason *CloseReason) error {
+	e.mu.Lock()
+	e.reasons = append(e.reasons, reason)
+	e.mu.Unlock()
+	e.disconnected <- conn
+	return nil
+}
+
+func (e *echoHandler) OnReceived(frame []byte, conn Connection) (Action, error) {
+	switch string(frame) {
+	case "quit":
+		conn.Send([]byte("bye"), false)
+		return DisconnectionAction, nil
+	case "stop":
+		return StopServerAction, nil
+	}
+	return NothingAction, conn.Send(frame, false)
+}
+
+func (e *echoHandler) OnError(conn Connection, err error) Action {
+	e.mu.Lock()
+	e.errs = append(e.errs, err)
+	e.mu.Unlock()
+	return NothingAction
+}
+
+func newTestServer(opts ...Option) *netServer {
+	return NewServer(append([]Option{WithLogger(logger.NewLogger(logger.WithWriter(io.Discard)))}, opts...)...).(*netServer)
+}
+
+// startServer will start s in background and return the listen addresses and Start result
+func startServer(t *testing.T, s *netServer, addresses ...*Address) (map[*Address]string, <-chan error) {
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Start()
+	}()
+	listening := make(map[*Address]string)
+	for i := 0; i < 100 && len(listening) < len(addresses); i++ {
+		time.Sleep(time.Millisecond * 5)
+		s.mu.Lock()
+		for _, address := range addresses {
+			if l, ok := s.listeners[address]; ok && l.ln != nil {
+				listening[address] = l.ln.Addr().String()
+			}
+		}
+		s.mu.Unlock()
+	}
+	assert.Len(t, listening, len(addresses))
+	return listening, result
+}
+
+func readFrame(t *testing.T, conn net.Conn) string {
+	header := make([]byte, LengthFieldSize)
+	_, err := io.ReadFull(conn, header)
+	assert.Nil(t, err)
+	b := make([]byte, int(header[3]))
+	_, err = io.ReadFull(conn, b)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func TestNewServer(t *testing.T) {
+	s := NewServer(WithLogger(logger.NewLogger(logger.WithWriter(io.Discard))), WithCodec(nil), WithBufferCapacity(16)).(*netServer)
+	assert.IsType(t, s.opts.Codec, new(NothingCodec))
+	assert.Equal(t, s.pool.Get().Capacity(), 16)
+	assert.ErrorIs(t, s.Start(), ErrServerClosed)
+}
+
+func TestNetServer_Bind(t *testing.T) {
+	s := newTestServer()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, newEchoHandler()))
+	assert.ErrorIs(t, s.Bind(address, newEchoHandler()), ErrAddressBound)
+	_, result := startServer(t, s, address)
+	assert.ErrorIs(t, s.Bind(address, newEchoHandler()), ErrAddressBound)
+	assert.NotNil(t, s.Bind(NewAddress("tcp", "256.0.0.1:0"), newEchoHandler()))
+	assert.ErrorIs(t, s.Start(), ErrServerRunning)
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+
+	s = newTestServer()
+	assert.Nil(t, s.Bind(NewAddress("tcp", "127.0.0.1:0"), newEchoHandler()))
+	assert.Nil(t, s.Bind(NewAddress("tcp", "256.0.0.1:0"), newEchoHandler()))
+	assert.NotNil(t, s.Start())
+}
+
+func TestNetServer_Serve(t *testing.T) {
+	s := newTestServer(WithCodec(new(LengthFieldCodec)), WithBufferCapacity(16))
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	codec := new(LengthFieldCodec)
+
+	t.Run("test echo", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		frame := codec.Encode([]byte("hello"))
+		// split frame to check decode of partial data
+		conn.Write(frame[:3])
+		time.Sleep(time.Millisecond * 10)
+		conn.Write(frame[3:])
+		assert.Equal(t, readFrame(t, conn), "hello")
+		conn.Write(append(codec.Encode([]byte("a")), codec.Encode([]byte("b"))...))
+		assert.Equal(t, readFrame(t, conn), "a")
+		assert.Equal(t, readFrame(t, conn), "b")
+		conn.Close()
+		c := <-handler.disconnected
+		assert.Equal(t, c.Remote(), conn.LocalAddr().String())
+		assert.Equal(t, c.Local(), conn.RemoteAddr().String())
+		assert.ErrorIs(t, c.Send([]byte("closed"), false), ErrConnectionClosed)
+	})
+	t.Run("test disconnection action", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.Write(codec.Encode([]byte("quit")))
+		assert.Equal(t, readFrame(t, conn), "bye")
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		<-handler.disconnected
+	})
+	t.Run("test frame too large", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.Write(codec.Encode(make([]byte, 16)))
+		_, err = conn.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+		<-handler.disconnected
+		handler.mu.Lock()
+		assert.ErrorIs(t, handler.errs[len(handler.errs)-1], ErrFrameTooLarge)
+		handler.mu.Unlock()
+	})
+	t.Run("test stop server action", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.Write(codec.Encode([]byte("stop")))
+		assert.ErrorIs(t, <-result, ErrServerClosed)
+		<-handler.disconnected
+	})
+}
+
+func TestNetServer_Stop(t *testing.T) {
+	s := newTestServer()
+	h1, h2 := newEchoHandler(), newEchoHandler()
+	a1, a2 := NewAddress("tcp", "127.0.0.1:0"), NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(a1, h1))
+	assert.Nil(t, s.Bind(a2, h2))
+	listening, result := startServer(t, s, a1, a2)
+	c1, err := net.Dial("tcp", listening[a1])
+	assert.Nil(t, err)
+	defer c1.Close()
+	c2, err := net.Dial("tcp", listening[a2])
+	assert.Nil(t, err)
+	defer c2.Close()
+	time.Sleep(time.Millisecond * 10)
+	assert.Nil(t, s.Stop(a1))
+	<-h1.disconnected
+	_, err = net.Dial("tcp", listening[a1])
+	assert.NotNil(t, err)
+	c2.Write([]byte("hello"))
+	b := make([]byte, 5)
+	_, err = io.ReadFull(c2, b)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Stop(a2))
+	<-h2.disconnected
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_StopWhileAccepting(t *testing.T) {
+	s := newTestServer()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	// every dialed connection may be disconnected by Stop
+	assert.Nil(t, s.Bind(address, &echoHandler{disconnected: make(chan Connection, 100)}))
+	listening, result := startServer(t, s, address)
+	dialed := make(chan struct{})
+	go func() {
+		defer close(dialed)
+		for i := 0; i < 100; i++ {
+			conn, err := net.Dial("tcp", listening[address])
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, s.Stop())
+	// Start returns after the accept goroutine exited, so no connection is served after it
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+	<-dialed
+}
+
+// waitState will wait address of s changed to state
+func waitState(t *testing.T, s *netServer, address *Address, state AddressState) {
+	for i := 0; i < 100 && s.State(address) != state; i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.Equal(t, s.State(address), state)
+}
+
+func TestNetServer_Dynamic(t *testing.T) {
+	s := newTestServer()
+	h1, h2, h3 := newEchoHandler(), newEchoHandler(), newEchoHandler()
+	a1 := NewAddress("tcp", "127.0.0.1:0", WithDrainTimeout(time.Minute))
+	a2 := NewAddress("tcp", "127.0.0.1:0")
+	a3 := NewAddress("tcp", "127.0.0.1:0", WithDrainTimeout(time.Millisecond*20))
+	assert.Nil(t, s.Bind(a1, h1))
+	assert.Equal(t, s.State(a1), AddressBinding)
+	assert.Equal(t, s.State(a2), AddressStopped)
+	listening, result := startServer(t, s, a1)
+	assert.Equal(t, s.State(a1), AddressListening)
+	echo := func(conn net.Conn) {
+		_, err := conn.Write([]byte("hello"))
+		assert.Nil(t, err)
+		b := make([]byte, 5)
+		_, err = io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), "hello")
+	}
+
+	t.Run("test bind while running", func(t *testing.T) {
+		assert.Nil(t, s.Bind(a2, h2))
+		assert.Equal(t, s.State(a2), AddressListening)
+		s.mu.Lock()
+		addr := s.listeners[a2].ln.Addr().String()
+		s.mu.Unlock()
+		conn, err := net.Dial("tcp", addr)
+		assert.Nil(t, err)
+		echo(conn)
+		conn.Close()
+		<-h2.disconnected
+	})
+
+	t.Run("test drain", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[a1])
+		assert.Nil(t, err)
+		defer conn.Close()
+		echo(conn)
+		assert.Nil(t, s.Stop(a1))
+		assert.Equal(t, s.State(a1), AddressDraining)
+		_, err = net.Dial("tcp", listening[a1])
+		assert.NotNil(t, err)
+		// connections already accepted are still served
+		echo(conn)
+		var states []string
+		for _, st := range s.Stats().Addresses {
+			states = append(states, st.State)
+		}
+		sort.Strings(states)
+		assert.Equal(t, states, []string{"draining", "listening"})
+		conn.Close()
+		<-h1.disconnected
+		waitState(t, s, a1, AddressStopped)
+		assert.Equal(t, h1.reasons[0].Code, ClosePeer)
+		assert.Equal(t, s.State(a2), AddressListening)
+	})
+
+	t.Run("test drain timeout", func(t *testing.T) {
+		assert.Nil(t, s.Bind(a3, h3))
+		s.mu.Lock()
+		addr := s.listeners[a3].ln.Addr().String()
+		s.mu.Unlock()
+		conn, err := net.Dial("tcp", addr)
+		assert.Nil(t, err)
+		defer conn.Close()
+		echo(conn)
+		assert.Nil(t, s.Stop(a3))
+		<-h3.disconnected
+		assert.Equal(t, h3.reasons[0].Code, CloseServerStop)
+		waitState(t, s, a3, AddressStopped)
+	})
+
+	assert.Nil(t, s.Stop(a2))
+	assert.Equal(t, s.State(a2), AddressStopped)
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_Task(t *testing.T) {
+	calls := 0
+	s := newTestServer(WithTask(func() (time.Duration, Action) {
+		calls++
+		if calls == 3 {
+			return 0, StopServerAction
+		}
+		return time.Millisecond, NothingAction
+	}))
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, newEchoHandler()))
+	assert.ErrorIs(t, s.Start(), ErrServerClosed)
+	assert.Equal(t, calls, 3)
+}
+
+func TestNetServer_ProxyProtocol(t *testing.T) {
+	s := newTestServer()
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0", WithProxyProtocol(&ProxyProtocol{Required: true}))
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	defer func() {
+		s.Stop()
+		<-result
+	}()
+
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write([]byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nhello"))
+	b := make([]byte, 5)
+	_, err = io.ReadFull(conn, b)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "hello")
+	conn.Close()
+	c := <-handler.disconnected
+	assert.Equal(t, c.Remote(), "192.168.0.1:56324")
+	header, ok := ProxyHeaderOf(c)
+	assert.True(t, ok)
+	assert.Equal(t, header.Version, 1)
+
+	conn, err = net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	_, err = conn.Read(b)
+	assert.NotNil(t, err)
+	handler.mu.Lock()
+	assert.Len(t, handler.remotes, 1)
+	handler.mu.Unlock()
+}
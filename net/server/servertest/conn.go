@@ -0,0 +1,491 @@
+package servertest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Conn is an in-memory server.Connection driven by Harness
+// It records sent frames, executed Action and errors reported to Handler OnError.
+type Conn struct {
+	h      *Harness
+	id     uint64
+	remote string
+	local  string
+	logger logger.Logger
+	codec  server.Codec
+	// readMu serializes Handler calls of reading like the server read loop
+	readMu sync.Mutex
+	buf    buffer.Buffer
+
+	mu           sync.Mutex
+	frames       [][]byte
+	raw          []byte
+	actions      []server.Action
+	errs         []error
+	disconnected bool
+	reason       *server.CloseReason
+	identity     string
+	writeClosed  bool
+	readDeadline time.Time
+	paused       bool
+	// pending is bytes injected but not buffered, they are kept while reading paused
+	pending []byte
+	// inRead is set while bytes are processed under readMu
+	inRead bool
+	// stream is the streamed frame being received, it is only accessed under readMu
+	stream     *stream
+	lastActive time.Time
+	pipe       chan []byte
+}
+
+func newConn(h *Harness, id uint64) *Conn {
+	c := &Conn{
+		h:          h,
+		id:         id,
+		remote:     fmt.Sprintf("servertest-client-%d", id),
+		local:      "servertest-server",
+		buf:        buffer.NewBuffer(h.opts.BufferCapacity),
+		lastActive: h.now,
+	}
+	c.logger = h.opts.Logger.WithField("conn_id", id).WithField("remote", c.remote)
+	c.codec = h.opts.Codec
+	if cc, ok := c.codec.(server.ConnCodec); ok {
+		c.codec = cc.NewConnCodec(c)
+	}
+	return c
+}
+
+func (c *Conn) Send(data []byte, withoutEncode bool) error {
+	raw := data
+	if !withoutEncode {
+		raw = c.codec.Encode(data)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writable(); err != nil {
+		return err
+	}
+	c.frames = append(c.frames, append([]byte{}, data...))
+	c.write(raw)
+	return nil
+}
+
+// SendWait is Send, the data is written before it returns
+func (c *Conn) SendWait(data []byte, withoutEncode bool) error {
+	return c.Send(data, withoutEncode)
+}
+
+// SendFile will send the file section as raw bytes, it is not recorded by Frames
+func (c *Conn) SendFile(f *os.File, offset, length int64) error {
+	raw := make([]byte, length)
+	if _, err := f.ReadAt(raw, offset); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writable(); err != nil {
+		return err
+	}
+	c.write(raw)
+	return nil
+}
+
+// SendStream will send the stream frame as raw bytes, it is not recorded by Frames
+func (c *Conn) SendStream(header []byte, length int64, body io.Reader) error {
+	codec, ok := c.codec.(server.StreamCodec)
+	if !ok {
+		return server.ErrStreamNotSupported
+	}
+	data, err := codec.EncodeStream(header, length)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(io.LimitReader(body, length))
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) < length {
+		c.disconnect(server.NewCloseReason(server.CloseIOError, io.ErrUnexpectedEOF))
+		return io.ErrUnexpectedEOF
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writable(); err != nil {
+		return err
+	}
+	c.write(append(data, b...))
+	return nil
+}
+
+// writable will return error of sending to Conn, the caller must hold mu
+func (c *Conn) writable() error {
+	if c.disconnected {
+		return server.ErrConnectionClosed
+	}
+	if c.writeClosed {
+		return server.ErrWriteClosed
+	}
+	return nil
+}
+
+// write will record raw bytes sent to client, the caller must hold mu
+func (c *Conn) write(raw []byte) {
+	c.raw = append(c.raw, raw...)
+	if c.pipe != nil {
+		c.pipe <- append([]byte{}, raw...)
+	}
+}
+
+func (c *Conn) Remote() string {
+	return c.remote
+}
+
+func (c *Conn) Local() string {
+	return c.local
+}
+
+func (c *Conn) Logger() logger.Logger {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logger
+}
+
+func (c *Conn) SetIdentity(identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.identity = identity
+	c.logger = c.logger.WithField("identity", identity)
+}
+
+func (c *Conn) BufferCapacity() int {
+	return c.buf.Capacity()
+}
+
+func (c *Conn) Identity() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.identity
+}
+
+// Close will disconnect Conn as Handler closed connection
+func (c *Conn) Close() error {
+	c.disconnect(server.NewCloseReason(server.CloseHandler, nil))
+	return nil
+}
+
+// Hangup will disconnect Conn as client closed connection
+func (c *Conn) Hangup() {
+	c.disconnect(server.NewCloseReason(server.ClosePeer, nil))
+}
+
+// CloseWrite will mark Conn write closed, the later Send returns server.ErrWriteClosed
+func (c *Conn) CloseWrite() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.disconnected {
+		return server.ErrConnectionClosed
+	}
+	c.writeClosed = true
+	return nil
+}
+
+// SetReadDeadline will set read deadline checked against the fake clock by Harness Advance
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// PauseRead will keep the injected bytes pending until ResumeRead
+func (c *Conn) PauseRead() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+}
+
+// ResumeRead will receive the pending bytes
+// They are received before return unless ResumeRead called by Handler receiving frames,
+// in which case they are received after the Handler callback returns.
+func (c *Conn) ResumeRead() {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return
+	}
+	c.paused = false
+	inRead := c.inRead
+	c.mu.Unlock()
+	if inRead {
+		return
+	}
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.process()
+}
+
+func (c *Conn) Closed() bool {
+	return c.Disconnected()
+}
+
+// ID will return the id of Conn in Harness
+func (c *Conn) ID() uint64 {
+	return c.id
+}
+
+// Write will inject bytes as received from client
+// Decoded frames are received by Handler before return, or kept pending while reading paused.
+// It returns server.ErrConnectionClosed when Conn disconnected.
+func (c *Conn) Write(data []byte) error {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if c.Disconnected() {
+		return server.ErrConnectionClosed
+	}
+	now := c.h.Now()
+	c.mu.Lock()
+	c.lastActive = now
+	c.pending = append(c.pending, data...)
+	c.mu.Unlock()
+	c.process()
+	return nil
+}
+
+// process will decode pending bytes and call Handler until reading paused, the caller must hold readMu
+func (c *Conn) process() {
+	c.mu.Lock()
+	c.inRead = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inRead = false
+		c.mu.Unlock()
+	}()
+	for {
+		c.mu.Lock()
+		if c.paused || c.disconnected {
+			// inRead is cleared with the check, so ResumeRead after it processes by itself
+			c.inRead = false
+			c.mu.Unlock()
+			return
+		}
+		n, _ := c.buf.Write(c.pending)
+		c.pending = c.pending[n:]
+		c.mu.Unlock()
+		if streamed, stop := c.receiveStream(); stop {
+			return
+		} else if streamed {
+			continue
+		}
+		var frame []byte
+		var err error
+		if c.stream == nil && c.buf.Size() > 0 {
+			frame, err = c.decode()
+		}
+		if err != nil {
+			c.handle(server.DisconnectionAction, err, server.CloseCodecError)
+			return
+		}
+		if frame == nil {
+			if c.stream == nil && c.buf.Size() == c.buf.Capacity() {
+				c.handle(server.DisconnectionAction, server.ErrFrameTooLarge, server.CloseCodecError)
+				return
+			}
+			c.mu.Lock()
+			if len(c.pending) == 0 {
+				c.inRead = false
+				c.mu.Unlock()
+				return
+			}
+			c.mu.Unlock()
+			continue
+		}
+		action, err := c.h.handler.OnReceived(frame, c)
+		if c.handle(action, err, server.CloseHandler) {
+			return
+		}
+	}
+}
+
+// stream is a streamed frame whose body is being collected
+type stream struct {
+	header []byte
+	body   []byte
+	remain int64
+}
+
+// receiveStream will collect the body of streamed frame and call Handler OnStream when it completed
+// The whole body is buffered in memory unlike the server, which is fine for tests.
+// It returns whether a frame streamed and whether Conn should stop reading.
+func (c *Conn) receiveStream() (bool, bool) {
+	if c.stream == nil {
+		codec, ok := c.codec.(server.StreamCodec)
+		if !ok {
+			return false, false
+		}
+		if _, ok := c.h.handler.(server.StreamHandler); !ok {
+			return false, false
+		}
+		header, length, ok := codec.DecodeStream(c.buf)
+		if !ok {
+			return false, false
+		}
+		c.stream = &stream{header: header, remain: length}
+	}
+	n := c.buf.Size()
+	if int64(n) > c.stream.remain {
+		n = int(c.stream.remain)
+	}
+	_, b := c.buf.ReadN(n)
+	c.stream.body = append(c.stream.body, b...)
+	c.stream.remain -= int64(n)
+	if c.stream.remain > 0 {
+		return false, false
+	}
+	s := c.stream
+	c.stream = nil
+	action, err := c.h.handler.(server.StreamHandler).OnStream(s.header, bytes.NewReader(s.body), c)
+	return true, c.handle(action, err, server.CloseHandler)
+}
+
+// decode will decode a frame by Codec, using DecodeError when Codec is a server.ErrorCodec
+func (c *Conn) decode() ([]byte, error) {
+	if ec, ok := c.codec.(server.ErrorCodec); ok {
+		return ec.DecodeError(c.buf)
+	}
+	return c.codec.Decode(c.buf), nil
+}
+
+// WriteChunks will inject data split by sizes
+// The sizes are used in cycle, so WriteChunks(data, 1) writes data byte by byte.
+func (c *Conn) WriteChunks(data []byte, sizes ...int) error {
+	if len(sizes) == 0 {
+		return c.Write(data)
+	}
+	for i := 0; len(data) > 0; i++ {
+		n := sizes[i%len(sizes)]
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		if err := c.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Frames will return frames sent by Handler before encoded
+func (c *Conn) Frames() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte{}, c.frames...)
+}
+
+// Bytes will return all bytes sent to client after encoded
+func (c *Conn) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte{}, c.raw...)
+}
+
+// Actions will return Action returned by Handler callbacks, include OnError
+func (c *Conn) Actions() []server.Action {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]server.Action{}, c.actions...)
+}
+
+// Errors will return errors reported to Handler OnError
+func (c *Conn) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error{}, c.errs...)
+}
+
+// Reason will return the reason of Conn disconnected, nil when connected
+func (c *Conn) Reason() *server.CloseReason {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+// Disconnected will return whether Conn disconnected
+func (c *Conn) Disconnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.disconnected
+}
+
+// readDeadlineExceeded will return whether read deadline exceeded at now, the deadline is cleared when exceeded
+func (c *Conn) readDeadlineExceeded(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readDeadline.IsZero() || now.Before(c.readDeadline) {
+		return false
+	}
+	c.readDeadline = time.Time{}
+	return true
+}
+
+func (c *Conn) idleSince(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Sub(c.lastActive)
+}
+
+// handle will record and execute action like the server does
+// Conn is disconnected with code when DisconnectionAction executed.
+// It returns whether Conn should stop reading.
+func (c *Conn) handle(action server.Action, err error, code server.CloseCode) bool {
+	c.mu.Lock()
+	c.actions = append(c.actions, action)
+	c.mu.Unlock()
+	if err != nil {
+		a := c.h.handler.OnError(c, err)
+		c.mu.Lock()
+		c.errs = append(c.errs, err)
+		c.actions = append(c.actions, a)
+		c.mu.Unlock()
+		if a > action {
+			action = a
+		}
+	}
+	switch action {
+	case server.DisconnectionAction:
+		c.disconnect(server.NewCloseReason(code, err))
+		return true
+	case server.StopServerAction:
+		c.h.stop()
+		return true
+	}
+	return false
+}
+
+func (c *Conn) disconnect(reason *server.CloseReason) {
+	c.mu.Lock()
+	if c.disconnected {
+		c.mu.Unlock()
+		return
+	}
+	c.disconnected = true
+	c.reason = reason
+	c.logger = reason.Logger(c.logger)
+	if c.pipe != nil {
+		close(c.pipe)
+	}
+	c.mu.Unlock()
+	c.h.remove(c)
+	if err := c.h.handler.OnDisconnected(c, reason); err != nil {
+		c.Logger().WarnF("disconnected with error: %v", err)
+	}
+}
@@ -0,0 +1,5 @@
+// Package servertest is an in-memory harness to test server Handler and Codec without sockets.
+// A Harness drives a Handler like the server does: bytes written to a Conn in any chunking
+// are decoded by the Codec and received by the Handler, returned Action are executed and recorded.
+// Time only moves by Harness Advance, so Task scheduling and idle timeout are deterministic.
+package servertest
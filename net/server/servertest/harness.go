@@ -0,0 +1,181 @@
+package servertest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// ErrIdleTimeout is reported to Handler OnError when Conn disconnected by Options IdleTimeout
+var ErrIdleTimeout = errors.New("connection idle timeout")
+
+// Harness drives a Handler with in-memory connections and a fake clock
+type Harness struct {
+	opts    Options
+	handler server.Handler
+
+	mu       sync.Mutex
+	now      time.Time
+	conns    []*Conn
+	nextTask time.Time
+	stopped  bool
+	nextID   uint64
+}
+
+// New will create Harness of handler
+// The Options Task is called immediately like server Start.
+func New(handler server.Handler, opts ...Option) *Harness {
+	options := newOptions(opts...)
+	if options.Logger == nil {
+		options.Logger = logger.NewLogger(logger.WithWriter(io.Discard))
+	}
+	h := &Harness{
+		opts:    options,
+		handler: handler,
+		now:     options.Start,
+	}
+	if options.Task != nil {
+		h.nextTask = h.now
+		h.runTasks()
+	}
+	return h
+}
+
+// Now will return the fake clock time
+func (h *Harness) Now() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.now
+}
+
+// Advance will move the fake clock forward
+// Task due in the period are called, read deadline exceeded are reported and idle connections are disconnected.
+func (h *Harness) Advance(d time.Duration) {
+	h.mu.Lock()
+	h.now = h.now.Add(d)
+	conns := append([]*Conn{}, h.conns...)
+	h.mu.Unlock()
+	h.runTasks()
+	now := h.Now()
+	for _, c := range conns {
+		if c.readDeadlineExceeded(now) && c.handle(server.NothingAction, server.ErrReadDeadline, server.CloseTimeout) {
+			continue
+		}
+		if h.opts.IdleTimeout > 0 && c.idleSince(now) >= h.opts.IdleTimeout {
+			c.handle(server.DisconnectionAction, ErrIdleTimeout, server.CloseTimeout)
+		}
+	}
+}
+
+func (h *Harness) runTasks() {
+	for {
+		h.mu.Lock()
+		if h.nextTask.IsZero() || h.nextTask.After(h.now) || h.stopped {
+			h.mu.Unlock()
+			return
+		}
+		at := h.nextTask
+		h.mu.Unlock()
+		next, action := h.opts.Task()
+		h.mu.Lock()
+		if next > 0 {
+			h.nextTask = at.Add(next)
+		} else {
+			h.nextTask = time.Time{}
+		}
+		h.mu.Unlock()
+		if action == server.StopServerAction {
+			h.stop()
+		}
+	}
+}
+
+// Stopped will return whether a StopServerAction executed
+func (h *Harness) Stopped() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stopped
+}
+
+// stop will disconnect all connections like server Stop
+func (h *Harness) stop() {
+	h.mu.Lock()
+	h.stopped = true
+	conns := append([]*Conn{}, h.conns...)
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.disconnect(server.NewCloseReason(server.CloseServerStop, nil))
+	}
+}
+
+// Connect will create a Conn and call Handler OnConnected
+func (h *Harness) Connect() *Conn {
+	h.mu.Lock()
+	h.nextID++
+	c := newConn(h, h.nextID)
+	h.conns = append(h.conns, c)
+	h.mu.Unlock()
+	action, err := h.handler.OnConnected(c)
+	c.handle(action, err, server.CloseHandler)
+	return c
+}
+
+// Pipe will create a Conn served over net.Pipe and return the client side of pipe
+// Bytes written to client are received by Handler, and sent frames can be read from client.
+// The client will be closed when Conn disconnected.
+func (h *Harness) Pipe() (net.Conn, *Conn) {
+	client, peer := net.Pipe()
+	h.mu.Lock()
+	h.nextID++
+	c := newConn(h, h.nextID)
+	c.pipe = make(chan []byte, 1024)
+	h.conns = append(h.conns, c)
+	h.mu.Unlock()
+	go func() {
+		defer peer.Close()
+		for b := range c.pipe {
+			if _, err := peer.Write(b); err != nil {
+				return
+			}
+		}
+	}()
+	action, err := h.handler.OnConnected(c)
+	c.handle(action, err, server.CloseHandler)
+	go func() {
+		b := make([]byte, h.opts.BufferCapacity)
+		for {
+			n, err := peer.Read(b)
+			if err != nil {
+				c.Hangup()
+				return
+			}
+			if c.Write(b[:n]) != nil {
+				return
+			}
+		}
+	}()
+	return client, c
+}
+
+// Conns will return all created Conn
+func (h *Harness) Conns() []*Conn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Conn{}, h.conns...)
+}
+
+func (h *Harness) remove(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, conn := range h.conns {
+		if conn == c {
+			h.conns = append(h.conns[:i], h.conns[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package servertest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+type echoHandler struct {
+	// mu guards counters updated by Conn of Pipe concurrently
+	mu           sync.Mutex
+	connected    int
+	disconnected int
+}
+
+func (e *echoHandler) OnConnected(conn server.Connection) (server.Action, error) {
+	e.mu.Lock()
+	e.connected++
+	e.mu.Unlock()
+	return server.NothingAction, nil
+}
+
+func (e *echoHandler) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	e.mu.Lock()
+	e.disconnected++
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *echoHandler) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	switch string(frame) {
+	case "quit":
+		return server.DisconnectionAction, nil
+	case "stop":
+		return server.StopServerAction, nil
+	case "fail":
+		return server.NothingAction, errors.New("fail")
+	case "pause":
+		conn.PauseRead()
+		return server.NothingAction, nil
+	}
+	return server.NothingAction, conn.Send(frame, false)
+}
+
+func (e *echoHandler) OnError(conn server.Connection, err error) server.Action {
+	return server.NothingAction
+}
+
+func TestHarness_Connect(t *testing.T) {
+	handler := new(echoHandler)
+	codec := new(server.LengthFieldCodec)
+	h := New(handler, WithCodec(codec))
+	conn := h.Connect()
+	assert.Equal(t, handler.connected, 1)
+	assert.Equal(t, conn.Remote(), "servertest-client-1")
+	assert.Equal(t, conn.Local(), "servertest-server")
+	assert.Equal(t, conn.ID(), uint64(1))
+	assert.NotNil(t, conn.Logger())
+
+	data := append(codec.Encode([]byte("hello")), codec.Encode([]byte("world"))...)
+	assert.Nil(t, conn.WriteChunks(data, 1, 3))
+	assert.Equal(t, conn.Frames(), [][]byte{[]byte("hello"), []byte("world")})
+	assert.Equal(t, conn.Bytes(), data)
+	assert.Equal(t, conn.Actions(), []server.Action{server.NothingAction, server.NothingAction, server.NothingAction})
+
+	assert.Nil(t, conn.Write(codec.Encode([]byte("fail"))))
+	assert.EqualError(t, conn.Errors()[0], "fail")
+
+	assert.Nil(t, conn.Write(codec.Encode([]byte("quit"))))
+	assert.True(t, conn.Disconnected())
+	assert.Equal(t, handler.disconnected, 1)
+	assert.ErrorIs(t, conn.Write([]byte("x")), server.ErrConnectionClosed)
+	assert.ErrorIs(t, conn.Send([]byte("x"), false), server.ErrConnectionClosed)
+	assert.Empty(t, h.Conns())
+}
+
+func TestHarness_FrameTooLarge(t *testing.T) {
+	codec := new(server.LengthFieldCodec)
+	h := New(new(echoHandler), WithCodec(codec), WithBufferCapacity(8))
+	conn := h.Connect()
+	assert.Nil(t, conn.Write(codec.Encode([]byte("too large"))))
+	assert.True(t, conn.Disconnected())
+	assert.ErrorIs(t, conn.Errors()[0], server.ErrFrameTooLarge)
+	assert.Equal(t, conn.Reason().Code, server.CloseCodecError)
+}
+
+func TestHarness_Stop(t *testing.T) {
+	handler := new(echoHandler)
+	h := New(handler)
+	c1, c2 := h.Connect(), h.Connect()
+	c1.Write([]byte("stop"))
+	assert.True(t, h.Stopped())
+	assert.True(t, c1.Disconnected())
+	assert.True(t, c2.Disconnected())
+	assert.Equal(t, c2.Reason().Code, server.CloseServerStop)
+	assert.Equal(t, handler.disconnected, 2)
+}
+
+func TestHarness_Advance(t *testing.T) {
+	var times []time.Time
+	var h *Harness
+	h = New(new(echoHandler), WithIdleTimeout(time.Minute), WithTask(func() (time.Duration, server.Action) {
+		if h != nil {
+			times = append(times, h.Now())
+		}
+		if len(times) == 3 {
+			return 0, server.NothingAction
+		}
+		return time.Second * 10, server.NothingAction
+	}))
+	start := h.Now()
+	conn := h.Connect()
+	h.Advance(time.Second * 25)
+	assert.Equal(t, times, []time.Time{start.Add(time.Second * 25), start.Add(time.Second * 25)})
+	h.Advance(time.Second * 30)
+	assert.Len(t, times, 3)
+	assert.False(t, conn.Disconnected())
+	conn.Write([]byte("ping"))
+	h.Advance(time.Second * 59)
+	assert.False(t, conn.Disconnected())
+	h.Advance(time.Second)
+	assert.True(t, conn.Disconnected())
+	assert.ErrorIs(t, conn.Errors()[0], ErrIdleTimeout)
+	assert.Equal(t, conn.Reason(), server.NewCloseReason(server.CloseTimeout, ErrIdleTimeout))
+}
+
+func TestHarness_Pipe(t *testing.T) {
+	handler := new(echoHandler)
+	codec := new(server.LengthFieldCodec)
+	h := New(handler, WithCodec(codec))
+	client, conn := h.Pipe()
+	defer client.Close()
+	_, err := client.Write(codec.Encode([]byte("hello")))
+	assert.Nil(t, err)
+	b := make([]byte, server.LengthFieldSize+5)
+	_, err = io.ReadFull(client, b)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b[server.LengthFieldSize:]), "hello")
+	_, err = client.Write(codec.Encode([]byte("quit")))
+	assert.Nil(t, err)
+	_, err = client.Read(b)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.True(t, conn.Disconnected())
+
+	client, conn = h.Pipe()
+	client.Close()
+	for i := 0; i < 100 && !conn.Disconnected(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, conn.Disconnected())
+}
+
+func TestConn_SendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(path, []byte("0123456789"), 0600))
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	conn := New(new(echoHandler)).Connect()
+	assert.Nil(t, conn.Send([]byte("a"), false))
+	assert.Nil(t, conn.SendFile(f, 2, 3))
+	assert.NotNil(t, conn.SendFile(f, 8, 3))
+	assert.Equal(t, conn.Bytes(), []byte("a234"))
+	assert.Equal(t, conn.Frames(), [][]byte{[]byte("a")})
+	conn.Close()
+	assert.ErrorIs(t, conn.SendFile(f, 0, 1), server.ErrConnectionClosed)
+}
+
+func TestConn_Control(t *testing.T) {
+	handler := new(echoHandler)
+	codec := new(server.LengthFieldCodec)
+	h := New(handler, WithCodec(codec))
+
+	t.Run("test pause read", func(t *testing.T) {
+		conn := h.Connect()
+		data := append(codec.Encode([]byte("pause")), codec.Encode([]byte("hello"))...)
+		assert.Nil(t, conn.Write(data))
+		assert.Nil(t, conn.Write(codec.Encode([]byte("world"))))
+		assert.Empty(t, conn.Frames())
+		conn.ResumeRead()
+		assert.Equal(t, conn.Frames(), [][]byte{[]byte("hello"), []byte("world")})
+		conn.ResumeRead()
+		assert.Nil(t, conn.Close())
+		assert.True(t, conn.Closed())
+		assert.Equal(t, conn.Reason().Initiator, server.InitiatorHandler)
+	})
+
+	t.Run("test close write", func(t *testing.T) {
+		conn := h.Connect()
+		assert.Nil(t, conn.CloseWrite())
+		assert.ErrorIs(t, conn.Send([]byte("x"), false), server.ErrWriteClosed)
+		assert.False(t, conn.Closed())
+		conn.Close()
+		assert.ErrorIs(t, conn.CloseWrite(), server.ErrConnectionClosed)
+	})
+
+	t.Run("test read deadline", func(t *testing.T) {
+		conn := h.Connect()
+		assert.Nil(t, conn.SetReadDeadline(h.Now().Add(time.Second)))
+		h.Advance(time.Millisecond * 999)
+		assert.Empty(t, conn.Errors())
+		h.Advance(time.Millisecond)
+		assert.Equal(t, conn.Errors(), []error{server.ErrReadDeadline})
+		// the deadline is cleared after reported
+		h.Advance(time.Second)
+		assert.Len(t, conn.Errors(), 1)
+		assert.False(t, conn.Closed())
+	})
+}
+
+type streamHandler struct {
+	echoHandler
+	bodies []string
+}
+
+func (s *streamHandler) OnStream(header []byte, body io.Reader, conn server.Connection) (server.Action, error) {
+	b, err := io.ReadAll(body)
+	s.bodies = append(s.bodies, string(b))
+	return server.NothingAction, err
+}
+
+func TestConn_Stream(t *testing.T) {
+	handler := new(streamHandler)
+	codec := &server.LengthFieldCodec{StreamThreshold: 8}
+	h := New(handler, WithCodec(codec), WithBufferCapacity(8))
+	conn := h.Connect()
+	data := append(codec.Encode([]byte("large body")), codec.Encode([]byte("hi"))...)
+	assert.Nil(t, conn.WriteChunks(data, 3))
+	assert.Equal(t, handler.bodies, []string{"large body"})
+	assert.Equal(t, conn.Frames(), [][]byte{[]byte("hi")})
+
+	assert.Nil(t, conn.SendStream([]byte("ab"), 3, strings.NewReader("cdefg")))
+	assert.Equal(t, conn.Bytes()[len(conn.Bytes())-9:], []byte("\x00\x00\x00\x05abcde"))
+	assert.ErrorIs(t, conn.SendStream(nil, 3, strings.NewReader("x")), io.ErrUnexpectedEOF)
+	assert.Equal(t, conn.Reason().Code, server.CloseIOError)
+	assert.ErrorIs(t, New(handler).Connect().SendStream(nil, 1, strings.NewReader("x")), server.ErrStreamNotSupported)
+}
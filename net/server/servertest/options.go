@@ -0,0 +1,84 @@
+package servertest
+
+import (
+	"time"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/logger"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Options defined Harness options
+type Options struct {
+	// Codec is used to decode written bytes and encode sent frames, default server.NothingCodec
+	Codec server.Codec
+	// BufferCapacity is the read buffer capacity of each Conn
+	BufferCapacity int
+	// IdleTimeout will disconnect Conn without written bytes for this duration, zero means disable
+	IdleTimeout time.Duration
+	// Task is called when Harness created, and then by the returned duration of fake clock
+	Task server.Task
+	// Logger is the Logger of Conn, default discard all logs
+	Logger logger.Logger
+	// Start is the start time of fake clock
+	Start time.Time
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		BufferCapacity: buffer.DefaultBufferCapacity,
+		Start:          time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Codec == nil {
+		options.Codec = new(server.NothingCodec)
+	}
+	return options
+}
+
+// WithCodec is edit Options Codec field
+func WithCodec(codec server.Codec) Option {
+	return func(options *Options) {
+		options.Codec = codec
+	}
+}
+
+// WithBufferCapacity is edit Options BufferCapacity field
+func WithBufferCapacity(capacity int) Option {
+	return func(options *Options) {
+		options.BufferCapacity = capacity
+	}
+}
+
+// WithIdleTimeout is edit Options IdleTimeout field
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.IdleTimeout = timeout
+	}
+}
+
+// WithTask is edit Options Task field
+func WithTask(task server.Task) Option {
+	return func(options *Options) {
+		options.Task = task
+	}
+}
+
+// WithLogger is edit Options Logger field
+func WithLogger(logger logger.Logger) Option {
+	return func(options *Options) {
+		options.Logger = logger
+	}
+}
+
+// WithStart is edit Options Start field
+func WithStart(start time.Time) Option {
+	return func(options *Options) {
+		options.Start = start
+	}
+}
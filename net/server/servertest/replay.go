@@ -0,0 +1,53 @@
+package servertest
+
+import (
+	"os"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// Replay will feed connections captured by server.Capture to Harness
+// Each captured connection is connected to Harness, its received bytes are written to Conn in the captured chunks,
+// and the fake clock advances by the captured time between records.
+// It returns Conn keyed by captured connection ID, so sent frames can be compared with captured ones.
+func Replay(h *Harness, records []server.CaptureRecord) map[uint64]*Conn {
+	conns := make(map[uint64]*Conn)
+	for i, record := range records {
+		if i > 0 {
+			if d := record.Time.Sub(records[i-1].Time); d > 0 {
+				h.Advance(d)
+			}
+		}
+		switch record.Kind {
+		case server.CaptureConnect:
+			conns[record.ConnID] = h.Connect()
+		case server.CaptureRead:
+			// capture may be switched on in the middle of a connection
+			c, ok := conns[record.ConnID]
+			if !ok {
+				c = h.Connect()
+				conns[record.ConnID] = c
+			}
+			_ = c.Write(record.Data)
+		case server.CaptureDisconnect:
+			if c, ok := conns[record.ConnID]; ok {
+				c.Hangup()
+			}
+		}
+	}
+	return conns
+}
+
+// ReplayFile will Replay the capture file of path
+func ReplayFile(h *Harness, path string) (map[uint64]*Conn, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := server.ReadCapture(f)
+	if err != nil {
+		return nil, err
+	}
+	return Replay(h, records), nil
+}
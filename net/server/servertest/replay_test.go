@@ -0,0 +1,52 @@
+package servertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+func TestReplay(t *testing.T) {
+	codec := new(server.LengthFieldCodec)
+	frame := codec.Encode([]byte("hello"))
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []server.CaptureRecord{
+		{Time: start, ConnID: 5, Kind: server.CaptureConnect},
+		{Time: start, ConnID: 5, Kind: server.CaptureRead, Data: frame[:3]},
+		{Time: start.Add(time.Second), ConnID: 5, Kind: server.CaptureRead, Data: frame[3:]},
+		{Time: start.Add(time.Second), ConnID: 5, Kind: server.CaptureSend, Data: []byte("hello")},
+		// capture switched on in the middle of connection 6
+		{Time: start.Add(time.Second), ConnID: 6, Kind: server.CaptureRead, Data: codec.Encode([]byte("quit"))},
+		{Time: start.Add(time.Minute), ConnID: 5, Kind: server.CaptureDisconnect},
+	}
+	handler := new(echoHandler)
+	h := New(handler, WithCodec(codec), WithStart(start))
+	conns := Replay(h, records)
+	assert.Len(t, conns, 2)
+	assert.Equal(t, conns[5].Frames(), [][]byte{[]byte("hello")})
+	assert.True(t, conns[5].Disconnected())
+	assert.Equal(t, conns[5].Reason().Code, server.ClosePeer)
+	assert.True(t, conns[6].Disconnected())
+	assert.Equal(t, h.Now(), start.Add(time.Minute))
+	assert.Equal(t, handler.connected, 2)
+
+	path := filepath.Join(t.TempDir(), "capture")
+	out := new(bytes.Buffer)
+	enc := json.NewEncoder(out)
+	for _, record := range records[:4] {
+		assert.Nil(t, enc.Encode(record))
+	}
+	assert.Nil(t, os.WriteFile(path, out.Bytes(), 0600))
+	conns, err := ReplayFile(New(new(echoHandler), WithCodec(codec)), path)
+	assert.Nil(t, err)
+	assert.Equal(t, conns[5].Frames(), [][]byte{[]byte("hello")})
+	_, err = ReplayFile(h, filepath.Join(t.TempDir(), "missing"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	// ErrProtocolUnknown will throw when no Sniffer route matches the connection
+	ErrProtocolUnknown = errors.New("unknown protocol")
+	// ErrSniffTimeout will throw when client sends not enough bytes to match a Sniffer route in time
+	ErrSniffTimeout = errors.New("sniff protocol timeout")
+)
+
+// DefaultSniffTimeout is the default Sniffer Timeout
+const DefaultSniffTimeout = 5 * time.Second
+
+// SniffResult is the result of a Matcher
+type SniffResult int
+
+const (
+	SniffNoMatch SniffResult = iota // the connection is not the protocol
+	SniffMatch                      // the connection is the protocol
+	SniffMore                       // more bytes are required to decide
+)
+
+// Matcher will check the first bytes received from client
+// The peek bytes must not be modified or retained.
+type Matcher func(peek []byte) SniffResult
+
+// SniffRoute is a protocol served on a sniffing Address
+type SniffRoute struct {
+	// Name is the protocol name, added to connection Logger fields as "protocol"
+	Name string
+	// Match will decide whether the connection is served by this route
+	Match Matcher
+	// Codec is the Codec of the protocol, server Codec is used when nil
+	Codec Codec
+	// Handler is the Handler of the protocol, the Handler bound with Address is used when nil
+	Handler Handler
+	// TLS will serve the protocol over TLS when not nil, the sniffed bytes are the beginning of TLS stream,
+	// so Codec and Handler receive the decrypted data. It is usually matched by MatchTLS.
+	TLS *tls.Config
+}
+
+// Sniffer will route each connection of an Address to a (Codec, Handler) pair by its first bytes
+// Routes are matched in order, a route returns SniffMore blocks later routes until more bytes received.
+// Sniffed bytes are not consumed, they are decoded by Codec of the matched route.
+type Sniffer struct {
+	// Routes is the protocols served on the Address
+	Routes []SniffRoute
+	// Fallback will serve connections no route matched or silent until Timeout when not nil,
+	// otherwise such connections are rejected.
+	Fallback *SniffRoute
+	// Timeout is the max time to receive enough bytes to match a route, DefaultSniffTimeout when zero
+	Timeout time.Duration
+}
+
+// match will return the matched route of peek bytes
+// It returns nil and SniffMore when more bytes are required.
+func (s *Sniffer) match(peek []byte, full bool) (*SniffRoute, SniffResult) {
+	for i := range s.Routes {
+		switch s.Routes[i].Match(peek) {
+		case SniffMatch:
+			return &s.Routes[i], SniffMatch
+		case SniffMore:
+			// a full buffer can not receive more bytes
+			if !full {
+				return nil, SniffMore
+			}
+		}
+	}
+	return nil, SniffNoMatch
+}
+
+// sniff will read from conn into buf until a route matched
+func (s *Sniffer) sniff(c *netConnection) (*SniffRoute, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSniffTimeout
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	b := c.scratch
+	for {
+		// bytes read with PROXY protocol header are already in buffer
+		if c.buf.Size() > 0 {
+			_, peek := c.buf.NextN(c.buf.Size())
+			route, result := s.match(peek, c.buf.Size() == c.buf.Capacity())
+			if result == SniffMatch {
+				return route, nil
+			}
+			if result == SniffNoMatch {
+				return s.fallback(ErrProtocolUnknown)
+			}
+		}
+		n, err := c.conn.Read(b[:c.buf.Capacity()-c.buf.Size()])
+		if n > 0 {
+			_, _ = c.buf.Write(b[:n])
+			c.read(b[:n])
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return s.fallback(ErrSniffTimeout)
+			}
+			return nil, err
+		}
+	}
+}
+
+func (s *Sniffer) fallback(err error) (*SniffRoute, error) {
+	if s.Fallback != nil {
+		return s.Fallback, nil
+	}
+	return nil, err
+}
+
+// MatchPrefix will return Matcher of connections beginning with any of prefixes
+func MatchPrefix(prefixes ...[]byte) Matcher {
+	return func(peek []byte) SniffResult {
+		result := SniffNoMatch
+		for _, prefix := range prefixes {
+			if len(peek) >= len(prefix) {
+				if bytes.HasPrefix(peek, prefix) {
+					return SniffMatch
+				}
+			} else if bytes.HasPrefix(prefix, peek) {
+				result = SniffMore
+			}
+		}
+		return result
+	}
+}
+
+// httpMethods is the request line prefixes of HTTP/1.x methods and HTTP/2 connection preface
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("HEAD "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("CONNECT "),
+	[]byte("OPTIONS "),
+	[]byte("TRACE "),
+	[]byte("PATCH "),
+	[]byte("PRI * HTTP/2.0"),
+}
+
+// MatchHTTP will return Matcher of HTTP/1.x requests and HTTP/2 prior knowledge connections
+func MatchHTTP() Matcher {
+	return MatchPrefix(httpMethods...)
+}
+
+// MatchTLS will return Matcher of connections beginning with a TLS ClientHello
+func MatchTLS() Matcher {
+	return func(peek []byte) SniffResult {
+		// record type handshake, record version 3.x, then handshake type client hello
+		expected := []byte{0x16, 0x03}
+		for i := 0; i < len(peek) && i < 6; i++ {
+			switch {
+			case i < len(expected) && peek[i] != expected[i]:
+				return SniffNoMatch
+			case i == 2 && peek[i] > 0x04:
+				return SniffNoMatch
+			case i == 5 && peek[i] != 0x01:
+				return SniffNoMatch
+			}
+		}
+		if len(peek) < 6 {
+			return SniffMore
+		}
+		return SniffMatch
+	}
+}
+
+// MatchAny will return Matcher of all connections
+func MatchAny() Matcher {
+	return func(peek []byte) SniffResult {
+		return SniffMatch
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	match := MatchPrefix([]byte("MAGIC"), []byte("MQ"))
+	assert.Equal(t, match([]byte("M")), SniffMore)
+	assert.Equal(t, match([]byte("MQ")), SniffMatch)
+	assert.Equal(t, match([]byte("MAG")), SniffMore)
+	assert.Equal(t, match([]byte("MAGIC!")), SniffMatch)
+	assert.Equal(t, match([]byte("MX")), SniffNoMatch)
+}
+
+func TestMatchHTTP(t *testing.T) {
+	match := MatchHTTP()
+	assert.Equal(t, match([]byte("GET / HTTP/1.1\r\n")), SniffMatch)
+	assert.Equal(t, match([]byte("PO")), SniffMore)
+	assert.Equal(t, match([]byte("PRI * HTTP/2.0\r\n")), SniffMatch)
+	assert.Equal(t, match([]byte("GETX")), SniffNoMatch)
+	assert.Equal(t, match([]byte{0x16, 0x03}), SniffNoMatch)
+}
+
+func TestMatchTLS(t *testing.T) {
+	match := MatchTLS()
+	assert.Equal(t, match([]byte{0x16}), SniffMore)
+	assert.Equal(t, match([]byte{0x16, 0x03, 0x01, 0x02, 0x00}), SniffMore)
+	assert.Equal(t, match([]byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01}), SniffMatch)
+	assert.Equal(t, match([]byte{0x16, 0x03, 0x05}), SniffNoMatch)
+	assert.Equal(t, match([]byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x02}), SniffNoMatch)
+	assert.Equal(t, match([]byte("GET ")), SniffNoMatch)
+	assert.Equal(t, MatchAny()([]byte("x")), SniffMatch)
+}
+
+func TestNetServer_Sniffer(t *testing.T) {
+	s := newTestServer()
+	framed, plain, tlsHandler := newEchoHandler(), newEchoHandler(), newEchoHandler()
+	sniffer := &Sniffer{
+		Routes: []SniffRoute{
+			{Name: "tls", Match: MatchTLS(), Handler: tlsHandler},
+			{Name: "http", Match: MatchHTTP()},
+			{Name: "framed", Match: MatchPrefix([]byte{0, 0, 0}), Codec: new(LengthFieldCodec), Handler: framed},
+		},
+		Timeout: time.Millisecond * 50,
+	}
+	address := NewAddress("tcp", "127.0.0.1:0", WithSniffer(sniffer))
+	assert.Nil(t, s.Bind(address, plain))
+	fallback := newEchoHandler()
+	fallbackAddress := NewAddress("tcp", "127.0.0.1:0", WithSniffer(&Sniffer{
+		Routes:   sniffer.Routes,
+		Fallback: &SniffRoute{Name: "fallback", Handler: fallback},
+		Timeout:  sniffer.Timeout,
+	}))
+	assert.Nil(t, s.Bind(fallbackAddress, plain))
+	listening, result := startServer(t, s, address, fallbackAddress)
+
+	t.Run("test route codec and handler", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		frame := new(LengthFieldCodec).Encode([]byte("hello"))
+		conn.Write(frame[:2])
+		time.Sleep(time.Millisecond * 10)
+		conn.Write(frame[2:])
+		assert.Equal(t, readFrame(t, conn), "hello")
+		conn.Close()
+		assert.Equal(t, (<-framed.disconnected).Remote(), conn.LocalAddr().String())
+	})
+
+	t.Run("test bound handler", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.Write([]byte("GET / HTTP/1.1\r\n"))
+		b := make([]byte, 16)
+		n, err := conn.Read(b)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b[:n]), "GET / HTTP/1.1\r\n")
+		conn.Close()
+		<-plain.disconnected
+	})
+
+	t.Run("test tls", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		client := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		go client.Handshake()
+		waitFor(t, func() bool {
+			tlsHandler.mu.Lock()
+			defer tlsHandler.mu.Unlock()
+			return len(tlsHandler.remotes) == 1
+		})
+		conn.Close()
+		c := <-tlsHandler.disconnected
+		assert.Equal(t, c.Remote(), conn.LocalAddr().String())
+	})
+
+	t.Run("test reject", func(t *testing.T) {
+		for _, data := range [][]byte{[]byte("UNKNOWN"), nil} {
+			conn, err := net.Dial("tcp", listening[address])
+			assert.Nil(t, err)
+			conn.Write(data)
+			_, err = conn.Read(make([]byte, 1))
+			assert.NotNil(t, err)
+			conn.Close()
+		}
+		waitFor(t, func() bool {
+			// both addresses are "tcp://127.0.0.1:0", so sum rejected of one snapshot
+			rejected := uint64(0)
+			for _, st := range s.Stats().Addresses {
+				rejected += st.Rejected
+			}
+			return rejected == 2
+		})
+	})
+
+	t.Run("test fallback", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[fallbackAddress])
+		assert.Nil(t, err)
+		defer conn.Close()
+		// silent client is served by fallback after timeout
+		c := make(chan struct{})
+		go func() {
+			defer close(c)
+			b := make([]byte, 2)
+			n, err := conn.Read(b)
+			assert.Nil(t, err)
+			assert.Equal(t, string(b[:n]), "hi")
+		}()
+		time.Sleep(time.Millisecond * 80)
+		conn.Write([]byte("hi"))
+		<-c
+		fallback.mu.Lock()
+		assert.Len(t, fallback.remotes, 1)
+		fallback.mu.Unlock()
+	})
+
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_SnifferTLS(t *testing.T) {
+	s := newTestServer()
+	secure, plain := newEchoHandler(), newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0", WithSniffer(&Sniffer{
+		Routes:   []SniffRoute{{Name: "tls", Match: MatchTLS(), Handler: secure, TLS: testTLSConfig(t)}},
+		Fallback: &SniffRoute{Name: "plain"},
+		Timeout:  time.Millisecond * 50,
+	}))
+	assert.Nil(t, s.Bind(address, plain))
+	listening, result := startServer(t, s, address)
+
+	// handler of tls route receives the decrypted data
+	conn, err := tls.Dial("tcp", listening[address], &tls.Config{InsecureSkipVerify: true})
+	assert.Nil(t, err)
+	conn.Write([]byte("hello"))
+	b := make([]byte, 5)
+	_, err = io.ReadFull(conn, b)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "hello")
+	conn.Close()
+	assert.Equal(t, (<-secure.disconnected).Remote(), conn.LocalAddr().String())
+
+	// other connections are served in plain
+	raw, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	raw.Write([]byte("hello"))
+	_, err = io.ReadFull(raw, b)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "hello")
+	raw.Close()
+	<-plain.disconnected
+
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
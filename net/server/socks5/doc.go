@@ -0,0 +1,5 @@
+// Package socks5 is a SOCKS5 server (RFC 1928) on net/server.
+// Server is a server.Handler supporting no authentication and username/password authentication (RFC 1929),
+// CONNECT and UDP ASSOCIATE commands, destinations are checked by Ruleset before connected.
+// Serve it with server.NothingCodec, so handshake messages are parsed by Server in any chunking.
+package socks5
@@ -0,0 +1,144 @@
+package socks5
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+)
+
+// Version is the SOCKS protocol version
+const Version = 0x05
+
+// authVersion is the version of username/password authentication (RFC 1929)
+const authVersion = 0x01
+
+// Method is the authentication method
+type Method byte
+
+const (
+	MethodNoAuth       Method = 0x00
+	MethodUserPass     Method = 0x02
+	MethodNoAcceptable Method = 0xff
+)
+
+// Command is the request command
+type Command byte
+
+const (
+	CommandConnect      Command = 0x01
+	CommandBind         Command = 0x02
+	CommandUDPAssociate Command = 0x03
+)
+
+// Reply is the reply field of request reply
+type Reply byte
+
+const (
+	ReplySucceeded           Reply = 0x00
+	ReplyGeneralFailure      Reply = 0x01
+	ReplyNotAllowed          Reply = 0x02
+	ReplyNetworkUnreachable  Reply = 0x03
+	ReplyHostUnreachable     Reply = 0x04
+	ReplyConnectionRefused   Reply = 0x05
+	ReplyTTLExpired          Reply = 0x06
+	ReplyCommandNotSupported Reply = 0x07
+	ReplyAddressNotSupported Reply = 0x08
+)
+
+const (
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+)
+
+var (
+	// ErrVersion will throw when client sends message of unsupported version
+	ErrVersion = errors.New("socks5: unsupported version")
+	// ErrAddressType will throw when address type is unknown
+	ErrAddressType = errors.New("socks5: unsupported address type")
+	// ErrAuthFailed will throw when username or password is wrong
+	ErrAuthFailed = errors.New("socks5: authentication failed")
+	// ErrNoAcceptableMethod will throw when client offers no supported authentication method
+	ErrNoAcceptableMethod = errors.New("socks5: no acceptable authentication method")
+	// ErrNotAllowed will throw when destination is denied by Ruleset
+	ErrNotAllowed = errors.New("socks5: destination not allowed")
+)
+
+// Addr is a destination address of request
+type Addr struct {
+	// Host is the domain name, empty when IP is given by client
+	Host string
+	IP   net.IP
+	Port int
+}
+
+func (a *Addr) String() string {
+	host := a.Host
+	if host == "" {
+		host = a.IP.String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(a.Port))
+}
+
+// parseAddr will parse ATYP, DST.ADDR and DST.PORT from b
+// It returns the parsed length, 0 when more bytes are required.
+func parseAddr(b []byte) (*Addr, int, error) {
+	if len(b) < 1 {
+		return nil, 0, nil
+	}
+	var addr Addr
+	var n int
+	switch b[0] {
+	case atypIPv4:
+		n = 1 + net.IPv4len
+		if len(b) >= n {
+			addr.IP = net.IP(append([]byte{}, b[1:n]...))
+		}
+	case atypIPv6:
+		n = 1 + net.IPv6len
+		if len(b) >= n {
+			addr.IP = net.IP(append([]byte{}, b[1:n]...))
+		}
+	case atypDomain:
+		if len(b) < 2 {
+			return nil, 0, nil
+		}
+		n = 2 + int(b[1])
+		if len(b) >= n {
+			addr.Host = string(b[2:n])
+		}
+	default:
+		return nil, 0, ErrAddressType
+	}
+	if len(b) < n+2 {
+		return nil, 0, nil
+	}
+	addr.Port = int(binary.BigEndian.Uint16(b[n:]))
+	return &addr, n + 2, nil
+}
+
+// appendAddr will append ATYP, ADDR and PORT of addr to b
+func appendAddr(b []byte, addr net.Addr) []byte {
+	var ip net.IP
+	var port int
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		b = append(append(b, atypIPv4), ip4...)
+	} else if ip16 := ip.To16(); ip16 != nil {
+		b = append(append(b, atypIPv6), ip16...)
+	} else {
+		b = append(b, atypIPv4, 0, 0, 0, 0)
+	}
+	return append(b, byte(port>>8), byte(port))
+}
+
+// reply will build request reply of rep and bound address
+func reply(rep Reply, bound net.Addr) []byte {
+	return appendAddr([]byte{Version, byte(rep), 0x00}, bound)
+}
@@ -0,0 +1,43 @@
+package socks5
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddr(t *testing.T) {
+	addr, n, err := parseAddr([]byte{atypIPv4, 127, 0, 0, 1, 0x1f, 0x90, 0xff})
+	assert.Nil(t, err)
+	assert.Equal(t, n, 7)
+	assert.Equal(t, addr.String(), "127.0.0.1:8080")
+
+	addr, n, err = parseAddr(append(append([]byte{atypDomain, 9}, "localhost"...), 0, 80))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 13)
+	assert.Equal(t, addr.Host, "localhost")
+	assert.Equal(t, addr.String(), "localhost:80")
+
+	addr, n, err = parseAddr(append(append([]byte{atypIPv6}, net.IPv6loopback...), 0, 80))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 19)
+	assert.Equal(t, addr.String(), "[::1]:80")
+
+	for _, b := range [][]byte{{}, {atypIPv4, 127}, {atypDomain}, {atypDomain, 3, 'a'}, {atypIPv4, 127, 0, 0, 1, 0}} {
+		addr, n, err = parseAddr(b)
+		assert.Nil(t, err)
+		assert.Equal(t, n, 0)
+		assert.Nil(t, addr)
+	}
+	_, _, err = parseAddr([]byte{0x09})
+	assert.ErrorIs(t, err, ErrAddressType)
+}
+
+func TestReply(t *testing.T) {
+	assert.Equal(t, reply(ReplySucceeded, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1080}),
+		[]byte{Version, 0x00, 0x00, atypIPv4, 10, 0, 0, 1, 0x04, 0x38})
+	assert.Equal(t, reply(ReplyNotAllowed, nil), []byte{Version, 0x02, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0})
+	assert.Equal(t, reply(ReplySucceeded, &net.UDPAddr{IP: net.IPv6loopback, Port: 1}),
+		append(append([]byte{Version, 0x00, 0x00, atypIPv6}, net.IPv6loopback...), 0, 1))
+}
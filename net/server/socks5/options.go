@@ -0,0 +1,79 @@
+package socks5
+
+import (
+	"time"
+)
+
+// Credentials will check username and password of RFC 1929 authentication
+type Credentials func(username, password string) bool
+
+// StaticCredentials will return Credentials of fixed username and password pairs
+func StaticCredentials(users map[string]string) Credentials {
+	return func(username, password string) bool {
+		p, ok := users[username]
+		return ok && p == password
+	}
+}
+
+// Options defined Server options
+type Options struct {
+	// Credentials requires username/password authentication when not nil, otherwise no authentication
+	Credentials Credentials
+	// Ruleset permits destinations, all destinations are permitted when nil
+	Ruleset Ruleset
+	// DialTimeout is the timeout to connect destination and resolve domain
+	DialTimeout time.Duration
+	// UDPHost is the IP to listen UDP ASSOCIATE relay, default the IP of connection local address
+	UDPHost string
+	// BufferCapacity is the read buffer capacity of relays
+	BufferCapacity int
+}
+
+// Option is callback function to edit Options
+type Option func(options *Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		DialTimeout:    10 * time.Second,
+		BufferCapacity: 64 * 1024,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithCredentials is edit Options Credentials field
+func WithCredentials(credentials Credentials) Option {
+	return func(options *Options) {
+		options.Credentials = credentials
+	}
+}
+
+// WithRuleset is edit Options Ruleset field
+func WithRuleset(ruleset Ruleset) Option {
+	return func(options *Options) {
+		options.Ruleset = ruleset
+	}
+}
+
+// WithDialTimeout is edit Options DialTimeout field
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.DialTimeout = timeout
+	}
+}
+
+// WithUDPHost is edit Options UDPHost field
+func WithUDPHost(host string) Option {
+	return func(options *Options) {
+		options.UDPHost = host
+	}
+}
+
+// WithBufferCapacity is edit Options BufferCapacity field
+func WithBufferCapacity(capacity int) Option {
+	return func(options *Options) {
+		options.BufferCapacity = capacity
+	}
+}
@@ -0,0 +1,98 @@
+package socks5
+
+import (
+	"net"
+	"strings"
+)
+
+// Ruleset decides whether a request to destination is permitted
+// Domain destinations are resolved before checked, so dest has both Host and IP.
+type Ruleset interface {
+	Permit(cmd Command, dest *Addr) bool
+}
+
+// Rule matches destinations by host and port
+type Rule struct {
+	// CIDRs matches destination IP
+	CIDRs []*net.IPNet
+	// Domains matches destination domain case-insensitively, a domain beginning with "." matches its subdomains
+	Domains []string
+	// Ports matches destination port, empty matches all ports
+	Ports []int
+	// Commands matches request command, empty matches all commands
+	Commands []Command
+}
+
+func (r *Rule) match(cmd Command, dest *Addr) bool {
+	return r.matchHost(dest) && r.matchPort(dest.Port) && r.matchCommand(cmd)
+}
+
+func (r *Rule) matchHost(dest *Addr) bool {
+	if len(r.CIDRs) == 0 && len(r.Domains) == 0 {
+		return true
+	}
+	for _, cidr := range r.CIDRs {
+		if dest.IP != nil && cidr.Contains(dest.IP) {
+			return true
+		}
+	}
+	host := strings.ToLower(strings.TrimSuffix(dest.Host, "."))
+	if host == "" {
+		return false
+	}
+	for _, domain := range r.Domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasPrefix(domain, ".") && strings.HasSuffix(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchPort(port int) bool {
+	if len(r.Ports) == 0 {
+		return true
+	}
+	for _, p := range r.Ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchCommand(cmd Command) bool {
+	if len(r.Commands) == 0 {
+		return true
+	}
+	for _, c := range r.Commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules is Ruleset of allow and deny Rule
+// A destination is permitted when it matches no Deny rule, and matches any Allow rule or Allow is empty.
+type Rules struct {
+	Allow []Rule
+	Deny  []Rule
+}
+
+func (r *Rules) Permit(cmd Command, dest *Addr) bool {
+	for i := range r.Deny {
+		if r.Deny[i].match(cmd, dest) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for i := range r.Allow {
+		if r.Allow[i].match(cmd, dest) {
+			return true
+		}
+	}
+	return false
+}
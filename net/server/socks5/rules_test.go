@@ -0,0 +1,32 @@
+package socks5
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules_Permit(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	rules := &Rules{
+		Allow: []Rule{
+			{Domains: []string{".example.com", "example.org"}, Ports: []int{80, 443}},
+			{CIDRs: []*net.IPNet{private}},
+		},
+		Deny: []Rule{
+			{Domains: []string{"admin.example.com"}},
+			{CIDRs: []*net.IPNet{private}, Commands: []Command{CommandUDPAssociate}},
+		},
+	}
+	ip := net.IPv4(1, 2, 3, 4)
+	assert.True(t, rules.Permit(CommandConnect, &Addr{Host: "www.Example.com.", IP: ip, Port: 443}))
+	assert.True(t, rules.Permit(CommandConnect, &Addr{Host: "example.org", IP: ip, Port: 80}))
+	assert.False(t, rules.Permit(CommandConnect, &Addr{Host: "example.com", IP: ip, Port: 80}))
+	assert.False(t, rules.Permit(CommandConnect, &Addr{Host: "www.example.com", IP: ip, Port: 22}))
+	assert.False(t, rules.Permit(CommandConnect, &Addr{Host: "admin.example.com", IP: ip, Port: 443}))
+	assert.True(t, rules.Permit(CommandConnect, &Addr{IP: net.IPv4(10, 1, 1, 1), Port: 22}))
+	assert.False(t, rules.Permit(CommandUDPAssociate, &Addr{IP: net.IPv4(10, 1, 1, 1), Port: 53}))
+	assert.False(t, rules.Permit(CommandConnect, &Addr{IP: ip, Port: 80}))
+	assert.True(t, new(Rules).Permit(CommandConnect, &Addr{IP: ip, Port: 80}))
+}
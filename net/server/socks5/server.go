@@ -0,0 +1,307 @@
+package socks5
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/jarod2011/toolkit/buffer"
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+type state int
+
+const (
+	stateGreeting state = iota
+	stateAuth
+	stateRequest
+	stateConnect
+	stateAssociate
+)
+
+// session is the state of a client connection
+// It is only accessed by Handler callbacks of the connection.
+type session struct {
+	state    state
+	pending  []byte
+	user     string
+	upstream net.Conn
+	relay    net.PacketConn
+}
+
+// Server is a server.Handler serving SOCKS5 clients
+type Server struct {
+	opts Options
+	// pool is the buffers of piping upstream to client
+	pool     *buffer.Pool
+	sessions sync.Map
+}
+
+// NewServer will create SOCKS5 Server
+func NewServer(opts ...Option) *Server {
+	options := newOptions(opts...)
+	return &Server{opts: options, pool: buffer.NewPool(options.BufferCapacity)}
+}
+
+func (s *Server) OnConnected(conn server.Connection) (server.Action, error) {
+	s.sessions.Store(conn, &session{state: stateGreeting})
+	return server.NothingAction, nil
+}
+
+func (s *Server) OnDisconnected(conn server.Connection, reason *server.CloseReason) error {
+	v, ok := s.sessions.LoadAndDelete(conn)
+	if !ok {
+		return nil
+	}
+	sess := v.(*session)
+	if sess.upstream != nil {
+		sess.upstream.Close()
+	}
+	if sess.relay != nil {
+		sess.relay.Close()
+	}
+	return nil
+}
+
+func (s *Server) OnReceived(frame []byte, conn server.Connection) (server.Action, error) {
+	v, ok := s.sessions.Load(conn)
+	if !ok {
+		return server.DisconnectionAction, nil
+	}
+	sess := v.(*session)
+	switch sess.state {
+	case stateConnect:
+		return s.forward(sess, frame)
+	case stateAssociate:
+		// the association is alive until TCP connection closed, data on it is ignored
+		return server.NothingAction, nil
+	}
+	sess.pending = append(sess.pending, frame...)
+	for {
+		n, action, err := s.handshake(sess, conn)
+		sess.pending = sess.pending[n:]
+		if n == 0 || action != server.NothingAction || err != nil {
+			return action, err
+		}
+		if sess.state == stateConnect {
+			// data pipelined after request
+			pending := sess.pending
+			sess.pending = nil
+			if len(pending) == 0 {
+				return server.NothingAction, nil
+			}
+			return s.forward(sess, pending)
+		}
+	}
+}
+
+func (s *Server) OnError(conn server.Connection, err error) server.Action {
+	conn.Logger().WarnF("socks5 error: %v", err)
+	return server.NothingAction
+}
+
+// forward will write client data to upstream
+func (s *Server) forward(sess *session, data []byte) (server.Action, error) {
+	if _, err := sess.upstream.Write(data); err != nil {
+		return server.DisconnectionAction, err
+	}
+	return server.NothingAction, nil
+}
+
+// handshake will handle a message of session pending bytes
+// It returns the handled bytes length, 0 when more bytes are required.
+func (s *Server) handshake(sess *session, conn server.Connection) (int, server.Action, error) {
+	b := sess.pending
+	switch sess.state {
+	case stateGreeting:
+		if len(b) < 2 {
+			return 0, server.NothingAction, nil
+		}
+		if b[0] != Version {
+			return 0, server.DisconnectionAction, ErrVersion
+		}
+		n := 2 + int(b[1])
+		if len(b) < n {
+			return 0, server.NothingAction, nil
+		}
+		method := s.method(b[2:n])
+		if err := conn.Send([]byte{Version, byte(method)}, false); err != nil {
+			return n, server.DisconnectionAction, err
+		}
+		switch method {
+		case MethodUserPass:
+			sess.state = stateAuth
+		case MethodNoAuth:
+			sess.state = stateRequest
+		default:
+			return n, server.DisconnectionAction, ErrNoAcceptableMethod
+		}
+		return n, server.NothingAction, nil
+	case stateAuth:
+		if len(b) < 2 {
+			return 0, server.NothingAction, nil
+		}
+		if b[0] != authVersion {
+			return 0, server.DisconnectionAction, ErrVersion
+		}
+		ulen := int(b[1])
+		if len(b) < 3+ulen {
+			return 0, server.NothingAction, nil
+		}
+		plen := int(b[2+ulen])
+		n := 3 + ulen + plen
+		if len(b) < n {
+			return 0, server.NothingAction, nil
+		}
+		user, password := string(b[2:2+ulen]), string(b[3+ulen:n])
+		if !s.opts.Credentials(user, password) {
+			_ = conn.Send([]byte{authVersion, 0x01}, false)
+			return n, server.DisconnectionAction, ErrAuthFailed
+		}
+		sess.user = user
+		sess.state = stateRequest
+		return n, server.NothingAction, conn.Send([]byte{authVersion, 0x00}, false)
+	case stateRequest:
+		if len(b) < 4 {
+			return 0, server.NothingAction, nil
+		}
+		if b[0] != Version {
+			return 0, server.DisconnectionAction, ErrVersion
+		}
+		dest, n, err := parseAddr(b[3:])
+		if err != nil {
+			_ = conn.Send(reply(ReplyAddressNotSupported, nil), false)
+			return 0, server.DisconnectionAction, err
+		}
+		if n == 0 {
+			return 0, server.NothingAction, nil
+		}
+		action, err := s.request(sess, conn, Command(b[1]), dest)
+		return 3 + n, action, err
+	}
+	return 0, server.NothingAction, nil
+}
+
+// method will choose authentication method of offered methods
+func (s *Server) method(offered []byte) Method {
+	want := MethodNoAuth
+	if s.opts.Credentials != nil {
+		want = MethodUserPass
+	}
+	for _, m := range offered {
+		if Method(m) == want {
+			return want
+		}
+	}
+	return MethodNoAcceptable
+}
+
+// request will execute command of request, the reply is sent before return
+func (s *Server) request(sess *session, conn server.Connection, cmd Command, dest *Addr) (server.Action, error) {
+	logger := conn.Logger().WithField("dest", dest.String())
+	if sess.user != "" {
+		logger = logger.WithField("user", sess.user)
+	}
+	fail := func(rep Reply, err error) (server.Action, error) {
+		logger.DebugF("socks5 command %d failed: %v", cmd, err)
+		_ = conn.Send(reply(rep, nil), false)
+		return server.DisconnectionAction, err
+	}
+	switch cmd {
+	case CommandConnect:
+		if err := s.resolve(dest); err != nil {
+			return fail(ReplyHostUnreachable, err)
+		}
+		if !s.permit(cmd, dest) {
+			return fail(ReplyNotAllowed, ErrNotAllowed)
+		}
+		upstream, err := net.DialTimeout("tcp", net.JoinHostPort(dest.IP.String(), strconv.Itoa(dest.Port)), s.opts.DialTimeout)
+		if err != nil {
+			return fail(dialReply(err), err)
+		}
+		sess.upstream = upstream
+		sess.state = stateConnect
+		logger.DebugF("socks5 connected")
+		go s.pipe(conn, sess)
+		return server.NothingAction, conn.Send(reply(ReplySucceeded, upstream.LocalAddr()), false)
+	case CommandUDPAssociate:
+		relay, err := net.ListenPacket("udp", net.JoinHostPort(s.udpHost(conn), "0"))
+		if err != nil {
+			return fail(ReplyGeneralFailure, err)
+		}
+		sess.relay = relay
+		sess.state = stateAssociate
+		logger.DebugF("socks5 udp associated on %s", relay.LocalAddr())
+		go s.associate(conn, relay)
+		return server.NothingAction, conn.Send(reply(ReplySucceeded, relay.LocalAddr()), false)
+	}
+	return fail(ReplyCommandNotSupported, errors.New("socks5: command not supported"))
+}
+
+// resolve will lookup IP of domain destination
+func (s *Server) resolve(dest *Addr) error {
+	if dest.IP != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.DialTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, dest.Host)
+	if err != nil {
+		return err
+	}
+	dest.IP = ips[0].IP
+	return nil
+}
+
+func (s *Server) permit(cmd Command, dest *Addr) bool {
+	return s.opts.Ruleset == nil || s.opts.Ruleset.Permit(cmd, dest)
+}
+
+func (s *Server) udpHost(conn server.Connection) string {
+	if s.opts.UDPHost != "" {
+		return s.opts.UDPHost
+	}
+	host, _, err := net.SplitHostPort(conn.Local())
+	if err != nil {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// dialReply will return Reply of dial error
+func dialReply(err error) Reply {
+	var ne net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReplyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return ReplyNetworkUnreachable
+	case errors.As(err, &ne) && ne.Timeout(), errors.Is(err, syscall.EHOSTUNREACH):
+		return ReplyHostUnreachable
+	}
+	return ReplyGeneralFailure
+}
+
+// pipe will forward bytes from upstream to client through a pooled buffer
+// The buffer is sent without copy and reused after written, so upstream is not read while client is slow.
+// The client is closed after the queued bytes flushed when upstream closed.
+func (s *Server) pipe(conn server.Connection, sess *session) {
+	defer conn.Close()
+	buf := s.pool.Get()
+	defer s.pool.Put(buf)
+	for {
+		n, err := buf.Fill(sess.upstream)
+		if n > 0 {
+			if conn.SendWait(buf.Bytes(), true) != nil {
+				return
+			}
+			buf.Reset()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
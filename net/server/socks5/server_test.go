@@ -0,0 +1,204 @@
+package socks5
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/net/server/servertest"
+)
+
+// startEcho will start a TCP echo server
+func startEcho(t *testing.T) *net.TCPAddr {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr)
+}
+
+func request(cmd Command, addr *net.TCPAddr) []byte {
+	return appendAddr([]byte{Version, byte(cmd), 0x00}, addr)
+}
+
+// readReply will read request reply and return its reply field and bound address
+func readReply(t *testing.T, client net.Conn) (Reply, *Addr) {
+	b := make([]byte, 10)
+	_, err := io.ReadFull(client, b)
+	assert.Nil(t, err)
+	addr, _, err := parseAddr(b[3:])
+	assert.Nil(t, err)
+	return Reply(b[1]), addr
+}
+
+func readN(t *testing.T, client net.Conn, n int) []byte {
+	b := make([]byte, n)
+	_, err := io.ReadFull(client, b)
+	assert.Nil(t, err)
+	return b
+}
+
+func TestServer_Connect(t *testing.T) {
+	echo := startEcho(t)
+	h := servertest.New(NewServer())
+	client, conn := h.Pipe()
+	defer client.Close()
+	// greeting, request and data are pipelined in chunks
+	data := append([]byte{Version, 2, byte(MethodUserPass), byte(MethodNoAuth)}, request(CommandConnect, echo)...)
+	client.Write(data[:3])
+	client.Write(append(data[3:], "hello"...))
+	assert.Equal(t, readN(t, client, 2), []byte{Version, byte(MethodNoAuth)})
+	rep, bound := readReply(t, client)
+	assert.Equal(t, rep, ReplySucceeded)
+	assert.Equal(t, bound.IP.String(), "127.0.0.1")
+	assert.Equal(t, string(readN(t, client, 5)), "hello")
+	client.Write([]byte("world"))
+	assert.Equal(t, string(readN(t, client, 5)), "world")
+	assert.False(t, conn.Disconnected())
+}
+
+func TestServer_Auth(t *testing.T) {
+	echo := startEcho(t)
+	h := servertest.New(NewServer(WithCredentials(StaticCredentials(map[string]string{"user": "pass"}))))
+	auth := func(user, pass string) []byte {
+		return append(append(append([]byte{authVersion, byte(len(user))}, user...), byte(len(pass))), pass...)
+	}
+
+	client, _ := h.Pipe()
+	defer client.Close()
+	client.Write([]byte{Version, 1, byte(MethodUserPass)})
+	assert.Equal(t, readN(t, client, 2), []byte{Version, byte(MethodUserPass)})
+	client.Write(auth("user", "pass"))
+	assert.Equal(t, readN(t, client, 2), []byte{authVersion, 0x00})
+	client.Write(domainRequest("localhost", echo.Port))
+	rep, _ := readReply(t, client)
+	assert.Equal(t, rep, ReplySucceeded)
+
+	client, conn := h.Pipe()
+	client.Write(append([]byte{Version, 1, byte(MethodUserPass)}, auth("user", "bad")...))
+	assert.Equal(t, readN(t, client, 4), []byte{Version, byte(MethodUserPass), authVersion, 0x01})
+	_, err := client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, conn.Errors()[0], ErrAuthFailed)
+
+	client, conn = h.Pipe()
+	client.Write([]byte{Version, 1, byte(MethodNoAuth)})
+	assert.Equal(t, readN(t, client, 2), []byte{Version, byte(MethodNoAcceptable)})
+	_, err = client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, conn.Errors()[0], ErrNoAcceptableMethod)
+}
+
+func domainRequest(host string, port int) []byte {
+	b := append(append([]byte{Version, byte(CommandConnect), 0x00, atypDomain, byte(len(host))}, host...), 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-2:], uint16(port))
+	return b
+}
+
+func TestServer_Reject(t *testing.T) {
+	echo := startEcho(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	refused := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+	rules := &Rules{Deny: []Rule{{Ports: []int{echo.Port}}}}
+	h := servertest.New(NewServer(WithRuleset(rules)))
+
+	for _, c := range []struct {
+		request []byte
+		reply   Reply
+	}{
+		{request(CommandConnect, echo), ReplyNotAllowed},
+		{request(CommandConnect, refused), ReplyConnectionRefused},
+		{request(CommandBind, echo), ReplyCommandNotSupported},
+		{domainRequest("invalid.invalid", 80), ReplyHostUnreachable},
+		{[]byte{Version, byte(CommandConnect), 0x00, 0x09}, ReplyAddressNotSupported},
+	} {
+		client, conn := h.Pipe()
+		client.Write(append([]byte{Version, 1, byte(MethodNoAuth)}, c.request...))
+		readN(t, client, 2)
+		rep, _ := readReply(t, client)
+		assert.Equal(t, rep, c.reply)
+		_, err := client.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+		assert.True(t, conn.Disconnected())
+	}
+
+	client, conn := h.Pipe()
+	client.Write([]byte{0x04, 1, 0})
+	_, err = client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, conn.Errors()[0], ErrVersion)
+}
+
+func TestServer_UDPAssociate(t *testing.T) {
+	dest, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer dest.Close()
+	go func() {
+		b := make([]byte, 64)
+		for {
+			n, addr, err := dest.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			dest.WriteTo(append([]byte("echo:"), b[:n]...), addr)
+		}
+	}()
+
+	h := servertest.New(NewServer(WithUDPHost("127.0.0.1")))
+	client, conn := h.Pipe()
+	defer client.Close()
+	client.Write(append([]byte{Version, 1, byte(MethodNoAuth)}, request(CommandUDPAssociate, &net.TCPAddr{IP: net.IPv4zero})...))
+	readN(t, client, 2)
+	rep, bound := readReply(t, client)
+	assert.Equal(t, rep, ReplySucceeded)
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer udp.Close()
+	relay := &net.UDPAddr{IP: bound.IP, Port: bound.Port}
+	header := appendAddr([]byte{0, 0, 0}, dest.LocalAddr())
+	// fragmented datagram is dropped
+	udp.WriteTo(append([]byte{0, 0, 1}, header[3:]...), relay)
+	udp.WriteTo(append(header, "ping"...), relay)
+	udp.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 64)
+	n, _, err := udp.ReadFrom(b)
+	assert.Nil(t, err)
+	assert.Equal(t, b[:n], append(header, "echo:ping"...))
+
+	// datagram from an address client never sent to is not relayed
+	stranger, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer stranger.Close()
+	stranger.WriteTo([]byte("spam"), relay)
+	time.Sleep(time.Millisecond * 20)
+	udp.WriteTo(append(header, "pong"...), relay)
+	n, _, err = udp.ReadFrom(b)
+	assert.Nil(t, err)
+	assert.Equal(t, b[:n], append(header, "echo:pong"...))
+
+	client.Close()
+	for i := 0; i < 100 && !conn.Disconnected(); i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.True(t, conn.Disconnected())
+}
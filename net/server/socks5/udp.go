@@ -0,0 +1,63 @@
+package socks5
+
+import (
+	"net"
+
+	"github.com/jarod2011/toolkit/net/server"
+)
+
+// udpHeaderSize is the size of RSV and FRAG fields of UDP request header
+const udpHeaderSize = 3
+
+// associate will relay UDP datagrams of client until relay closed
+// The first datagram from the IP of TCP connection fixes the client address,
+// datagrams from other addresses are replies of destinations,
+// they are relayed only from destinations client sent to, so the relay is not open to any source.
+func (s *Server) associate(conn server.Connection, relay net.PacketConn) {
+	var clientIP net.IP
+	if host, _, err := net.SplitHostPort(conn.Remote()); err == nil {
+		clientIP = net.ParseIP(host)
+	}
+	var client *net.UDPAddr
+	// destinations is the addresses of sent datagrams, keyed by UDPAddr String
+	destinations := make(map[string]struct{})
+	b := make([]byte, s.opts.BufferCapacity)
+	for {
+		n, addr, err := relay.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		from := addr.(*net.UDPAddr)
+		if client == nil && (clientIP == nil || clientIP.Equal(from.IP)) {
+			client = from
+		}
+		if client != nil && from.IP.Equal(client.IP) && from.Port == client.Port {
+			if dest := s.send(conn, relay, b[:n]); dest != nil {
+				destinations[dest.String()] = struct{}{}
+			}
+		} else if _, ok := destinations[from.String()]; ok && client != nil {
+			// reply of destination is wrapped with header of its address
+			datagram := appendAddr(make([]byte, udpHeaderSize, udpHeaderSize+n+22), from)
+			_, _ = relay.WriteTo(append(datagram, b[:n]...), client)
+		}
+	}
+}
+
+// send will send datagram of client to its destination, and return the destination address
+// Fragmented, malformed or not permitted datagrams are dropped, nil returns then.
+func (s *Server) send(conn server.Connection, relay net.PacketConn, datagram []byte) *net.UDPAddr {
+	if len(datagram) < udpHeaderSize || datagram[2] != 0 {
+		return nil
+	}
+	dest, n, err := parseAddr(datagram[udpHeaderSize:])
+	if err != nil || n == 0 {
+		return nil
+	}
+	if err := s.resolve(dest); err != nil || !s.permit(CommandUDPAssociate, dest) {
+		conn.Logger().DebugF("socks5 udp datagram to %s dropped", dest)
+		return nil
+	}
+	addr := &net.UDPAddr{IP: dest.IP, Port: dest.Port}
+	_, _ = relay.WriteTo(datagram[udpHeaderSize+n:], addr)
+	return addr
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"expvar"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// addressStats is the counters of a bound Address
+// It is safe for concurrent use.
+type addressStats struct {
+	accepted     uint64
+	rejected     uint64
+	bytesIn      uint64
+	bytesOut     uint64
+	framesIn     uint64
+	framesOut    uint64
+	decodeErrors uint64
+	actions      [StopServerAction + 1]uint64
+	disconnects  [closeCodes]uint64
+	latency      *Histogram
+}
+
+func newAddressStats() *addressStats {
+	return &addressStats{latency: NewHistogram()}
+}
+
+func (a *addressStats) action(action Action) {
+	if action >= NothingAction && action <= StopServerAction {
+		atomic.AddUint64(&a.actions[action], 1)
+	}
+}
+
+func (a *addressStats) disconnect(code CloseCode) {
+	if code >= 0 && int(code) < closeCodes {
+		atomic.AddUint64(&a.disconnects[code], 1)
+	}
+}
+
+// AddressStats is statistics snapshot of a bound Address
+type AddressStats struct {
+	// Address is the Address String
+	Address string `json:"address"`
+	// State is the AddressState String
+	State string `json:"state"`
+	// Active is the count of connections being served
+	Active int `json:"active"`
+	// Accepted is the count of connections accepted by listener
+	Accepted uint64 `json:"accepted"`
+	// Rejected is the count of connections rejected by PROXY protocol, Admission or Sniffer
+	Rejected     uint64 `json:"rejected"`
+	BytesIn      uint64 `json:"bytes_in"`
+	BytesOut     uint64 `json:"bytes_out"`
+	FramesIn     uint64 `json:"frames_in"`
+	FramesOut    uint64 `json:"frames_out"`
+	DecodeErrors uint64 `json:"decode_errors"`
+	// QueueDepth is the count of frames queued to send of active connections
+	QueueDepth int `json:"queue_depth"`
+	// Actions is the count of executed Action keyed by Action String
+	Actions map[string]uint64 `json:"actions"`
+	// Disconnects is the count of closed connections keyed by CloseCode String
+	Disconnects map[string]uint64 `json:"disconnects"`
+	// Latency is the Handler OnReceived latency
+	Latency HistogramSnapshot `json:"latency"`
+}
+
+// Stats is statistics snapshot of server
+type Stats struct {
+	// Addresses is the stats of bound addresses sorted by Address String
+	Addresses []AddressStats `json:"addresses"`
+	// Memory is the memory budget usage of all connections
+	Memory MemoryStats `json:"memory"`
+}
+
+// ConnectionStats is statistics snapshot of a connection being served
+type ConnectionStats struct {
+	ID         uint64        `json:"id"`
+	Address    string        `json:"address"`
+	Remote     string        `json:"remote"`
+	Local      string        `json:"local"`
+	Connected  time.Time     `json:"connected"`
+	Age        time.Duration `json:"age"`
+	BytesIn    uint64        `json:"bytes_in"`
+	BytesOut   uint64        `json:"bytes_out"`
+	FramesIn   uint64        `json:"frames_in"`
+	FramesOut  uint64        `json:"frames_out"`
+	QueueDepth int           `json:"queue_depth"`
+	// Memory is the bytes of read buffers and queued data counted by memory budget
+	Memory int64 `json:"memory"`
+}
+
+func (l *listener) snapshot() AddressStats {
+	st := l.stats
+	stats := AddressStats{
+		Address:      l.address.String(),
+		State:        l.getState().String(),
+		Accepted:     atomic.LoadUint64(&st.accepted),
+		Rejected:     atomic.LoadUint64(&st.rejected),
+		BytesIn:      atomic.LoadUint64(&st.bytesIn),
+		BytesOut:     atomic.LoadUint64(&st.bytesOut),
+		FramesIn:     atomic.LoadUint64(&st.framesIn),
+		FramesOut:    atomic.LoadUint64(&st.framesOut),
+		DecodeErrors: atomic.LoadUint64(&st.decodeErrors),
+		Actions:      make(map[string]uint64, len(st.actions)),
+		Disconnects:  make(map[string]uint64, len(st.disconnects)),
+		Latency:      st.latency.Snapshot(),
+	}
+	for action := range st.actions {
+		stats.Actions[Action(action).String()] = atomic.LoadUint64(&st.actions[action])
+	}
+	for code := range st.disconnects {
+		stats.Disconnects[CloseCode(code).String()] = atomic.LoadUint64(&st.disconnects[code])
+	}
+	for _, c := range l.connections() {
+		stats.Active++
+		stats.QueueDepth += c.queueDepth()
+	}
+	return stats
+}
+
+func (l *listener) connections() []*netConnection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	conns := make([]*netConnection, 0, len(l.conns))
+	for _, c := range l.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *netServer) boundListeners() []*listener {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	listeners := make([]*listener, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// Stats will return statistics snapshot of all bound addresses
+func (s *netServer) Stats() Stats {
+	stats := Stats{Memory: s.budget.snapshot()}
+	for _, l := range s.boundListeners() {
+		stats.Addresses = append(stats.Addresses, l.snapshot())
+	}
+	sort.Slice(stats.Addresses, func(i, j int) bool {
+		return stats.Addresses[i].Address < stats.Addresses[j].Address
+	})
+	return stats
+}
+
+// Connections will return statistics snapshot of connections being served sorted by ID
+func (s *netServer) Connections() []ConnectionStats {
+	var conns []ConnectionStats
+	now := time.Now()
+	for _, l := range s.boundListeners() {
+		for _, c := range l.connections() {
+			conns = append(conns, c.snapshot(now))
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].ID < conns[j].ID
+	})
+	return conns
+}
+
+// Kill will disconnect the connection of id, queued data is flushed before closed
+// It returns false when no such connection.
+func (s *netServer) Kill(id uint64) bool {
+	for _, l := range s.boundListeners() {
+		l.mu.Lock()
+		c, ok := l.conns[id]
+		l.mu.Unlock()
+		if ok {
+			c.Logger().InfoF("connection killed")
+			c.close(NewCloseReason(CloseKilled, nil))
+			return true
+		}
+	}
+	return false
+}
+
+// PublishExpvar will publish server Stats as expvar of name
+// Like expvar.Publish, it panics when name is already published.
+func (s *netServer) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return s.Stats()
+	}))
+}
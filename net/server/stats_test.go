@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jarod2011/toolkit/buffer"
+)
+
+var errMalformed = errors.New("malformed")
+
+// strictCodec is LengthFieldCodec reporting frame beginning with 0xff as malformed
+type strictCodec struct {
+	LengthFieldCodec
+}
+
+func (s *strictCodec) DecodeError(buf buffer.Buffer) ([]byte, error) {
+	if _, b := buf.NextN(1); len(b) == 1 && b[0] == 0xff {
+		return nil, errMalformed
+	}
+	return s.Decode(buf), nil
+}
+
+// waitFor will poll cond until it is true or timeout
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100 && !cond(); i++ {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.True(t, cond())
+}
+
+func TestNetServer_Stats(t *testing.T) {
+	s := newTestServer(WithCodec(new(strictCodec)), WithBufferCapacity(16))
+	handler := newEchoHandler()
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	codec := new(LengthFieldCodec)
+
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write(codec.Encode([]byte("hello")))
+	assert.Equal(t, readFrame(t, conn), "hello")
+	waitFor(t, func() bool {
+		return s.Stats().Addresses[0].FramesOut == 1
+	})
+	stats := s.Stats()
+	assert.Len(t, stats.Addresses, 1)
+	st := stats.Addresses[0]
+	assert.Equal(t, st.Address, address.String())
+	assert.Equal(t, st.Active, 1)
+	assert.Equal(t, st.Accepted, uint64(1))
+	assert.Equal(t, st.BytesIn, uint64(9))
+	assert.Equal(t, st.BytesOut, uint64(9))
+	assert.Equal(t, st.FramesIn, uint64(1))
+	// OnConnected and OnReceived
+	assert.Equal(t, st.Actions["nothing"], uint64(2))
+	assert.Equal(t, st.Latency.Count, uint64(1))
+
+	conns := s.Connections()
+	assert.Len(t, conns, 1)
+	assert.Equal(t, conns[0].Remote, conn.LocalAddr().String())
+	assert.Equal(t, conns[0].BytesIn, uint64(9))
+	assert.Equal(t, conns[0].FramesOut, uint64(1))
+	assert.True(t, conns[0].Age > 0)
+
+	t.Run("test decode error", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[address])
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.Write([]byte{0xff, 0, 0, 0})
+		<-handler.disconnected
+		st := s.Stats().Addresses[0]
+		assert.Equal(t, st.DecodeErrors, uint64(1))
+		assert.Equal(t, st.Actions["disconnection"], uint64(1))
+		assert.Equal(t, st.Disconnects["codec_error"], uint64(1))
+		handler.mu.Lock()
+		assert.ErrorIs(t, handler.errs[len(handler.errs)-1], errMalformed)
+		reason := handler.reasons[len(handler.reasons)-1]
+		assert.Equal(t, reason.Code, CloseCodecError)
+		assert.Equal(t, reason.Initiator, InitiatorServer)
+		assert.ErrorIs(t, reason.Err, errMalformed)
+		handler.mu.Unlock()
+	})
+
+	t.Run("test kill", func(t *testing.T) {
+		assert.False(t, s.Kill(0))
+		assert.True(t, s.Kill(conns[0].ID))
+		<-handler.disconnected
+		_, err := conn.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+		assert.Equal(t, s.Stats().Addresses[0].Active, 0)
+		assert.Equal(t, s.Stats().Addresses[0].Disconnects["killed"], uint64(1))
+		assert.Len(t, s.Connections(), 0)
+	})
+
+	t.Run("test exporter", func(t *testing.T) {
+		name := fmt.Sprintf("test_server_stats_%p", s)
+		s.PublishExpvar(name)
+		assert.Contains(t, expvar.Get(name).String(), `"accepted":2`)
+		out := new(bytes.Buffer)
+		assert.Nil(t, s.WritePrometheus(out))
+		assert.Contains(t, out.String(), "# TYPE server_connections_accepted_total counter\n")
+		assert.Contains(t, out.String(), `server_connections_accepted_total{address="`+address.String()+`"} 2`+"\n")
+		assert.Contains(t, out.String(), `server_actions_total{address="`+address.String()+`",action="disconnection"} 1`+"\n")
+		assert.Contains(t, out.String(), `server_disconnects_total{address="`+address.String()+`",code="codec_error"} 1`+"\n")
+		assert.Contains(t, out.String(), `server_handler_latency_seconds_bucket{address="`+address.String()+`",le="+Inf"} 1`+"\n")
+		assert.Contains(t, out.String(), `server_handler_latency_seconds_count{address="`+address.String()+`"} 1`+"\n")
+	})
+
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	histogram := NewHistogram(time.Millisecond, time.Second)
+	histogram.Observe(time.Microsecond)
+	histogram.Observe(time.Minute)
+	out := new(bytes.Buffer)
+	assert.Nil(t, writePrometheus(out, Stats{Addresses: []AddressStats{{
+		Address: `unix://"a"`,
+		Active:  3,
+		Latency: histogram.Snapshot(),
+	}}}))
+	lines := strings.Split(out.String(), "\n")
+	assert.Contains(t, lines, `server_connections_active{address="unix://\"a\""} 3`)
+	assert.Contains(t, lines, `server_handler_latency_seconds_bucket{address="unix://\"a\"",le="0.001"} 1`)
+	assert.Contains(t, lines, `server_handler_latency_seconds_bucket{address="unix://\"a\"",le="1"} 1`)
+	assert.Contains(t, lines, `server_handler_latency_seconds_bucket{address="unix://\"a\"",le="+Inf"} 2`)
+	assert.Contains(t, lines, `server_handler_latency_seconds_sum{address="unix://\"a\""} 60.000001`)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// streamHandler will reply digest of streamed body by its first byte
+//
+//	'd' reply length and sha256 of body
+//	'p' read 10 bytes of body only
+//	'e' echo the rest of body by SendStream
+type streamHandler struct {
+	*echoHandler
+}
+
+func (s *streamHandler) OnStream(header []byte, body io.Reader, conn Connection) (Action, error) {
+	mode := make([]byte, 1)
+	if _, err := io.ReadFull(body, mode); err != nil {
+		return DisconnectionAction, err
+	}
+	switch mode[0] {
+	case 'p':
+		_, err := io.ReadFull(body, make([]byte, 10))
+		return NothingAction, err
+	case 'e':
+		var length [LengthFieldSize]byte
+		if _, err := io.ReadFull(body, length[:]); err != nil {
+			return DisconnectionAction, err
+		}
+		return NothingAction, conn.SendStream(nil, int64(binary.BigEndian.Uint32(length[:])), body)
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, body)
+	if err != nil {
+		return DisconnectionAction, err
+	}
+	return NothingAction, conn.Send([]byte(fmt.Sprintf("%d %x", n+1, h.Sum(nil))), false)
+}
+
+func TestNetServer_Stream(t *testing.T) {
+	codec := &LengthFieldCodec{StreamThreshold: 1024}
+	s := newTestServer(WithCodec(codec), WithBufferCapacity(256))
+	handler := &streamHandler{echoHandler: newEchoHandler()}
+	address := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(address, handler))
+	listening, result := startServer(t, s, address)
+	conn, err := net.Dial("tcp", listening[address])
+	assert.Nil(t, err)
+	defer conn.Close()
+	body := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+	t.Run("test receive", func(t *testing.T) {
+		frame := append([]byte{'d'}, body...)
+		go conn.Write(codec.Encode(frame))
+		sum := sha256.Sum256(body)
+		b := make([]byte, LengthFieldSize)
+		_, err := io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		b = make([]byte, binary.BigEndian.Uint32(b))
+		_, err = io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), fmt.Sprintf("%d %x", len(frame), sum))
+	})
+
+	t.Run("test discard unread body", func(t *testing.T) {
+		go func() {
+			conn.Write(codec.Encode(append([]byte{'p'}, body...)))
+			conn.Write(codec.Encode([]byte("hello")))
+		}()
+		assert.Equal(t, readFrame(t, conn), "hello")
+	})
+
+	t.Run("test send", func(t *testing.T) {
+		length := make([]byte, LengthFieldSize)
+		binary.BigEndian.PutUint32(length, uint32(len(body)))
+		go conn.Write(codec.Encode(append(append([]byte{'e'}, length...), body...)))
+		header := make([]byte, LengthFieldSize)
+		_, err := io.ReadFull(conn, header)
+		assert.Nil(t, err)
+		assert.Equal(t, header, length)
+		b := make([]byte, len(body))
+		_, err = io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(b, body))
+	})
+
+	t.Run("test send not supported", func(t *testing.T) {
+		c := &netConnection{codec: new(NothingCodec)}
+		assert.ErrorIs(t, c.SendStream(nil, 1, bytes.NewReader([]byte("x"))), ErrStreamNotSupported)
+	})
+
+	conn.Close()
+	<-handler.disconnected
+	st := s.Stats().Addresses[0]
+	assert.Equal(t, st.FramesIn, uint64(4))
+	assert.Equal(t, st.Disconnects["peer_closed"], uint64(1))
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}
+
+func TestNetServer_StreamChain(t *testing.T) {
+	codec := &LengthFieldCodec{StreamThreshold: 1024}
+	s := newTestServer(WithCodec(codec), WithBufferCapacity(2048))
+	recorder := NewLatencyRecorder()
+	streamed := NewAddress("tcp", "127.0.0.1:0")
+	assert.Nil(t, s.Bind(streamed, Chain(&streamHandler{echoHandler: newEchoHandler()}, Recovery(), AccessLog(), Latency(recorder))))
+	// the wrapped Handler is not a StreamHandler, so it receives whole frames
+	buffered := NewAddress("tcp", "127.0.0.1:0")
+	echo := newEchoHandler()
+	assert.Nil(t, s.Bind(buffered, Chain(echo, Recovery(), AccessLog())))
+	listening, result := startServer(t, s, streamed, buffered)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+
+	t.Run("test stream handler", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[streamed])
+		assert.Nil(t, err)
+		defer conn.Close()
+		frame := append([]byte{'d'}, body...)
+		go conn.Write(codec.Encode(frame))
+		sum := sha256.Sum256(body)
+		b := make([]byte, LengthFieldSize)
+		_, err = io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		b = make([]byte, binary.BigEndian.Uint32(b))
+		_, err = io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), fmt.Sprintf("%d %x", len(frame), sum))
+		// the latency is observed after OnStream returns
+		for i := 0; i < 100 && recorder.Total().Snapshot().Count == 0; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, recorder.Total().Snapshot().Count, uint64(1))
+	})
+
+	t.Run("test receive whole frame", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[buffered])
+		assert.Nil(t, err)
+		defer conn.Close()
+		frame := codec.Encode(body[:1500])
+		go conn.Write(frame)
+		b := make([]byte, len(frame))
+		_, err = io.ReadFull(conn, b)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(b, frame))
+	})
+
+	t.Run("test whole frame too large", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listening[buffered])
+		assert.Nil(t, err)
+		defer conn.Close()
+		// the frame is not buffered beyond BufferCapacity
+		go conn.Write(codec.Encode(body))
+		_, err = conn.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+		// the connection of last test and this one
+		<-echo.disconnected
+		<-echo.disconnected
+		echo.mu.Lock()
+		if assert.Len(t, echo.errs, 1) {
+			assert.ErrorIs(t, echo.errs[0], ErrFrameTooLarge)
+		}
+		echo.mu.Unlock()
+	})
+
+	assert.Nil(t, s.Stop())
+	assert.ErrorIs(t, <-result, ErrServerClosed)
+}